@@ -5,4 +5,6 @@ type LocalAlbum struct {
 	Title               string  // either the directory base name, or metadata
 	Description         string  // As found in the metadata
 	Latitude, Longitude float64 // As found in the metadata
+	Cover               string  // Name of the cover's file in the album's folder, if any
+	Order               string  // Sort order of the album's assets: asc or desc, if any
 }
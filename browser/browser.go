@@ -2,9 +2,24 @@ package browser
 
 import (
 	"context"
+	"io/fs"
+
+	"github.com/simulot/immich-go/immich/metadata"
 )
 
 type Browser interface {
 	Prepare(cxt context.Context) error
 	Browse(cxt context.Context) chan *LocalAssetFile
 }
+
+// Quarantine receives the files that can't be imported, with their companion files
+type Quarantine interface {
+	Put(ctx context.Context, fsys fs.FS, name string, reason string, companions ...metadata.SideCarFile) error
+}
+
+// Inventory is implemented by browsers able to enumerate the prepared assets
+// without reading their content. It must be called after Prepare.
+// The assets are described with what is known before reading the files, the date of capture can be unknown.
+type Inventory interface {
+	Inventory(ctx context.Context, fn func(*LocalAssetFile) error) error
+}
@@ -0,0 +1,109 @@
+package files
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/fs"
+	"path"
+	"strings"
+
+	"github.com/simulot/immich-go/browser"
+	"github.com/simulot/immich-go/helpers/fshelper"
+	"gopkg.in/yaml.v3"
+)
+
+/*
+	A folder can describe its album with a file album.json or .album.yaml:
+
+	title: Holidays 2023
+	description: The summer in Brittany
+	cover: IMG_1234.jpg
+	order: asc
+	latitude: 48.2
+	longitude: -4.5
+
+	A folder containing a file .nomedia or .immichskip is skipped with its sub-folders.
+*/
+
+// albumFileNames are the names of the files describing the album of their folder
+var albumFileNames = map[string]bool{
+	"album.json":  true,
+	".album.yaml": true,
+	".album.yml":  true,
+}
+
+// skipMarkers are the files excluding their folder and its sub-folders
+var skipMarkers = []string{".nomedia", ".immichskip"}
+
+type albumFile struct {
+	Title       string  `json:"title"       yaml:"title"`
+	Description string  `json:"description" yaml:"description"`
+	Cover       string  `json:"cover"       yaml:"cover"`
+	Order       string  `json:"order"       yaml:"order"`
+	Latitude    float64 `json:"latitude"    yaml:"latitude"`
+	Longitude   float64 `json:"longitude"   yaml:"longitude"`
+}
+
+// isAlbumFile tells if the file describes the album of its folder
+func isAlbumFile(name string) bool {
+	return albumFileNames[strings.ToLower(path.Base(name))]
+}
+
+// skipMarker gives the marker excluding the folder, if any
+func skipMarker(fsys fs.FS, dir string) string {
+	for _, m := range skipMarkers {
+		if _, err := fs.Stat(fsys, path.Join(dir, m)); err == nil {
+			return m
+		}
+	}
+	return ""
+}
+
+// readAlbumFile reads the album of the folder dir.
+// The album is named after the folder when the file has no title.
+func readAlbumFile(fsys fs.FS, name string, dir string) (browser.LocalAlbum, error) {
+	b, err := fs.ReadFile(fsys, name)
+	if err != nil {
+		return browser.LocalAlbum{}, err
+	}
+	var af albumFile
+	if strings.EqualFold(path.Ext(name), ".json") {
+		err = json.Unmarshal(b, &af)
+	} else {
+		err = yaml.Unmarshal(b, &af)
+	}
+	if err != nil {
+		return browser.LocalAlbum{}, fmt.Errorf("%s: %w", name, err)
+	}
+
+	order := strings.ToLower(af.Order)
+	switch order {
+	case "", "asc", "desc":
+	default:
+		return browser.LocalAlbum{}, fmt.Errorf("%s: invalid order %q, use asc or desc", name, af.Order)
+	}
+
+	if af.Latitude < -90 || af.Latitude > 90 {
+		return browser.LocalAlbum{}, fmt.Errorf("%s: invalid latitude %v, use a value between -90 and 90", name, af.Latitude)
+	}
+	if af.Longitude < -180 || af.Longitude > 180 {
+		return browser.LocalAlbum{}, fmt.Errorf("%s: invalid longitude %v, use a value between -180 and 180", name, af.Longitude)
+	}
+
+	title := af.Title
+	if title == "" {
+		title = path.Base(dir)
+		if dir == "." {
+			title = fshelper.SourceName(fsys)
+		}
+	}
+	return browser.LocalAlbum{
+		Path:        dir,
+		Title:       title,
+		Description: af.Description,
+		Latitude:    af.Latitude,
+		Longitude:   af.Longitude,
+		Cover:       af.Cover,
+		Order:       order,
+	}, nil
+}
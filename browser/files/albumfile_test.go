@@ -0,0 +1,90 @@
+package files
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	"github.com/kr/pretty"
+	"github.com/simulot/immich-go/browser"
+	"github.com/simulot/immich-go/helpers/fileevent"
+)
+
+func TestAlbumFiles(t *testing.T) {
+	fsys := newInMemFS().
+		addFile("A/IMG_20230101_120000.jpg").
+		addFile("A/IMG_20230102_120000.jpg").
+		addFile("B/IMG_20230103_120000.jpg").
+		addFile("C/IMG_20230104_120000.jpg").
+		addFile("C/D/IMG_20230105_120000.jpg").
+		addFile("C/.nomedia").
+		addFile("E/IMG_20230106_120000.jpg").
+		addFile("E/.immichskip").
+		addFile("F/IMG_20230107_120000.jpg")
+	if fsys.err != nil {
+		t.Fatal(fsys.err)
+	}
+	err := fsys.WriteFile("A/album.json", []byte(`{"title":"Holidays","description":"Summer in Brittany","cover":"IMG_20230102_120000.jpg","order":"DESC","latitude":48.2,"longitude":-4.5}`), 0o777)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = fsys.WriteFile("B/.album.yaml", []byte("description: No title\norder: asc\nlatitude: -33.9\nlongitude: 151.2\n"), 0o777)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	holidays := browser.LocalAlbum{Path: "A", Title: "Holidays", Description: "Summer in Brittany", Latitude: 48.2, Longitude: -4.5, Cover: "IMG_20230102_120000.jpg", Order: "desc"}
+	noTitle := browser.LocalAlbum{Path: "B", Title: "B", Description: "No title", Latitude: -33.9, Longitude: 151.2, Order: "asc"}
+	want := map[string][]browser.LocalAlbum{
+		"A/IMG_20230101_120000.jpg": {holidays},
+		"A/IMG_20230102_120000.jpg": {holidays},
+		"B/IMG_20230103_120000.jpg": {noTitle},
+		"F/IMG_20230107_120000.jpg": nil,
+	}
+
+	ctx := context.Background()
+	b, err := NewLocalFiles(ctx, fileevent.NewRecorder(nil, false), fsys)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = b.Prepare(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := map[string][]browser.LocalAlbum{}
+	for a := range b.Browse(ctx) {
+		got[a.FileName] = a.Albums
+		a.Close()
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("unexpected albums")
+		pretty.Ldiff(t, want, got)
+	}
+}
+
+func TestReadAlbumFileInvalid(t *testing.T) {
+	tc := []struct {
+		name    string
+		content string
+	}{
+		{name: "order", content: "order: newest\n"},
+		{name: "latitude", content: "latitude: 91\nlongitude: 2.3\n"},
+		{name: "longitude", content: "latitude: 48.8\nlongitude: -180.5\n"},
+	}
+	for _, c := range tc {
+		t.Run(c.name, func(t *testing.T) {
+			fsys := newInMemFS()
+			err := fsys.MkdirAll("A", 0o777)
+			if err == nil {
+				err = fsys.WriteFile("A/.album.yml", []byte(c.content), 0o777)
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			_, err = readAlbumFile(fsys, "A/.album.yml", "A")
+			if err == nil {
+				t.Errorf("expecting an error for the invalid %s", c.name)
+			}
+		})
+	}
+}
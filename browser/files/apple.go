@@ -0,0 +1,158 @@
+package files
+
+import (
+	"context"
+	"io/fs"
+	"path"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/simulot/immich-go/browser"
+	"github.com/simulot/immich-go/helpers/fileevent"
+	"github.com/simulot/immich-go/helpers/stacking"
+	"github.com/simulot/immich-go/immich"
+	"github.com/simulot/immich-go/immich/metadata"
+)
+
+/*
+	The iPhone exports an edited photo as IMG_E1234.JPG next to its original IMG_1234.HEIC.
+	The adjustments are described by the file IMG_1234.AAE.
+*/
+
+// AppleEdits tells which photos are kept when an Apple's edit is found with its original
+type AppleEdits string
+
+const (
+	AppleEditsStack    AppleEdits = "STACK"    // both photos, stacked with the edit as cover
+	AppleEditsEdit     AppleEdits = "EDIT"     // the edit only
+	AppleEditsOriginal AppleEdits = "ORIGINAL" // the original only
+)
+
+var appleOriginalRE = regexp.MustCompile(`(?i)^(IMG_)(\d+)$`)
+
+// isAAE tells if the file gives the adjustments of an Apple's edit
+func isAAE(name string) bool {
+	return strings.EqualFold(path.Ext(name), ".aae")
+}
+
+// appleOriginal gives the name without extension of the original of an edit: IMG_E1234 -> IMG_1234
+func appleOriginal(base string) (string, bool) {
+	dir, file := path.Split(base)
+	parts := stacking.AppleEditRE.FindStringSubmatch(file)
+	if len(parts) == 0 {
+		return "", false
+	}
+	return dir + parts[1] + parts[2], true
+}
+
+// appleEdit gives the name without extension of the edit of an original: IMG_1234 -> IMG_E1234
+func appleEdit(base string) (string, bool) {
+	dir, file := path.Split(base)
+	parts := appleOriginalRE.FindStringSubmatch(file)
+	if len(parts) == 0 {
+		return "", false
+	}
+	e := "E"
+	if parts[1] != strings.ToUpper(parts[1]) {
+		e = "e"
+	}
+	return dir + parts[1] + e + parts[2], true
+}
+
+// selectAppleEdits removes from the catalog the edits or the originals not to be uploaded
+func (la *LocalAssetBrowser) selectAppleEdits(ctx context.Context, fsys fs.FS) {
+	if la.appleEdits == AppleEditsStack || la.appleEdits == "" {
+		return
+	}
+	for dir, files := range la.catalogs[fsys] {
+		byBase := map[string][]string{} // files by normalized name without extension
+		for _, f := range files {
+			if isAAE(f) {
+				continue
+			}
+			key := trimExt(la.names.Key(f))
+			byBase[key] = append(byBase[key], f)
+		}
+
+		drop := map[string]string{} // dropped files with the reason
+		for key, edits := range byBase {
+			original, ok := appleOriginal(key)
+			if !ok || !la.hasImage(edits) || !la.hasImage(byBase[original]) {
+				continue
+			}
+			switch la.appleEdits {
+			case AppleEditsEdit:
+				for _, f := range byBase[original] {
+					drop[f] = "original of the Apple edit " + path.Base(edits[0])
+				}
+			case AppleEditsOriginal:
+				for _, f := range edits {
+					drop[f] = "Apple edit of " + path.Base(byBase[original][0])
+				}
+			}
+		}
+		if len(drop) == 0 {
+			continue
+		}
+		kept := files[:0]
+		for _, f := range files {
+			if reason, ok := drop[f]; ok {
+				la.log.Record(ctx, fileevent.DiscoveredDiscarded, nil, f, "reason", reason)
+				continue
+			}
+			kept = append(kept, f)
+		}
+		la.catalogs[fsys][dir] = kept
+	}
+}
+
+// hasImage tells if one of the files is an image
+func (la *LocalAssetBrowser) hasImage(files []string) bool {
+	for _, f := range files {
+		if la.sm.TypeFromExt(path.Ext(f)) == immich.TypeImage {
+			return true
+		}
+	}
+	return false
+}
+
+// linkAdjustments links the AAE files to the edit of their photo, or to the photo itself.
+// images gives the keys of the images by normalized name without extension.
+func (la *LocalAssetBrowser) linkAdjustments(links map[string]fileLinks, images map[string][]string, files []string) {
+	sort.Strings(files)
+	for _, file := range files {
+		base := trimExt(la.names.Key(file))
+		candidates := []string{}
+		if edit, ok := appleEdit(base); ok {
+			candidates = append(candidates, images[edit]...)
+		}
+		candidates = append(candidates, images[base]...)
+		for _, k := range candidates {
+			if linked := links[k]; linked.adjustments == "" {
+				linked.adjustments = file
+				links[k] = linked
+				break
+			}
+		}
+	}
+}
+
+// setAdjustments keeps the adjustments of the AAE file in the asset's description
+func (la *LocalAssetBrowser) setAdjustments(ctx context.Context, fsys fs.FS, a *browser.LocalAssetFile, name string) {
+	f, err := fsys.Open(name)
+	if err != nil {
+		la.log.Record(ctx, fileevent.Error, nil, name, "error", err.Error())
+		return
+	}
+	defer f.Close()
+	adj, err := metadata.ReadAAE(f)
+	if err != nil {
+		la.log.Record(ctx, fileevent.Error, nil, name, "error", err.Error())
+		return
+	}
+	la.log.Record(ctx, fileevent.AnalysisAssociatedMetadata, nil, name, "main", a.FileName)
+	if a.Metadata.Description == "" {
+		a.Metadata.Description = adj.Description()
+	}
+}
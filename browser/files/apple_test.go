@@ -0,0 +1,119 @@
+package files
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	"github.com/kr/pretty"
+	"github.com/simulot/immich-go/helpers/fileevent"
+	"github.com/simulot/immich-go/helpers/namenorm"
+)
+
+const aaeContent = `<?xml version="1.0" encoding="UTF-8"?>
+<plist version="1.0">
+<dict>
+	<key>adjustmentEditorBundleID</key>
+	<string>com.apple.mobileslideshow</string>
+	<key>adjustmentFormatIdentifier</key>
+	<string>com.apple.photo</string>
+	<key>adjustmentFormatVersion</key>
+	<string>1.4</string>
+</dict>
+</plist>
+`
+
+func TestAppleEdits(t *testing.T) {
+	const edited = "Apple edits: com.apple.photo 1.4"
+	tc := []struct {
+		keep     AppleEdits
+		foldCase bool
+		expected map[string]string // description by asset
+	}{
+		{
+			keep: AppleEditsStack,
+			expected: map[string]string{
+				"iphone/IMG_1234.HEIC":  "",
+				"iphone/IMG_E1234.JPG":  edited,
+				"iphone/IMG_1235.HEIC":  edited,
+				"iphone/IMG_E1236.JPG":  "",
+				"iphone/IMG_E1237.jpeg": "",
+			},
+		},
+		{
+			keep:     AppleEditsStack,
+			foldCase: true,
+			expected: map[string]string{
+				"iphone/IMG_1234.HEIC":  "",
+				"iphone/IMG_E1234.JPG":  edited,
+				"iphone/IMG_1235.HEIC":  edited,
+				"iphone/IMG_E1236.JPG":  "",
+				"iphone/IMG_E1237.jpeg": "",
+			},
+		},
+		{
+			keep: AppleEditsEdit,
+			expected: map[string]string{
+				"iphone/IMG_E1234.JPG":  edited,
+				"iphone/IMG_1235.HEIC":  edited,
+				"iphone/IMG_E1236.JPG":  "",
+				"iphone/IMG_E1237.jpeg": "",
+			},
+		},
+		{
+			keep: AppleEditsOriginal,
+			expected: map[string]string{
+				"iphone/IMG_1234.HEIC":  edited,
+				"iphone/IMG_1235.HEIC":  edited,
+				"iphone/IMG_E1236.JPG":  "",
+				"iphone/IMG_E1237.jpeg": "",
+			},
+		},
+	}
+	for _, c := range tc {
+		name := string(c.keep)
+		if c.foldCase {
+			name += " ignoring the case"
+		}
+		t.Run(name, func(t *testing.T) {
+			fsys := newInMemFS().
+				addFile("iphone/IMG_1234.HEIC").
+				addFile("iphone/IMG_1234.MOV").
+				addFile("iphone/IMG_E1234.JPG").
+				addFile("iphone/IMG_1235.HEIC").
+				addFile("iphone/IMG_E1236.JPG"). // edit without original
+				addFile("iphone/IMG_E1237.jpeg")
+			if fsys.err != nil {
+				t.Fatal(fsys.err)
+			}
+			for _, name := range []string{"iphone/IMG_1234.AAE", "iphone/IMG_1235.AAE"} {
+				if err := fsys.WriteFile(name, []byte(aaeContent), 0o777); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			ctx := context.Background()
+			b, err := NewLocalFiles(ctx, fileevent.NewRecorder(nil, false), fsys)
+			if err != nil {
+				t.Fatal(err)
+			}
+			b.SetAppleEdits(c.keep).SetNameNormalizer(namenorm.Normalizer{FoldCase: c.foldCase})
+			err = b.Prepare(ctx)
+			if err != nil {
+				t.Fatal(err)
+			}
+			got := map[string]string{}
+			for a := range b.Browse(ctx) {
+				got[a.FileName] = a.Metadata.Description
+				if c.keep == AppleEditsEdit && a.FileName == "iphone/IMG_E1234.JPG" && a.LivePhoto != nil {
+					t.Errorf("the video of the original is linked to the edit")
+				}
+				a.Close()
+			}
+			if !reflect.DeepEqual(got, c.expected) {
+				t.Errorf("unexpected assets")
+				pretty.Ldiff(t, c.expected, got)
+			}
+		})
+	}
+}
@@ -2,46 +2,66 @@ package files
 
 import (
 	"context"
+	"encoding/json"
+	"fmt"
 	"io/fs"
 	"path"
 	"path/filepath"
+	"slices"
 	"sort"
 	"strings"
 	"time"
 
 	"github.com/simulot/immich-go/browser"
+	"github.com/simulot/immich-go/helpers/extsort"
 	"github.com/simulot/immich-go/helpers/fileevent"
 	"github.com/simulot/immich-go/helpers/fshelper"
 	"github.com/simulot/immich-go/helpers/gen"
+	"github.com/simulot/immich-go/helpers/incremental"
 	"github.com/simulot/immich-go/helpers/namematcher"
+	"github.com/simulot/immich-go/helpers/namenorm"
 	"github.com/simulot/immich-go/immich"
 	"github.com/simulot/immich-go/immich/metadata"
 )
 
 type fileLinks struct {
-	image   string
-	video   string
-	sidecar string
+	image       string
+	video       string
+	sidecar     string
+	adjustments string // Apple's AAE file
 }
 
 type LocalAssetBrowser struct {
 	fsyss       []fs.FS
-	albums      map[string]string
+	albums      map[fs.FS]map[string]browser.LocalAlbum // albums described by the files of the folders
 	catalogs    map[fs.FS]map[string][]string
 	log         *fileevent.Recorder
 	sm          immich.SupportedMedia
 	bannedFiles namematcher.List // list of file pattern to be exclude
 	whenNoDate  string
+	quarantine  browser.Quarantine           // receives unsupported files
+	incremental map[fs.FS]*incremental.State // files handled by the previous runs
+	order       browser.Order                // order of the assets
+	names       namenorm.Normalizer          // compares the names of the linked files
+	workers     int                          // number of files read at the same time
+	appleEdits  AppleEdits                   // photos kept when an Apple's edit is found with its original
+
+	files map[fshelper.FileID]browser.FileLink    // first path of each file on the disk
+	links map[browser.FileLink][]browser.FileLink // other paths of the files seen several times
 }
 
 func NewLocalFiles(ctx context.Context, l *fileevent.Recorder, fsyss ...fs.FS) (*LocalAssetBrowser, error) {
 	return &LocalAssetBrowser{
 		fsyss:      fsyss,
-		albums:     map[string]string{},
+		albums:     map[fs.FS]map[string]browser.LocalAlbum{},
 		catalogs:   map[fs.FS]map[string][]string{},
 		log:        l,
 		whenNoDate: "FILE",
 		sm:         immich.DefaultSupportedMedia,
+		workers:    defaultWorkers,
+		appleEdits: AppleEditsStack,
+		files:      map[fshelper.FileID]browser.FileLink{},
+		links:      map[browser.FileLink][]browser.FileLink{},
 	}, nil
 }
 
@@ -60,6 +80,41 @@ func (la *LocalAssetBrowser) SetWhenNoDate(opt string) *LocalAssetBrowser {
 	return la
 }
 
+func (la *LocalAssetBrowser) SetQuarantine(q browser.Quarantine) *LocalAssetBrowser {
+	la.quarantine = q
+	return la
+}
+
+// SetIncremental gives the states of the folders, unchanged files are skipped during the walk
+func (la *LocalAssetBrowser) SetIncremental(states map[fs.FS]*incremental.State) *LocalAssetBrowser {
+	la.incremental = states
+	return la
+}
+
+// SetNameNormalizer sets how the names are compared to link the files
+func (la *LocalAssetBrowser) SetNameNormalizer(n namenorm.Normalizer) *LocalAssetBrowser {
+	la.names = n
+	return la
+}
+
+// SetWorkers sets the number of files read at the same time to get their metadata
+func (la *LocalAssetBrowser) SetWorkers(n int) *LocalAssetBrowser {
+	la.workers = n
+	return la
+}
+
+// SetAppleEdits sets which photos are kept when an Apple's edit is found with its original
+func (la *LocalAssetBrowser) SetAppleEdits(keep AppleEdits) *LocalAssetBrowser {
+	la.appleEdits = keep
+	return la
+}
+
+// SetOrder sets the order of the assets given by Browse
+func (la *LocalAssetBrowser) SetOrder(order browser.Order) *LocalAssetBrowser {
+	la.order = order
+	return la
+}
+
 func (la *LocalAssetBrowser) Prepare(ctx context.Context) error {
 	for _, fsys := range la.fsyss {
 		err := la.passOneFsWalk(ctx, fsys)
@@ -73,6 +128,7 @@ func (la *LocalAssetBrowser) Prepare(ctx context.Context) error {
 
 func (la *LocalAssetBrowser) passOneFsWalk(ctx context.Context, fsys fs.FS) error {
 	la.catalogs[fsys] = map[string][]string{}
+	la.albums[fsys] = map[string]browser.LocalAlbum{}
 	err := fs.WalkDir(fsys, ".",
 		func(name string, d fs.DirEntry, err error) error {
 			if err != nil {
@@ -80,6 +136,10 @@ func (la *LocalAssetBrowser) passOneFsWalk(ctx context.Context, fsys fs.FS) erro
 			}
 
 			if d.IsDir() {
+				if marker := skipMarker(fsys, name); marker != "" {
+					la.log.Record(ctx, fileevent.DiscoveredDiscarded, nil, name, "reason", "folder marked by "+marker)
+					return fs.SkipDir
+				}
 				la.catalogs[fsys][name] = []string{}
 				return nil
 			}
@@ -93,11 +153,27 @@ func (la *LocalAssetBrowser) passOneFsWalk(ctx context.Context, fsys fs.FS) erro
 				if dir == "" {
 					dir = "."
 				}
+				if isAlbumFile(base) {
+					album, err := readAlbumFile(fsys, name, dir)
+					if err != nil {
+						la.log.Record(ctx, fileevent.Error, nil, name, "error", err.Error())
+						return nil
+					}
+					la.albums[fsys][dir] = album
+					la.log.Record(ctx, fileevent.DiscoveredSidecar, nil, name, "type", "album metadata", "title", album.Title)
+					return nil
+				}
 				ext := filepath.Ext(base)
 				mediaType := la.sm.TypeFromExt(ext)
 
+				if isAAE(base) {
+					la.log.Record(ctx, fileevent.DiscoveredSidecar, nil, name, "type", "apple adjustments")
+					la.catalogs[fsys][dir] = append(la.catalogs[fsys][dir], name)
+					return nil
+				}
 				if mediaType == immich.TypeUnknown {
 					la.log.Record(ctx, fileevent.DiscoveredUnsupported, nil, name, "reason", "unsupported file type")
+					la.putInQuarantine(ctx, fsys, name, "unsupported file type")
 					return nil
 				}
 
@@ -116,11 +192,71 @@ func (la *LocalAssetBrowser) passOneFsWalk(ctx context.Context, fsys fs.FS) erro
 					la.log.Record(ctx, fileevent.DiscoveredDiscarded, nil, name, "reason", "banned file")
 					return nil
 				}
+
+				// sidecars are always kept, they are needed when their image has changed
+				if state := la.incremental[fsys]; state != nil && mediaType != immich.TypeSidecar {
+					info, err := d.Info()
+					if err != nil {
+						return err
+					}
+					if state.Unchanged(name, info.Size(), info.ModTime()) {
+						la.log.Record(ctx, fileevent.DiscoveredUnchanged, nil, name)
+						return nil
+					}
+				}
+				if mediaType != immich.TypeSidecar {
+					if first, ok := la.sameFile(fsys, name, d); ok {
+						la.log.Record(ctx, fileevent.AnalysisLocalDuplicate, nil, name, "reason", "same file as "+first.FileName)
+						return nil
+					}
+				}
 				la.catalogs[fsys][dir] = append(cat, name)
 			}
 			return nil
 		})
-	return err
+	if err != nil {
+		return err
+	}
+	la.selectAppleEdits(ctx, fsys)
+	return nil
+}
+
+// sameFile tells if the file has been seen with another path, and gives its first path.
+// The file is identified by its device and inode: hard links and bind mounts are processed once.
+func (la *LocalAssetBrowser) sameFile(fsys fs.FS, name string, d fs.DirEntry) (browser.FileLink, bool) {
+	var info fs.FileInfo
+	var err error
+	if d.Type()&fs.ModeSymlink != 0 {
+		info, err = fs.Stat(fsys, name)
+	} else {
+		info, err = d.Info()
+	}
+	if err != nil {
+		return browser.FileLink{}, false
+	}
+	id, ok := fshelper.FileIDOf(info)
+	if !ok {
+		return browser.FileLink{}, false
+	}
+	link := browser.FileLink{FSys: fsys, FileName: name}
+	first, seen := la.files[id]
+	if !seen {
+		la.files[id] = link
+		return link, false
+	}
+	la.links[first] = append(la.links[first], link)
+	return first, true
+}
+
+// putInQuarantine copies the file in the quarantine folder, when any
+func (la *LocalAssetBrowser) putInQuarantine(ctx context.Context, fsys fs.FS, name string, reason string) {
+	if la.quarantine == nil {
+		return
+	}
+	err := la.quarantine.Put(ctx, fsys, name, reason)
+	if err != nil {
+		la.log.Record(ctx, fileevent.Error, nil, name, "error", "can't copy the file in the quarantine: "+err.Error())
+	}
 }
 
 func (la *LocalAssetBrowser) Browse(ctx context.Context) chan *browser.LocalAssetFile {
@@ -129,138 +265,327 @@ func (la *LocalAssetBrowser) Browse(ctx context.Context) chan *browser.LocalAsse
 	go func(ctx context.Context) {
 		defer close(fileChan)
 		var err error
+		if la.order.Sorted() {
+			err = la.browseOrdered(ctx, fileChan)
+		} else {
+			err = la.makeAssets(ctx, fileChan, la.produceFolders)
+		}
+		if err != nil && ctx.Err() == nil {
+			la.log.Record(ctx, fileevent.Error, nil, "", "error", err.Error())
+		}
+	}(ctx)
 
-		errFn := func(name string, err error) {
+	return fileChan
+}
+
+// produceFolders gives the linked files in the order of the folders
+func (la *LocalAssetBrowser) produceFolders(add func(fsys fs.FS, linked fileLinks) error) error {
+	for _, fsys := range la.fsyss {
+		dirs := gen.MapKeys(la.catalogs[fsys])
+		sort.Strings(dirs)
+		for _, dir := range dirs {
+			links := la.linkFiles(la.catalogs[fsys][dir])
+			files := gen.MapKeys(links)
+			sort.Strings(files)
+			for _, file := range files {
+				err := add(fsys, links[file])
+				if err != nil {
+					return err
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// trimExt removes the extension of the name
+func trimExt(name string) string {
+	return strings.TrimSuffix(name, path.Ext(name))
+}
+
+// linkFiles associates the images of a folder with their sidecar and their live photo video.
+// The links are indexed by the normalized names, they keep the original names of the files.
+// The files are paired through an index of their names without extension.
+func (la *LocalAssetBrowser) linkFiles(files []string) map[string]fileLinks {
+	links := map[string]fileLinks{}
+	images := map[string][]string{}            // keys of the images by name without extension
+	alone := map[string][]string{}             // keys of the unlinked videos by name without extension
+	videos, sidecars := []string{}, []string{} // files to be linked
+	adjustments := []string{}                  // Apple's AAE files
+
+	// Scan images first
+	for _, file := range files {
+		switch la.sm.TypeFromExt(path.Ext(file)) {
+		case immich.TypeImage:
+			key := la.names.Key(file)
+			linked := links[key]
+			linked.image = file
+			links[key] = linked
+			images[trimExt(key)] = append(images[trimExt(key)], key)
+		case immich.TypeVideo:
+			videos = append(videos, file)
+		case immich.TypeSidecar:
+			sidecars = append(sidecars, file)
+		default:
+			if isAAE(file) {
+				adjustments = append(adjustments, file)
+			}
+		}
+	}
+	for _, l := range images {
+		sort.Strings(l)
+	}
+
+	// firstFree gives the first linked files without the given part
+	firstFree := func(keys []string, free func(fileLinks) bool) (string, bool) {
+		for _, k := range keys {
+			if free(links[k]) {
+				return k, true
+			}
+		}
+		return "", false
+	}
+
+	for _, file := range videos {
+		key := la.names.Key(file)
+		base := trimExt(key)
+		if image, ok := links[base]; ok {
+			// file.MP.ext -> file.ext
+			image.sidecar = file
+			links[base] = image
+			continue
+		}
+		noVideo := func(l fileLinks) bool { return l.video == "" }
+		f, ok := firstFree(images[base], noVideo) // base.MP4 -> base.ext
+		if !ok {
+			f, ok = firstFree(images[key], noVideo) // base.MP -> base.MP.jpg
+		}
+		if ok {
+			image := links[f]
+			image.video = file
+			links[f] = image
+			continue
+		}
+		// Unlinked video
+		links[key] = fileLinks{video: file}
+		alone[base] = append(alone[base], key)
+	}
+
+	for _, file := range sidecars {
+		key := la.names.Key(file)
+		base := trimExt(key)
+		if linked, ok := links[base]; ok {
+			// file.ext.XMP -> file.ext
+			linked.sidecar = file
+			links[base] = linked
+			continue
+		}
+		// base.XMP -> base.ext, the images first
+		noSidecar := func(l fileLinks) bool { return l.sidecar == "" }
+		f, ok := firstFree(images[base], noSidecar)
+		if !ok {
+			f, ok = firstFree(alone[base], noSidecar)
+		}
+		if ok {
+			linked := links[f]
+			linked.sidecar = file
+			links[f] = linked
+		}
+	}
+	la.linkAdjustments(links, images, adjustments)
+	return links
+}
+
+// assetFromLinks makes the asset of the linked files.
+// The error is already recorded when returned.
+func (la *LocalAssetBrowser) assetFromLinks(ctx context.Context, fsys fs.FS, linked fileLinks) (*browser.LocalAssetFile, error) {
+	var a *browser.LocalAssetFile
+	var err error
+
+	errFn := func(name string, err error) {
+		if err != nil {
+			la.log.Record(ctx, fileevent.Error, nil, name, "error", err.Error())
+		}
+	}
+
+	if linked.image != "" {
+		a, err = la.assetFromFile(fsys, linked.image)
+		if err != nil {
+			errFn(linked.image, err)
+			return nil, err
+		}
+		if linked.video != "" {
+			a.LivePhoto, err = la.assetFromFile(fsys, linked.video)
 			if err != nil {
-				la.log.Record(ctx, fileevent.Error, nil, name, "error", err.Error())
+				errFn(linked.video, err)
+				return nil, err
 			}
 		}
-		for _, fsys := range la.fsyss {
-			dirs := gen.MapKeys(la.catalogs[fsys])
-			sort.Strings(dirs)
-			for _, dir := range dirs {
-				links := map[string]fileLinks{}
-				files := la.catalogs[fsys][dir]
-
-				if len(files) == 0 {
-					continue
-				}
+	} else if linked.video != "" {
+		a, err = la.assetFromFile(fsys, linked.video)
+		if err != nil {
+			errFn(linked.video, err)
+			return nil, err
+		}
+	}
 
-				// Scan images first
-				for _, file := range files {
-					ext := path.Ext(file)
-					if la.sm.TypeFromExt(ext) == immich.TypeImage {
-						linked := links[file]
-						linked.image = file
-						links[file] = linked
-					}
-				}
+	if a != nil {
+		if album, ok := la.albums[fsys][path.Dir(a.FileName)]; ok {
+			a.AddAlbum(album)
+		}
+		if linked.adjustments != "" {
+			la.setAdjustments(ctx, fsys, a, linked.adjustments)
+		}
+	}
 
-			next:
-				for _, file := range files {
-					ext := path.Ext(file)
-					t := la.sm.TypeFromExt(ext)
-					if t == immich.TypeImage {
-						continue next
-					}
+	if a != nil && linked.sidecar != "" {
+		a.SideCar = metadata.SideCarFile{
+			FSys:     fsys,
+			FileName: linked.sidecar,
+		}
+		la.log.Record(ctx, fileevent.AnalysisAssociatedMetadata, nil, linked.sidecar, "main", a.FileName)
+	}
+	if a != nil {
+		la.linkedPathsAlbums(ctx, a)
+	}
+	return a, nil
+}
 
-					base := strings.TrimSuffix(file, ext)
-					switch t {
-					case immich.TypeSidecar:
-						if image, ok := links[base]; ok {
-							// file.ext.XMP -> file.ext
-							image.sidecar = file
-							links[base] = image
-							continue next
-						}
-						for f := range links {
-							if strings.TrimSuffix(f, path.Ext(f)) == base {
-								if image, ok := links[f]; ok {
-									// base.XMP -> base.ext
-									image.sidecar = file
-									links[f] = image
-									continue next
-								}
-							}
-						}
-					case immich.TypeVideo:
-						if image, ok := links[base]; ok {
-							// file.MP.ext -> file.ext
-							image.sidecar = file
-							links[base] = image
-							continue next
-						}
-						for f := range links {
-							if strings.TrimSuffix(f, path.Ext(f)) == base {
-								if image, ok := links[f]; ok {
-									// base.MP4 -> base.ext
-									image.video = file
-									links[f] = image
-									continue next
-								}
-							}
-							if strings.TrimSuffix(f, path.Ext(f)) == file {
-								if image, ok := links[f]; ok {
-									// base.MP4 -> base.ext
-									image.video = file
-									links[f] = image
-									continue next
-								}
-							}
-						}
-						// Unlinked video
-						links[file] = fileLinks{video: file}
-					}
+// linkedPathsAlbums adds the albums of the folders of the asset's other paths.
+// The sidecar beside another path is used when the asset has none.
+func (la *LocalAssetBrowser) linkedPathsAlbums(ctx context.Context, a *browser.LocalAssetFile) {
+	for _, l := range a.Links {
+		dir := path.Dir(l.FileName)
+		if album, ok := la.albums[l.FSys][dir]; ok {
+			a.AddAlbum(album)
+		}
+		if a.SideCar.IsSet() {
+			continue
+		}
+		// the other path is paired with the files of its folder, like the asset's path
+		for _, linked := range la.linkFiles(append(slices.Clone(la.catalogs[l.FSys][dir]), l.FileName)) {
+			if (linked.image == l.FileName || linked.video == l.FileName) && linked.sidecar != "" {
+				a.SideCar = metadata.SideCarFile{
+					FSys:     l.FSys,
+					FileName: linked.sidecar,
 				}
+				la.log.Record(ctx, fileevent.AnalysisAssociatedMetadata, nil, linked.sidecar, "main", a.FileName)
+				break
+			}
+		}
+	}
+}
 
-				files = gen.MapKeys(links)
-				sort.Strings(files)
-				for _, file := range files {
-					var a *browser.LocalAssetFile
-					linked := links[file]
-
-					if linked.image != "" {
-						a, err = la.assetFromFile(fsys, linked.image)
-						if err != nil {
-							errFn(linked.image, err)
-							return
-						}
-						if linked.video != "" {
-							a.LivePhoto, err = la.assetFromFile(fsys, linked.video)
-							if err != nil {
-								errFn(linked.video, err)
-								return
-							}
-						}
-					} else if linked.video != "" {
-						a, err = la.assetFromFile(fsys, linked.video)
-						if err != nil {
-							errFn(linked.video, err)
-							return
-						}
-					}
+// plannedFiles is the entry of the sorted plan, it refers to the linked files of a file system
+type plannedFiles struct {
+	FS      int    `json:"fs"`
+	Image   string `json:"image,omitempty"`
+	Video   string `json:"video,omitempty"`
+	Sidecar string `json:"sidecar,omitempty"`
+	AAE     string `json:"aae,omitempty"`
+}
 
-					if a != nil && linked.sidecar != "" {
-						a.SideCar = metadata.SideCarFile{
-							FSys:     fsys,
-							FileName: linked.sidecar,
-						}
-						la.log.Record(ctx, fileevent.AnalysisAssociatedMetadata, nil, linked.sidecar, "main", a.FileName)
-					}
-					select {
-					case <-ctx.Done():
-						return
-					default:
-						if a != nil {
-							fileChan <- a
-						}
+// browseOrdered sorts the linked files before making the assets.
+// The date of the files is determined by their name, or by their modification date.
+func (la *LocalAssetBrowser) browseOrdered(ctx context.Context, fileChan chan *browser.LocalAssetFile) error {
+	plan := extsort.New(extsort.DefaultChunkSize)
+	defer plan.Close()
+
+	for i, fsys := range la.fsyss {
+		dirs := gen.MapKeys(la.catalogs[fsys])
+		sort.Strings(dirs)
+		for _, dir := range dirs {
+			links := la.linkFiles(la.catalogs[fsys][dir])
+			files := gen.MapKeys(links)
+			sort.Strings(files)
+			for _, file := range files {
+				if err := ctx.Err(); err != nil {
+					return err
+				}
+				linked := links[file]
+				main := linked.image
+				if main == "" {
+					main = linked.video
+				}
+				if main == "" {
+					continue
+				}
+				info, err := fs.Stat(fsys, main)
+				if err != nil {
+					la.log.Record(ctx, fileevent.Error, nil, main, "error", err.Error())
+					continue
+				}
+				date := metadata.TakeTimeFromPath(fullPath(fsys, main))
+				if date.IsZero() {
+					date = info.ModTime()
+				}
+				size := info.Size()
+				if linked.video != "" && linked.video != main {
+					if vi, err := fs.Stat(fsys, linked.video); err == nil {
+						size += vi.Size()
 					}
 				}
+				v, err := json.Marshal(plannedFiles{FS: i, Image: linked.image, Video: linked.video, Sidecar: linked.sidecar, AAE: linked.adjustments})
+				if err != nil {
+					return err
+				}
+				err = plan.Add(la.order.Key(date, dir, size, fmt.Sprintf("%06d/%s", i, main)), v)
+				if err != nil {
+					return err
+				}
 			}
 		}
-	}(ctx)
+	}
 
-	return fileChan
+	return la.makeAssets(ctx, fileChan, func(add func(fsys fs.FS, linked fileLinks) error) error {
+		return plan.Sort(func(e extsort.Entry) error {
+			var p plannedFiles
+			err := json.Unmarshal(e.Value, &p)
+			if err != nil {
+				return err
+			}
+			return add(la.fsyss[p.FS], fileLinks{image: p.Image, video: p.Video, sidecar: p.Sidecar, adjustments: p.AAE})
+		})
+	})
+}
+
+// Inventory enumerates the images and videos found during the preparation
+func (la *LocalAssetBrowser) Inventory(ctx context.Context, fn func(*browser.LocalAssetFile) error) error {
+	for _, fsys := range la.fsyss {
+		dirs := gen.MapKeys(la.catalogs[fsys])
+		sort.Strings(dirs)
+		for _, dir := range dirs {
+			for _, name := range la.catalogs[fsys][dir] {
+				select {
+				case <-ctx.Done():
+					return ctx.Err()
+				default:
+				}
+				if !la.sm.IsMedia(path.Ext(name)) {
+					continue
+				}
+				i, err := fs.Stat(fsys, name)
+				if err != nil {
+					continue
+				}
+				a := &browser.LocalAssetFile{
+					FileName: name,
+					Title:    path.Base(name),
+					FSys:     fsys,
+					FileSize: int(i.Size()),
+				}
+				a.Metadata.DateTaken = metadata.TakeTimeFromPath(fullPath(fsys, name))
+				if album, ok := la.albums[fsys][dir]; ok {
+					a.AddAlbum(album)
+				}
+				err = fn(a)
+				if err != nil {
+					return err
+				}
+			}
+		}
+	}
+	return nil
 }
 
 var toOldDate = time.Date(1980, 1, 1, 0, 0, 0, 0, time.UTC)
@@ -270,14 +595,10 @@ func (la *LocalAssetBrowser) assetFromFile(fsys fs.FS, name string) (*browser.Lo
 		FileName: name,
 		Title:    filepath.Base(name),
 		FSys:     fsys,
+		Links:    la.links[browser.FileLink{FSys: fsys, FileName: name}],
 	}
 
-	fullPath := name
-	if fsys, ok := fsys.(fshelper.NameFS); ok {
-		fullPath = filepath.Join(fsys.Name(), name)
-	}
-
-	a.Metadata.DateTaken = metadata.TakeTimeFromPath(fullPath)
+	a.Metadata.DateTaken = metadata.TakeTimeFromPath(fullPath(fsys, name))
 
 	i, err := fs.Stat(fsys, name)
 	if err != nil {
@@ -301,6 +622,14 @@ func (la *LocalAssetBrowser) assetFromFile(fsys fs.FS, name string) (*browser.Lo
 	return a, nil
 }
 
+// fullPath gives the file name with the name of its file system, to get a date from the folder's name
+func fullPath(fsys fs.FS, name string) string {
+	if fsys, ok := fsys.(fshelper.NameFS); ok {
+		return filepath.Join(fsys.Name(), name)
+	}
+	return name
+}
+
 func (la *LocalAssetBrowser) ReadMetadataFromFile(a *browser.LocalAssetFile) error {
 	ext := strings.ToLower(path.Ext(a.FileName))
 
@@ -312,6 +641,8 @@ func (la *LocalAssetBrowser) ReadMetadataFromFile(a *browser.LocalAssetFile) err
 	m, err := metadata.GetFromReader(r, ext)
 	if err == nil {
 		a.Metadata.DateTaken = m.DateTaken
+		a.Metadata.Duration = m.Duration
+		a.Metadata.Rotation = m.Rotation
 	}
 	return nil
 }
@@ -3,14 +3,22 @@ package files
 import (
 	"context"
 	"errors"
+	"fmt"
 	"io/fs"
+	"os"
 	"path"
+	"path/filepath"
 	"reflect"
+	"sort"
+	"sync/atomic"
 	"testing"
+	"time"
 
 	"github.com/kr/pretty"
 	"github.com/psanford/memfs"
+	"github.com/simulot/immich-go/browser"
 	"github.com/simulot/immich-go/helpers/fileevent"
+	"github.com/simulot/immich-go/helpers/fshelper"
 	"github.com/simulot/immich-go/helpers/namematcher"
 	"github.com/simulot/immich-go/immich"
 )
@@ -99,6 +107,18 @@ func TestLocalAssets(t *testing.T) {
 				"video_01.mp4":   {video: "video_01.mp4", sidecar: "video_01.mp4.XMP"},
 			},
 		},
+		{
+			name: "two videos",
+			fsys: newInMemFS().
+				addFile("IMG_0002.jpg").
+				addFile("IMG_0002.MOV").
+				addFile("IMG_0002.MP4").
+				addFile("IMG_0002.XMP"),
+			expected: map[string]fileLinks{
+				"IMG_0002.jpg": {image: "IMG_0002.jpg", video: "IMG_0002.MOV", sidecar: "IMG_0002.XMP"},
+				"IMG_0002.MP4": {video: "IMG_0002.MP4"},
+			},
+		},
 	}
 
 	for _, c := range tc {
@@ -148,3 +168,258 @@ func TestLocalAssets(t *testing.T) {
 		})
 	}
 }
+
+func TestBrowseWorkers(t *testing.T) {
+	fsys := newInMemFS()
+	want := []string{}
+	for i := 0; i < 200; i++ {
+		name := fmt.Sprintf("folder%d/IMG_%04d.jpg", i%3, i)
+		fsys.addFile(name)
+		want = append(want, name)
+	}
+	sort.Strings(want)
+
+	for _, order := range []browser.Order{browser.OrderNone, browser.OrderAny, browser.OrderSizeAsc} {
+		t.Run(string(order), func(t *testing.T) {
+			ctx := context.Background()
+			b, err := NewLocalFiles(ctx, fileevent.NewRecorder(nil, false), fsys)
+			if err != nil {
+				t.Fatal(err)
+			}
+			b.SetWorkers(8).SetOrder(order)
+			err = b.Prepare(ctx)
+			if err != nil {
+				t.Fatal(err)
+			}
+			got := []string{}
+			for a := range b.Browse(ctx) {
+				got = append(got, a.FileName)
+				a.Close()
+			}
+			if order == browser.OrderAny {
+				sort.Strings(got)
+			} else if order == browser.OrderSizeAsc {
+				// the files have the size of their name
+				sort.SliceStable(got, func(i, j int) bool { return len(got[i]) < len(got[j]) })
+			}
+			if !reflect.DeepEqual(got, want) {
+				t.Errorf("expecting all the files in order, got %d files", len(got))
+				pretty.Ldiff(t, want, got)
+			}
+		})
+	}
+}
+
+func TestBrowseCancel(t *testing.T) {
+	fsys := newInMemFS()
+	for i := 0; i < 100; i++ {
+		fsys.addFile(fmt.Sprintf("IMG_%04d.jpg", i))
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	b, err := NewLocalFiles(ctx, fileevent.NewRecorder(nil, false), fsys)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = b.Prepare(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assets := b.Browse(ctx)
+	a := <-assets
+	a.Close()
+	cancel()
+
+	done := make(chan struct{})
+	go func() {
+		for a := range assets {
+			a.Close()
+		}
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("the browsing should stop when the context is cancelled")
+	}
+}
+
+// openCounter counts the files left open
+type openCounter struct {
+	fs.FS
+	open atomic.Int64
+}
+
+type countedFile struct {
+	fs.File
+	fsys *openCounter
+}
+
+func (fsys *openCounter) Open(name string) (fs.File, error) {
+	f, err := fsys.FS.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	fsys.open.Add(1)
+	return &countedFile{File: f, fsys: fsys}, nil
+}
+
+func (fsys *openCounter) ReadDir(name string) ([]fs.DirEntry, error) {
+	return fs.ReadDir(fsys.FS, name)
+}
+
+func (f *countedFile) Close() error {
+	f.fsys.open.Add(-1)
+	return f.File.Close()
+}
+
+func TestBrowseCancelClosesAssets(t *testing.T) {
+	for _, order := range []browser.Order{browser.OrderNone, browser.OrderAny, browser.OrderNewest} {
+		t.Run(fmt.Sprintf("order %q", order), func(t *testing.T) {
+			mfs := newInMemFS()
+			for i := 0; i < 200; i++ {
+				// without date in the name, the file is read and stays open until its asset is closed
+				mfs.addFile(fmt.Sprintf("photo_%04d.jpg", i))
+			}
+			if mfs.err != nil {
+				t.Fatal(mfs.err)
+			}
+			fsys := &openCounter{FS: mfs}
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+			b, err := NewLocalFiles(ctx, fileevent.NewRecorder(nil, false), fsys)
+			if err != nil {
+				t.Fatal(err)
+			}
+			b.SetOrder(order)
+			err = b.Prepare(ctx)
+			if err != nil {
+				t.Fatal(err)
+			}
+			assets := b.Browse(ctx)
+			for i := 0; i < 3; i++ {
+				a := <-assets
+				a.Close()
+			}
+			cancel()
+
+			done := make(chan struct{})
+			go func() {
+				for a := range assets {
+					a.Close()
+				}
+				close(done)
+			}()
+			select {
+			case <-done:
+			case <-time.After(5 * time.Second):
+				t.Fatal("the browsing should stop when the context is cancelled")
+			}
+			if n := fsys.open.Load(); n != 0 {
+				t.Errorf("%d files are left open after the cancellation", n)
+			}
+		})
+	}
+}
+
+func TestBrowseHardLinks(t *testing.T) {
+	dir := t.TempDir()
+	for _, d := range []string{"A", "B"} {
+		if err := os.Mkdir(filepath.Join(dir, d), 0o755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for _, f := range []string{"A/IMG_20230102_120000.jpg", "A/IMG_20230103_120000.jpg"} {
+		if err := os.WriteFile(filepath.Join(dir, f), []byte(f), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := os.Link(filepath.Join(dir, "A/IMG_20230102_120000.jpg"), filepath.Join(dir, "B/IMG_20230102_120000.jpg")); err != nil {
+		t.Skip("hard links not supported:", err)
+	}
+	fsys := os.DirFS(dir)
+	if info, err := fs.Stat(fsys, "B/IMG_20230102_120000.jpg"); err != nil {
+		t.Fatal(err)
+	} else if _, ok := fshelper.FileIDOf(info); !ok {
+		t.Skip("files can't be identified on this OS")
+	}
+
+	ctx := context.Background()
+	b, err := NewLocalFiles(ctx, fileevent.NewRecorder(nil, false), fsys)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = b.Prepare(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := map[string][]string{}
+	for a := range b.Browse(ctx) {
+		links := []string{}
+		for _, l := range a.Links {
+			links = append(links, l.FileName)
+		}
+		got[a.FileName] = links
+		a.Close()
+	}
+	want := map[string][]string{
+		"A/IMG_20230102_120000.jpg": {"B/IMG_20230102_120000.jpg"},
+		"A/IMG_20230103_120000.jpg": {},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("expecting the hard link processed once")
+		pretty.Ldiff(t, want, got)
+	}
+}
+
+func TestBrowseHardLinksAlbums(t *testing.T) {
+	dir := t.TempDir()
+	files := map[string]string{
+		"A/IMG_20230102_120000.jpg":     "image",
+		"B/album.json":                  `{"title":"Holidays"}`,
+		"B/IMG_20230102_120000.jpg.xmp": "xmp",
+	}
+	for name, content := range files {
+		name = filepath.Join(dir, name)
+		err := os.MkdirAll(filepath.Dir(name), 0o755)
+		if err == nil {
+			err = os.WriteFile(name, []byte(content), 0o644)
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := os.Link(filepath.Join(dir, "A/IMG_20230102_120000.jpg"), filepath.Join(dir, "B/IMG_20230102_120000.jpg")); err != nil {
+		t.Skip("hard links not supported:", err)
+	}
+	fsys := os.DirFS(dir)
+	if info, err := fs.Stat(fsys, "B/IMG_20230102_120000.jpg"); err != nil {
+		t.Fatal(err)
+	} else if _, ok := fshelper.FileIDOf(info); !ok {
+		t.Skip("files can't be identified on this OS")
+	}
+
+	ctx := context.Background()
+	b, err := NewLocalFiles(ctx, fileevent.NewRecorder(nil, false), fsys)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = b.Prepare(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	n := 0
+	for a := range b.Browse(ctx) {
+		n++
+		want := []browser.LocalAlbum{{Path: "B", Title: "Holidays"}}
+		if !reflect.DeepEqual(a.Albums, want) {
+			t.Errorf("expecting the album of the other path %v, got %v", want, a.Albums)
+		}
+		if a.SideCar.FileName != "B/IMG_20230102_120000.jpg.xmp" {
+			t.Errorf("expecting the sidecar of the other path, got %q", a.SideCar.FileName)
+		}
+		a.Close()
+	}
+	if n != 1 {
+		t.Errorf("expecting one asset, got %d", n)
+	}
+}
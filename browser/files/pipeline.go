@@ -0,0 +1,111 @@
+package files
+
+import (
+	"context"
+	"io/fs"
+	"runtime"
+
+	"github.com/simulot/immich-go/browser"
+	"golang.org/x/sync/errgroup"
+)
+
+// defaultWorkers is the number of files read at the same time to get their metadata
+var defaultWorkers = min(runtime.NumCPU(), 8)
+
+// linkedJob is a group of linked files to be turned into an asset
+type linkedJob struct {
+	fsys   fs.FS
+	linked fileLinks
+	asset  chan *browser.LocalAssetFile // receives the asset, nil on error
+}
+
+// makeAssets makes the assets of the linked files given by produce with a pool of workers.
+//
+// The assets are emitted in the order of production, unless the order is browser.OrderAny:
+// they are emitted as soon as they are ready.
+// The number of assets in progress is bounded, the memory doesn't depend on the size of the folders.
+func (la *LocalAssetBrowser) makeAssets(ctx context.Context, fileChan chan *browser.LocalAssetFile, produce func(add func(fsys fs.FS, linked fileLinks) error) error) error {
+	workers := max(la.workers, 1)
+	ordered := la.order != browser.OrderAny
+
+	grp, gctx := errgroup.WithContext(ctx)
+	jobs := make(chan linkedJob)
+	pending := make(chan linkedJob, 2*workers) // jobs waiting for their emission, in order
+
+	grp.Go(func() error {
+		defer close(pending)
+		defer close(jobs)
+		return produce(func(fsys fs.FS, linked fileLinks) error {
+			j := linkedJob{fsys: fsys, linked: linked, asset: make(chan *browser.LocalAssetFile, 1)}
+			if ordered {
+				// the job takes its place in the emission order before being given to a worker
+				select {
+				case <-gctx.Done():
+					return gctx.Err()
+				case pending <- j:
+				}
+			}
+			select {
+			case <-gctx.Done():
+				// no worker makes the asset, the emitter doesn't wait for it
+				j.asset <- nil
+				return gctx.Err()
+			case jobs <- j:
+			}
+			return nil
+		})
+	})
+
+	for i := 0; i < workers; i++ {
+		grp.Go(func() error {
+			for j := range jobs {
+				var a *browser.LocalAssetFile
+				if gctx.Err() == nil {
+					a, _ = la.assetFromLinks(gctx, j.fsys, j.linked)
+				}
+				if ordered {
+					j.asset <- a
+					continue
+				}
+				if a != nil {
+					la.emit(gctx, fileChan, a)
+				}
+			}
+			return nil
+		})
+	}
+
+	if ordered {
+		grp.Go(func() error {
+			// each pending job gets its asset, or nil when it's cancelled before reaching a worker.
+			// The assets made after the cancellation are closed by emit.
+			for j := range pending {
+				if a := <-j.asset; a != nil {
+					la.emit(gctx, fileChan, a)
+				}
+			}
+			return nil
+		})
+	}
+	return grp.Wait()
+}
+
+// emit gives the asset to the consumer, or closes it when the browsing is cancelled
+func (la *LocalAssetBrowser) emit(ctx context.Context, fileChan chan *browser.LocalAssetFile, a *browser.LocalAssetFile) {
+	if ctx.Err() != nil {
+		closeAsset(a)
+		return
+	}
+	select {
+	case <-ctx.Done():
+		closeAsset(a)
+	case fileChan <- a:
+	}
+}
+
+func closeAsset(a *browser.LocalAssetFile) {
+	a.Close()
+	if a.LivePhoto != nil {
+		a.LivePhoto.Close()
+	}
+}
@@ -2,18 +2,22 @@ package gp
 
 import (
 	"context"
+	"encoding/json"
 	"io/fs"
 	"path"
 	"path/filepath"
 	"sort"
 	"strings"
+	"time"
 	"unicode/utf8"
 
 	"github.com/simulot/immich-go/browser"
+	"github.com/simulot/immich-go/helpers/extsort"
 	"github.com/simulot/immich-go/helpers/fileevent"
 	"github.com/simulot/immich-go/helpers/fshelper"
 	"github.com/simulot/immich-go/helpers/gen"
 	"github.com/simulot/immich-go/helpers/namematcher"
+	"github.com/simulot/immich-go/helpers/namenorm"
 	"github.com/simulot/immich-go/immich"
 	"github.com/simulot/immich-go/immich/metadata"
 )
@@ -27,6 +31,9 @@ type Takeout struct {
 
 	banned            namematcher.List // Banned files
 	acceptMissingJSON bool
+	quarantine        browser.Quarantine  // receives unsupported, failed and unmatched files
+	order             browser.Order       // order of the assets
+	names             namenorm.Normalizer // compares the names of the JSONs and the files
 }
 
 // directoryCatalog captures all files in a given directory
@@ -66,9 +73,37 @@ func (to *Takeout) SetAcceptMissingJSON(flag bool) *Takeout {
 	return to
 }
 
+func (to *Takeout) SetQuarantine(q browser.Quarantine) *Takeout {
+	to.quarantine = q
+	return to
+}
+
+// putInQuarantine copies the file in the quarantine folder, when any
+func (to *Takeout) putInQuarantine(ctx context.Context, fsys fs.FS, name string, reason string, companions ...metadata.SideCarFile) {
+	if to.quarantine == nil {
+		return
+	}
+	err := to.quarantine.Put(ctx, fsys, name, reason, companions...)
+	if err != nil {
+		to.log.Record(ctx, fileevent.Error, nil, name, "error", "can't copy the file in the quarantine: "+err.Error())
+	}
+}
+
+// SetNameNormalizer sets how the names of the JSONs and the files are compared
+func (to *Takeout) SetNameNormalizer(n namenorm.Normalizer) *Takeout {
+	to.names = n
+	return to
+}
+
 // Prepare scans all files in all walker to build the file catalog of the archive
 // metadata files content is read and kept
 
+// SetOrder sets the order of the assets given by Browse
+func (to *Takeout) SetOrder(order browser.Order) *Takeout {
+	to.order = order
+	return to
+}
+
 func (to *Takeout) Prepare(ctx context.Context) error {
 	for _, w := range to.fsyss {
 		err := to.passOneFsWalk(ctx, w)
@@ -122,6 +157,7 @@ func (to *Takeout) passOneFsWalk(ctx context.Context, w fs.FS) error {
 					switch {
 					case md.isAsset():
 						md.foundInPaths = append(md.foundInPaths, dir)
+						md.jsonFile = metadata.SideCarFile{FSys: w, FileName: name}
 						dirCatalog.jsons[base] = md
 						to.log.Record(ctx, fileevent.DiscoveredSidecar, nil, name, "type", "asset metadata", "title", md.Title)
 					case md.isAlbum():
@@ -137,10 +173,12 @@ func (to *Takeout) passOneFsWalk(ctx context.Context, w fs.FS) error {
 						to.log.Record(ctx, fileevent.DiscoveredSidecar, nil, name, "type", "album metadata", "title", md.Title)
 					default:
 						to.log.Record(ctx, fileevent.DiscoveredUnsupported, nil, name, "reason", "unknown JSONfile")
+						to.putInQuarantine(ctx, w, name, "unknown JSON file")
 						return nil
 					}
 				} else {
 					to.log.Record(ctx, fileevent.DiscoveredUnsupported, nil, name, "reason", "unknown JSONfile")
+					to.putInQuarantine(ctx, w, name, "unknown JSON file: "+err.Error())
 					return nil
 				}
 			default:
@@ -148,11 +186,13 @@ func (to *Takeout) passOneFsWalk(ctx context.Context, w fs.FS) error {
 				switch t {
 				case immich.TypeUnknown:
 					to.log.Record(ctx, fileevent.DiscoveredUnsupported, nil, name, "reason", "unsupported file type")
+					to.putInQuarantine(ctx, w, name, "unsupported file type")
 					return nil
 				case immich.TypeVideo:
 					to.log.Record(ctx, fileevent.DiscoveredVideo, nil, name)
 					if strings.Contains(name, "Failed Videos") {
 						to.log.Record(ctx, fileevent.DiscoveredDiscarded, nil, name, "reason", "can't upload failed videos")
+						to.putInQuarantine(ctx, w, name, "video marked as failed by Google Photos")
 						return nil
 					}
 				case immich.TypeImage:
@@ -228,6 +268,16 @@ func (to *Takeout) solvePuzzle(ctx context.Context) error {
 		cat := to.catalogs[dir]
 		jsons := gen.MapKeys(cat.jsons)
 		sort.Strings(jsons)
+
+		// the matchers compare the normalized names
+		keys := map[string]string{}
+		for _, json := range jsons {
+			keys[json] = to.names.Key(json)
+		}
+		for f := range cat.unMatchedFiles {
+			keys[f] = to.names.Key(f)
+		}
+
 		for _, matcher := range matchers {
 			for _, json := range jsons {
 				md := cat.jsons[json]
@@ -236,7 +286,7 @@ func (to *Takeout) solvePuzzle(ctx context.Context) error {
 					case <-ctx.Done():
 						return ctx.Err()
 					default:
-						if matcher.fn(json, f, to.sm) {
+						if matcher.fn(keys[json], keys[f], to.sm) {
 							i := cat.unMatchedFiles[f]
 							i.md = md
 							cat.matchedFiles[f] = i
@@ -256,6 +306,8 @@ func (to *Takeout) solvePuzzle(ctx context.Context) error {
 				cat.matchedFiles[f] = cat.unMatchedFiles[f]
 				delete(cat.unMatchedFiles, f)
 			} else {
+				i := cat.unMatchedFiles[f]
+				to.putInQuarantine(ctx, i.fsys, path.Join(dir, f), "no JSON file matches this file")
 			}
 		}
 	}
@@ -464,6 +516,13 @@ func (to *Takeout) Browse(ctx context.Context) chan *browser.LocalAssetFile {
 
 	go func() {
 		defer close(assetChan)
+		if to.order.Sorted() {
+			err := to.browseOrdered(ctx, assetChan)
+			if err != nil && ctx.Err() == nil {
+				assetChan <- &browser.LocalAssetFile{Err: err}
+			}
+			return
+		}
 		dirs := gen.MapKeys(to.catalogs)
 		sort.Strings(dirs)
 		for _, dir := range dirs {
@@ -478,16 +537,19 @@ func (to *Takeout) Browse(ctx context.Context) chan *browser.LocalAssetFile {
 	return assetChan
 }
 
+// linkedFiles associates the image and the video of a live photo
+type linkedFiles struct {
+	video *assetFile
+	image *assetFile
+}
+
 // detect livephotos and motion pictures
 // 1. get all pictures
 // 2. scan vidoes, if a picture matches, this is a live photo
-func (to *Takeout) passTwo(ctx context.Context, dir string, assetChan chan *browser.LocalAssetFile) error {
+func (to *Takeout) linkFiles(dir string) map[string]linkedFiles {
 	catalog := to.catalogs[dir]
 
-	linkedFiles := map[string]struct {
-		video *assetFile
-		image *assetFile
-	}{}
+	linkedFiles := map[string]linkedFiles{}
 
 	// Scan pictures
 	for _, f := range gen.MapKeys(catalog.matchedFiles) {
@@ -533,42 +595,145 @@ nextVideo:
 			linkedFiles[f] = linked
 		}
 	}
+	return linkedFiles
+}
 
+func (to *Takeout) passTwo(ctx context.Context, dir string, assetChan chan *browser.LocalAssetFile) error {
+	linkedFiles := to.linkFiles(dir)
 	for _, base := range gen.MapKeys(linkedFiles) {
-		var a *browser.LocalAssetFile
-		var err error
+		a := to.assetFromLinks(ctx, dir, linkedFiles[base])
+		if a == nil {
+			continue
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		default:
+			assetChan <- a
+		}
+	}
+	return nil
+}
 
-		linked := linkedFiles[base]
+// assetFromLinks makes the asset of the linked files, errors are recorded
+func (to *Takeout) assetFromLinks(ctx context.Context, dir string, linked linkedFiles) *browser.LocalAssetFile {
+	var a *browser.LocalAssetFile
+	var err error
 
-		if linked.image != nil {
-			a, err = to.makeAsset(linked.image.md, linked.image.fsys, path.Join(dir, linked.image.base))
+	if linked.image != nil {
+		a, err = to.makeAsset(linked.image.md, linked.image.fsys, path.Join(dir, linked.image.base))
+		if err != nil {
+			to.log.Record(ctx, fileevent.Error, nil, path.Join(dir, linked.image.base), "error", err.Error())
+			return nil
+		}
+		if linked.video != nil {
+			i, err := to.makeAsset(linked.video.md, linked.video.fsys, path.Join(dir, linked.video.base))
 			if err != nil {
-				to.log.Record(ctx, fileevent.Error, nil, path.Join(dir, linked.image.base), "error", err.Error())
-				continue
+				to.log.Record(ctx, fileevent.Error, nil, path.Join(dir, linked.video.base), "error", err.Error())
+			} else {
+				a.LivePhoto = i
 			}
-			if linked.video != nil {
-				i, err := to.makeAsset(linked.video.md, linked.video.fsys, path.Join(dir, linked.video.base))
-				if err != nil {
-					to.log.Record(ctx, fileevent.Error, nil, path.Join(dir, linked.video.base), "error", err.Error())
-				} else {
-					a.LivePhoto = i
+		}
+	} else {
+		a, err = to.makeAsset(linked.video.md, linked.video.fsys, path.Join(dir, linked.video.base))
+		if err != nil {
+			to.log.Record(ctx, fileevent.Error, nil, path.Join(dir, linked.video.base), "error", err.Error())
+			return nil
+		}
+	}
+	return a
+}
+
+// plannedFiles is the entry of the sorted plan, it refers to the matched files of a folder
+type plannedFiles struct {
+	Dir   string `json:"dir"`
+	Image string `json:"image,omitempty"`
+	Video string `json:"video,omitempty"`
+}
+
+// browseOrdered sorts the linked files before making the assets.
+// The date of the files is the capture date given by the JSON.
+func (to *Takeout) browseOrdered(ctx context.Context, assetChan chan *browser.LocalAssetFile) error {
+	plan := extsort.New(extsort.DefaultChunkSize)
+	defer plan.Close()
+
+	dirs := gen.MapKeys(to.catalogs)
+	sort.Strings(dirs)
+	for _, dir := range dirs {
+		matched := to.catalogs[dir].matchedFiles
+		if len(matched) == 0 {
+			continue
+		}
+		album := to.albums[dir].Title
+		keys := map[*assetFile]string{}
+		for k, f := range matched {
+			keys[f] = k
+		}
+		linkedFiles := to.linkFiles(dir)
+		bases := gen.MapKeys(linkedFiles)
+		sort.Strings(bases)
+		for _, base := range bases {
+			if err := ctx.Err(); err != nil {
+				return err
+			}
+			linked := linkedFiles[base]
+			p := plannedFiles{Dir: dir}
+			var date time.Time
+			var size int64
+			for _, f := range []*assetFile{linked.video, linked.image} {
+				if f == nil {
+					continue
+				}
+				if f.md != nil {
+					date = f.md.PhotoTakenTime.Time()
 				}
+				size += int64(f.length)
+			}
+			if linked.image != nil {
+				p.Image = keys[linked.image]
 			}
-		} else {
-			a, err = to.makeAsset(linked.video.md, linked.video.fsys, path.Join(dir, linked.video.base))
+			if linked.video != nil {
+				p.Video = keys[linked.video]
+			}
+			v, err := json.Marshal(p)
 			if err != nil {
-				to.log.Record(ctx, fileevent.Error, nil, path.Join(dir, linked.video.base), "error", err.Error())
-				continue
+				return err
+			}
+			err = plan.Add(to.order.Key(date, album, size, path.Join(dir, base)), v)
+			if err != nil {
+				return err
 			}
 		}
+	}
+
+	return plan.Sort(func(e extsort.Entry) error {
+		var p plannedFiles
+		err := json.Unmarshal(e.Value, &p)
+		if err != nil {
+			return err
+		}
+		matched := to.catalogs[p.Dir].matchedFiles
+		linked := linkedFiles{}
+		if p.Image != "" {
+			linked.image = matched[p.Image]
+		}
+		if p.Video != "" {
+			linked.video = matched[p.Video]
+		}
+		if linked.image == nil && linked.video == nil {
+			return nil
+		}
+		a := to.assetFromLinks(ctx, p.Dir, linked)
+		if a == nil {
+			return nil
+		}
 		select {
 		case <-ctx.Done():
 			return ctx.Err()
-		default:
-			assetChan <- a
+		case assetChan <- a:
 		}
-	}
-	return nil
+		return nil
+	})
 }
 
 // makeAsset makes a localAssetFile based on the google metadata
@@ -578,9 +743,14 @@ func (to *Takeout) makeAsset(md *GoogleMetaData, fsys fs.FS, name string) (*brow
 		return nil, err
 	}
 
+	return to.describeAsset(md, fsys, name, int(i.Size())), nil
+}
+
+// describeAsset gives the asset described by the takeout, without reading the file
+func (to *Takeout) describeAsset(md *GoogleMetaData, fsys fs.FS, name string, size int) *browser.LocalAssetFile {
 	a := browser.LocalAssetFile{
 		FileName: name,
-		FileSize: int(i.Size()),
+		FileSize: size,
 		Title:    path.Base(name),
 		FSys:     fsys,
 	}
@@ -590,23 +760,12 @@ func (to *Takeout) makeAsset(md *GoogleMetaData, fsys fs.FS, name string) (*brow
 	}
 
 	if md != nil {
-		// Change file's title with the asset's title and the actual file's extension
-		title := md.Title
-		titleExt := path.Ext(title)
-		fileExt := path.Ext(name)
-
-		if titleExt != fileExt {
-			title = strings.TrimSuffix(title, titleExt)
-			titleExt = path.Ext(title)
-			if titleExt != fileExt {
-				title = strings.TrimSuffix(title, titleExt) + fileExt
-			}
-		}
-		a.Title = title
+		a.Title = assetTitle(md, name)
 		a.Archived = md.Archived
 		a.FromPartner = md.isPartner()
 		a.Trashed = md.Trashed
 		a.Favorite = md.Favorited
+		a.JSONFile = md.jsonFile
 
 		// Prepare sidecar data to force Immich with Google metadata
 
@@ -634,6 +793,49 @@ func (to *Takeout) makeAsset(md *GoogleMetaData, fsys fs.FS, name string) (*brow
 		}
 		a.Metadata = sidecar
 	}
+	return &a
+}
+
+// assetTitle gives the file's title with the asset's title and the actual file's extension
+func assetTitle(md *GoogleMetaData, name string) string {
+	if md == nil {
+		return path.Base(name)
+	}
+	title := md.Title
+	titleExt := path.Ext(title)
+	fileExt := path.Ext(name)
 
-	return &a, nil
+	if titleExt != fileExt {
+		title = strings.TrimSuffix(title, titleExt)
+		titleExt = path.Ext(title)
+		if titleExt != fileExt {
+			title = strings.TrimSuffix(title, titleExt) + fileExt
+		}
+	}
+	return title
+}
+
+// Inventory enumerates the files matched during the puzzle resolution
+func (to *Takeout) Inventory(ctx context.Context, fn func(*browser.LocalAssetFile) error) error {
+	dirs := gen.MapKeys(to.catalogs)
+	sort.Strings(dirs)
+	for _, dir := range dirs {
+		files := to.catalogs[dir].matchedFiles
+		names := gen.MapKeys(files)
+		sort.Strings(names)
+		for _, n := range names {
+			select {
+			case <-ctx.Done():
+				return ctx.Err()
+			default:
+			}
+			f := files[n]
+			name := path.Join(dir, f.base)
+			err := fn(to.describeAsset(f.md, f.fsys, name, f.length))
+			if err != nil {
+				return err
+			}
+		}
+	}
+	return nil
 }
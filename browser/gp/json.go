@@ -7,6 +7,7 @@ import (
 	"time"
 
 	"github.com/simulot/immich-go/helpers/tzone"
+	"github.com/simulot/immich-go/immich/metadata"
 )
 
 type Metablock struct {
@@ -31,7 +32,8 @@ type GoogleMetaData struct {
 	} `json:"googlePhotosOrigin"`
 	AlbumData *Metablock `json:"albumdata"`
 	// Not in the JSON, for local treatment
-	foundInPaths []string //  keep track of paths where the json has been found
+	foundInPaths []string             //  keep track of paths where the json has been found
+	jsonFile     metadata.SideCarFile // the JSON file itself
 }
 
 func (gmd *GoogleMetaData) UnmarshalJSON(data []byte) error {
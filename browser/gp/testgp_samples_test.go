@@ -184,6 +184,13 @@ func imagesEditedJSON() []fs.FS {
 		addImage("Photos from 2023/PXL_20220405_090200110.PORTRAIT-modifié.jpg", 12).FSs()
 }
 
+// namesNFD has files named in the NFD form by macOS, and JSONs named in the NFC form
+func namesNFD() []fs.FS {
+	return newInMemFS().
+		addJSONImage("Photos from 2023/Crème brûlée.jpg.json", "Crème brûlée.jpg").
+		addImage("Photos from 2023/Cre\u0300me bru\u0302le\u0301e.jpg", 10).FSs()
+}
+
 func titlesWithForbiddenChars() []fs.FS {
 	return newInMemFS().
 		addJSONImage("Photos from 2012/27_06_12 - 1.mov.json", "27/06/12 - 1", takenTime("20120627")).
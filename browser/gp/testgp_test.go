@@ -73,6 +73,13 @@ func TestBrowse(t *testing.T) {
 			}),
 		},
 
+		{
+			"namesNFD", namesNFD,
+			sortFileResult([]fileResult{
+				{name: "Cre\u0300me bru\u0302le\u0301e.jpg", size: 10, title: "Crème brûlée.jpg"},
+			}),
+		},
+
 		{
 			"titlesWithForbiddenChars", titlesWithForbiddenChars,
 			sortFileResult([]fileResult{
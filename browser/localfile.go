@@ -1,11 +1,12 @@
 package browser
 
 import (
-	"errors"
+	"crypto/sha1"
+	"encoding/base64"
 	"fmt"
 	"io"
 	"io/fs"
-	"os"
+	"path"
 	"time"
 
 	"github.com/simulot/immich-go/helpers/fshelper"
@@ -33,6 +34,7 @@ type LocalAssetFile struct {
 	Albums   []LocalAlbum         // The asset's album, if any
 	Err      error                // keep errors encountered
 	SideCar  metadata.SideCarFile // sidecar file if found
+	JSONFile metadata.SideCarFile // Google Photos JSON file, if any
 	Metadata metadata.Metadata    // Metadata fields
 
 	// Google Photos flags
@@ -45,14 +47,21 @@ type LocalAssetFile struct {
 	LivePhoto   *LocalAssetFile // Local asset of the movie part
 	LivePhotoID string          // ID of the movie part, just uploaded
 
-	FSys     fs.FS // Asset's file system
-	FileSize int   // File size in bytes
+	FSys     fs.FS      // Asset's file system
+	Links    []FileLink // Other paths of the same file, like hard links or bind mounts
+	FileSize int        // File size in bytes
+	Checksum string     // SHA1 of the content in base64, like the server's checksum. Set by ComputeChecksum
+	DeviceID string     // Device of the asset, the client's one when empty
 
 	// buffer management
-	sourceFile fs.File   // the opened source file
-	tempFile   *os.File  // buffer that keep partial reads available for the full file reading
-	teeReader  io.Reader // write each read from it into the tempWriter
-	reader     io.Reader // the reader that combines the partial read and original file for full file reading
+	cache  *sourceCache // replays the bytes already read
+	reader io.Reader    // the reader of the full file, given by Open
+}
+
+// FileLink is a path of a file in a file system
+type FileLink struct {
+	FSys     fs.FS
+	FileName string
 }
 
 func (l LocalAssetFile) DebugObject() any {
@@ -77,57 +86,89 @@ func (l *LocalAssetFile) Remove() error {
 	return nil
 }
 
+// ContentIDPrefix starts the device asset IDs derived from the content
+const ContentIDPrefix = "sha1:"
+
+// DeviceAssetID identifies the asset on the device.
+// It's derived from the content when the checksum is known, from the title and the size otherwise.
 func (l *LocalAssetFile) DeviceAssetID() string {
+	if l.Checksum != "" {
+		return ContentIDPrefix + l.Checksum
+	}
+	return l.LegacyDeviceAssetID()
+}
+
+// LegacyDeviceAssetID is the device asset ID based on the title and the size
+func (l *LocalAssetFile) LegacyDeviceAssetID() string {
 	return fmt.Sprintf("%s-%d", l.Title, l.FileSize)
 }
 
+// ComputeChecksum reads the whole file to get its checksum.
+// The first bytes are kept for the upload.
+func (l *LocalAssetFile) ComputeChecksum() error {
+	if l.Checksum != "" {
+		return nil
+	}
+	r, err := l.PartialSourceReader()
+	if err != nil {
+		return err
+	}
+	h := sha1.New()
+	_, err = io.Copy(h, r)
+	if err != nil {
+		return err
+	}
+	l.Checksum = base64.StdEncoding.EncodeToString(h.Sum(nil))
+	return nil
+}
+
+// ReadVideoMetadata reads the duration and the rotation of a video.
+// The duration is sent with the upload, since the server can't read the metadata of all the video formats.
+//
+// The boxes are searched in the first bytes only, they are kept in memory for the upload.
+// The metadata of a video having them at its end are not read.
+func (l *LocalAssetFile) ReadVideoMetadata() error {
+	r, err := l.PartialSourceReader()
+	if err != nil {
+		return err
+	}
+	m, err := metadata.GetFromReader(io.LimitReader(r, int64(HeaderBufferSize)), path.Ext(l.FileName))
+	if err != nil {
+		return err
+	}
+	l.Metadata.Duration = m.Duration
+	l.Metadata.Rotation = m.Rotation
+	if l.Metadata.Width == 0 {
+		l.Metadata.Width, l.Metadata.Height = m.Width, m.Height
+	}
+	return nil
+}
+
 // PartialSourceReader open a reader on the current asset.
-// each byte read from it is saved into a temporary file.
+// The bytes read from it are kept to be read again by the next readers, and by the upload.
 //
-// It returns a TeeReader that writes each read byte from the source into the temporary file.
-// The temporary file is discarded when the LocalAssetFile is closed
+// The first bytes are kept in memory, the next ones of an archive's file in a temporary file.
+// Other files are opened again from their file system to read the next bytes.
+// The cache is discarded when the LocalAssetFile is closed
 
 func (l *LocalAssetFile) PartialSourceReader() (reader io.Reader, err error) {
-	if l.sourceFile == nil {
-		l.sourceFile, err = l.FSys.Open(l.FileName)
-		if err != nil {
-			return nil, err
-		}
-	}
-	if l.tempFile == nil {
-		l.tempFile, err = os.CreateTemp("", "immich-go_*.tmp")
-		if err != nil {
-			return nil, err
-		}
-		if l.teeReader == nil {
-			l.teeReader = io.TeeReader(l.sourceFile, l.tempFile)
-		}
+	if l.cache == nil {
+		l.cache = newSourceCache(l.FSys, l.FileName)
 	}
-	_, err = l.tempFile.Seek(0, 0)
-	if err != nil {
-		return nil, err
-	}
-	return io.MultiReader(l.tempFile, l.teeReader), nil
+	return l.cache.reader(true), nil
 }
 
 // Open return fs.File that reads previously read bytes followed by the actual file content.
 func (l *LocalAssetFile) Open() (fs.File, error) {
-	var err error
-	if l.sourceFile == nil {
-		l.sourceFile, err = l.FSys.Open(l.FileName)
-		if err != nil {
-			return nil, err
-		}
+	if l.cache == nil {
+		l.cache = newSourceCache(l.FSys, l.FileName)
 	}
-	if l.tempFile != nil {
-		_, err = l.tempFile.Seek(0, 0)
-		if err != nil {
-			return nil, err
-		}
-		l.reader = io.MultiReader(l.tempFile, l.sourceFile)
-	} else {
-		l.reader = l.sourceFile
+	// the source is opened now to report the errors
+	err := l.cache.seekSource(l.cache.cached())
+	if err != nil {
+		return nil, err
 	}
+	l.reader = l.cache.reader(false)
 	return l, nil
 }
 
@@ -136,18 +177,12 @@ func (l *LocalAssetFile) Read(b []byte) (int, error) {
 	return l.reader.Read(b)
 }
 
-// Close close the temporary file  and close the source
+// Close discards the cache and close the source
 func (l *LocalAssetFile) Close() error {
 	var err error
-	if l.sourceFile != nil {
-		err = errors.Join(err, l.sourceFile.Close())
-		l.sourceFile = nil
-	}
-	if l.tempFile != nil {
-		f := l.tempFile.Name()
-		err = errors.Join(err, l.tempFile.Close())
-		err = errors.Join(err, os.Remove(f))
-		l.tempFile = nil
+	if l.cache != nil {
+		err = l.cache.Close()
+		l.cache = nil
 	}
 	return err
 }
@@ -0,0 +1,50 @@
+package browser
+
+import (
+	"fmt"
+	"math"
+	"time"
+)
+
+// Order of the assets given by Browse
+type Order string
+
+const (
+	OrderNone     Order = ""          // the order of the folders
+	OrderNewest   Order = "NEWEST"    // the most recent captures first
+	OrderOldest   Order = "OLDEST"    // the oldest captures first
+	OrderAlbum    Order = "ALBUM"     // one album after the other
+	OrderSizeAsc  Order = "SIZE-ASC"  // the smallest files first
+	OrderSizeDesc Order = "SIZE-DESC" // the biggest files first
+	OrderAny      Order = "ANY"       // the assets as soon as they are read, the fastest
+)
+
+// Sorted tells if the assets must be sorted before being given
+func (o Order) Sorted() bool {
+	return o != OrderNone && o != OrderAny
+}
+
+// dateOffset keeps the dates' keys positive
+const dateOffset = 1 << 62
+
+// Key gives the sort key of an asset for the order.
+// The tie is appended to the key to keep the order of the folders for equal keys.
+// Assets without album are given after the albums with OrderAlbum.
+func (o Order) Key(date time.Time, album string, size int64, tie string) string {
+	switch o {
+	case OrderNewest:
+		return fmt.Sprintf("%020d|%s", dateOffset-date.Unix(), tie)
+	case OrderOldest:
+		return fmt.Sprintf("%020d|%s", dateOffset+date.Unix(), tie)
+	case OrderAlbum:
+		if album == "" {
+			return "1|" + tie
+		}
+		return "0|" + album + "\x00|" + tie
+	case OrderSizeAsc:
+		return fmt.Sprintf("%020d|%s", size, tie)
+	case OrderSizeDesc:
+		return fmt.Sprintf("%020d|%s", math.MaxInt64-size, tie)
+	}
+	return tie
+}
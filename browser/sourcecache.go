@@ -0,0 +1,213 @@
+package browser
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/simulot/immich-go/helpers/fshelper"
+)
+
+/*
+	The source cache keeps the bytes already read from an asset to replay them to the next readers.
+	The metadata are read from the beginning of the file, and the upload reads the whole file again.
+
+	The first bytes are kept in memory. The buffers are pooled as they are needed for each asset.
+	Beyond the memory buffer, a file that can seek is opened again from its file system to read the missing part.
+	The file of an archive can't seek: it would be decompressed again, the next bytes are written into a
+	temporary file instead, removed when the asset is closed.
+*/
+
+// HeaderBufferSize is the number of bytes of a file kept in memory
+var HeaderBufferSize = 4 * 1024 * 1024
+
+var headerPool = sync.Pool{
+	New: func() any {
+		return new(bytes.Buffer)
+	},
+}
+
+type sourceCache struct {
+	fsys fs.FS
+	name string
+
+	src    fs.File // the opened file
+	srcPos int64   // bytes read from src
+
+	head    *bytes.Buffer // first bytes of the file
+	spill   *os.File      // next bytes of a file that can't seek
+	spilled int64         // bytes written in the spill
+	noSpill bool          // the spill has failed, the file is read again
+}
+
+func newSourceCache(fsys fs.FS, name string) *sourceCache {
+	return &sourceCache{
+		fsys: fsys,
+		name: name,
+		head: headerPool.Get().(*bytes.Buffer),
+	}
+}
+
+// cached is the number of bytes that can be replayed
+func (c *sourceCache) cached() int64 {
+	return int64(c.head.Len()) + c.spilled
+}
+
+// reader gives a reader on the whole file.
+// The bytes read beyond the cache are kept when keep is true.
+func (c *sourceCache) reader(keep bool) io.Reader {
+	return &cacheReader{c: c, keep: keep}
+}
+
+// seekSource gives the file positioned at pos, it is opened again when it's beyond this position
+func (c *sourceCache) seekSource(pos int64) error {
+	if c.src != nil && c.srcPos == pos {
+		return nil
+	}
+	if c.src != nil {
+		err := c.src.Close()
+		c.src = nil
+		if err != nil {
+			return err
+		}
+	}
+	f, err := c.fsys.Open(c.name)
+	if err != nil {
+		return err
+	}
+	c.src, c.srcPos = f, 0
+	if pos == 0 {
+		return nil
+	}
+	if s, ok := f.(io.Seeker); ok {
+		_, err = s.Seek(pos, io.SeekStart)
+	} else {
+		_, err = io.CopyN(io.Discard, f, pos)
+	}
+	if err != nil {
+		return err
+	}
+	c.srcPos = pos
+	return nil
+}
+
+// keepBytes adds the bytes read at the end of the cache.
+// Past the size of the memory buffer, the bytes of a file that can't seek are written into the spill.
+func (c *sourceCache) keepBytes(b []byte) {
+	if room := HeaderBufferSize - c.head.Len(); room > 0 {
+		n := min(room, len(b))
+		c.head.Write(b[:n])
+		b = b[n:]
+	}
+	if len(b) == 0 || c.noSpill {
+		return
+	}
+	if _, ok := c.src.(io.Seeker); ok {
+		return
+	}
+	var err error
+	if c.spill == nil {
+		c.spill, err = os.CreateTemp("", fshelper.TempFilePattern)
+	}
+	if err == nil {
+		_, err = c.spill.Write(b)
+	}
+	if err != nil {
+		// the next readers read the file again
+		c.noSpill = true
+		_ = c.removeSpill()
+		return
+	}
+	c.spilled += int64(len(b))
+}
+
+// removeSpill closes and removes the temporary file
+func (c *sourceCache) removeSpill() error {
+	if c.spill == nil {
+		return nil
+	}
+	err := errors.Join(c.spill.Close(), os.Remove(c.spill.Name()))
+	c.spill, c.spilled = nil, 0
+	return err
+}
+
+func (c *sourceCache) Close() error {
+	var err error
+	if c.src != nil {
+		err = errors.Join(err, c.src.Close())
+		c.src = nil
+	}
+	err = errors.Join(err, c.removeSpill())
+	if c.head != nil {
+		if c.head.Cap() <= 2*HeaderBufferSize {
+			c.head.Reset()
+			headerPool.Put(c.head)
+		}
+		c.head = nil
+	}
+	return err
+}
+
+type cacheReader struct {
+	c    *sourceCache
+	pos  int64
+	keep bool
+}
+
+func (r *cacheReader) Read(b []byte) (int, error) {
+	c := r.c
+	if c.head == nil {
+		return 0, fs.ErrClosed
+	}
+	head := int64(c.head.Len())
+	if r.pos < head {
+		n := copy(b, c.head.Bytes()[r.pos:])
+		r.pos += int64(n)
+		return n, nil
+	}
+	if r.pos < c.cached() {
+		n, err := c.spill.ReadAt(b[:min(int64(len(b)), c.cached()-r.pos)], r.pos-head)
+		r.pos += int64(n)
+		if errors.Is(err, io.EOF) {
+			err = nil
+		}
+		return n, err
+	}
+
+	err := c.seekSource(r.pos)
+	if err != nil {
+		return 0, err
+	}
+	n, err := c.src.Read(b)
+	c.srcPos += int64(n)
+	if n > 0 && r.keep && r.pos == c.cached() {
+		c.keepBytes(b[:n])
+	}
+	r.pos += int64(n)
+	return n, err
+}
+
+// RemoveStaleTempFiles removes the temporary files left by the previous runs.
+// The files not modified since the given age are stale, the files of a running instance are kept.
+func RemoveStaleTempFiles(age time.Duration) (int, error) {
+	files, err := filepath.Glob(filepath.Join(os.TempDir(), fshelper.TempFilePattern))
+	if err != nil {
+		return 0, err
+	}
+	count := 0
+	for _, f := range files {
+		s, err := os.Stat(f)
+		if err != nil || s.IsDir() || time.Since(s.ModTime()) < age {
+			continue
+		}
+		if err = os.Remove(f); err == nil {
+			count++
+		}
+	}
+	return count, nil
+}
@@ -0,0 +1,134 @@
+package browser
+
+import (
+	"bytes"
+	"io"
+	"io/fs"
+	"os"
+	"testing"
+	"testing/fstest"
+	"time"
+
+	"github.com/simulot/immich-go/helpers/fshelper"
+)
+
+// noSeekFS gives files that can't seek, like the files of an archive, and counts their opening
+type noSeekFS struct {
+	fs.FS
+	opened int
+}
+
+func (fsys *noSeekFS) Open(name string) (fs.File, error) {
+	f, err := fsys.FS.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	fsys.opened++
+	return struct{ fs.File }{f}, nil
+}
+
+func TestSourceCache(t *testing.T) {
+	defer func(size int) { HeaderBufferSize = size }(HeaderBufferSize)
+	HeaderBufferSize = 100
+	t.Setenv("TMPDIR", t.TempDir())
+
+	tests := []struct {
+		name    string
+		content []byte
+		noSeek  bool
+		cached  int
+		opened  int
+	}{
+		{name: "file in memory", content: bytes.Repeat([]byte("0123456789"), 5), cached: 50},
+		{name: "file opened again", content: bytes.Repeat([]byte("0123456789"), 50), cached: 100},
+		{name: "file of an archive", content: bytes.Repeat([]byte("0123456789"), 50), noSeek: true, cached: 500, opened: 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			content := tt.content
+			var fsys fs.FS = fstest.MapFS{"photo.jpg": &fstest.MapFile{Data: content}}
+			counter := &noSeekFS{FS: fsys}
+			if tt.noSeek {
+				fsys = counter
+			}
+			la := &LocalAssetFile{FSys: fsys, FileName: "photo.jpg", FileSize: len(content)}
+			defer la.Close()
+
+			// read the header
+			r, err := la.PartialSourceReader()
+			if err != nil {
+				t.Fatal(err)
+			}
+			b := make([]byte, 30)
+			if _, err = io.ReadFull(r, b); err != nil || !bytes.Equal(b, content[:30]) {
+				t.Fatalf("unexpected header %q: %v", b, err)
+			}
+
+			// read the whole file, like the checksum
+			r, _ = la.PartialSourceReader()
+			all, err := io.ReadAll(r)
+			if err != nil || !bytes.Equal(all, content) {
+				t.Fatalf("unexpected content: %v", err)
+			}
+			if cached := la.cache.cached(); cached != int64(tt.cached) {
+				t.Errorf("unexpected cached bytes: %d", cached)
+			}
+			spill := la.cache.spill
+
+			// upload the file
+			f, err := la.Open()
+			if err != nil {
+				t.Fatal(err)
+			}
+			all, err = io.ReadAll(f)
+			if err != nil || !bytes.Equal(all, content) {
+				t.Fatalf("unexpected uploaded content: %v", err)
+			}
+
+			err = la.Close()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if tt.noSeek && counter.opened != tt.opened {
+				t.Errorf("the file is opened %d times, expecting %d", counter.opened, tt.opened)
+			}
+			if (spill != nil) != tt.noSeek {
+				t.Errorf("unexpected temporary file %v", spill)
+			}
+			if spill != nil {
+				if _, err := os.Stat(spill.Name()); !os.IsNotExist(err) {
+					t.Errorf("the temporary file %s is left", spill.Name())
+				}
+			}
+		})
+	}
+}
+
+func TestRemoveStaleTempFiles(t *testing.T) {
+	t.Setenv("TMPDIR", t.TempDir())
+	stale, err := os.CreateTemp("", fshelper.TempFilePattern)
+	if err != nil {
+		t.Fatal(err)
+	}
+	stale.Close()
+	old := time.Now().Add(-48 * time.Hour)
+	if err = os.Chtimes(stale.Name(), old, old); err != nil {
+		t.Fatal(err)
+	}
+	running, err := os.CreateTemp("", fshelper.TempFilePattern)
+	if err != nil {
+		t.Fatal(err)
+	}
+	running.Close()
+
+	n, err := RemoveStaleTempFiles(24 * time.Hour)
+	if err != nil || n != 1 {
+		t.Fatalf("expecting 1 file removed, got %d, %v", n, err)
+	}
+	if _, err = os.Stat(stale.Name()); err == nil {
+		t.Error("the stale file should be removed")
+	}
+	if _, err = os.Stat(running.Name()); err != nil {
+		t.Error("the file of a running instance should be kept")
+	}
+}
@@ -17,7 +17,6 @@ import (
 
 type MetadataCmd struct {
 	*cmd.SharedFlags
-	DryRun                 bool
 	MissingDateDespiteName bool
 	MissingDate            bool
 }
@@ -30,7 +29,6 @@ func NewMetadataCmd(ctx context.Context, common *cmd.SharedFlags, args []string)
 	}
 
 	app.SharedFlags.SetFlags(cmd)
-	cmd.BoolFunc("dry-run", "display actions, but don't touch the server assets", myflag.BoolFlagFn(&app.DryRun, false))
 	cmd.BoolFunc("missing-date", "select all assets where the date is missing", myflag.BoolFlagFn(&app.MissingDate, false))
 	cmd.BoolFunc("missing-date-with-name", "select all assets where the date is missing but the name contains a the date", myflag.BoolFlagFn(&app.MissingDateDespiteName, false))
 	err = cmd.Parse(args)
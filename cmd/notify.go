@@ -0,0 +1,75 @@
+package cmd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/simulot/immich-go/helpers/fileevent"
+	"github.com/simulot/immich-go/helpers/notify"
+)
+
+// ErrInterrupted is the cause of the cancellation of a command interrupted by the user
+var ErrInterrupted = errors.New("interrupted")
+
+// Notify sends the summary of the run to the webhooks given with -notify-url.
+// It's called when the command ends, including on errors and cancellation,
+// so it doesn't use the command's context.
+func (app *SharedFlags) Notify(ctx context.Context, command string, started time.Time, runErr error) {
+	if len(app.NotifyURLs) == 0 {
+		return
+	}
+	s := app.summary(ctx, command, started, runErr)
+
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), 30*time.Second)
+	defer cancel()
+	for _, u := range app.NotifyURLs {
+		err := notify.New(u, app.NotifyFormat).Send(ctx, s)
+		if err != nil {
+			app.Log.Error(err.Error())
+			fmt.Println(err.Error())
+		}
+	}
+}
+
+func (app *SharedFlags) summary(ctx context.Context, command string, started time.Time, runErr error) notify.Summary {
+	ended := time.Now()
+	s := notify.Summary{
+		Command:   command,
+		Status:    notify.StatusSuccess,
+		Started:   started,
+		Ended:     ended,
+		Duration:  ended.Sub(started).Seconds(),
+		Report:    app.LogFile,
+		Server:    app.Server,
+		APITraces: app.APITraceWriterName,
+	}
+	s.Hostname, _ = os.Hostname()
+
+	if ctx.Err() != nil || errors.Is(runErr, context.Canceled) || errors.Is(runErr, ErrInterrupted) {
+		s.Status = notify.StatusCancelled
+		if cause := context.Cause(ctx); cause != nil {
+			s.Error = cause.Error()
+		}
+	}
+	if runErr != nil {
+		if s.Status == notify.StatusSuccess {
+			s.Status = notify.StatusError
+		}
+		s.Error = runErr.Error()
+	}
+
+	if app.Jnl != nil {
+		s.Counts = map[string]int64{}
+		counts := app.Jnl.GetCounts()
+		for c := fileevent.Code(0); c < fileevent.MaxCode; c++ {
+			if counts[c] > 0 {
+				s.Counts[c.String()] = counts[c]
+			}
+		}
+		s.Errors = counts[fileevent.Error] + counts[fileevent.UploadServerError]
+	}
+	return s
+}
@@ -12,9 +12,11 @@ import (
 	"strings"
 	"time"
 
+	"github.com/simulot/immich-go/browser"
 	"github.com/simulot/immich-go/helpers/configuration"
 	"github.com/simulot/immich-go/helpers/fileevent"
 	"github.com/simulot/immich-go/helpers/myflag"
+	"github.com/simulot/immich-go/helpers/notify"
 	"github.com/simulot/immich-go/helpers/tzone"
 	"github.com/simulot/immich-go/immich"
 	fakeimmich "github.com/simulot/immich-go/internal/fakeImmich"
@@ -22,6 +24,9 @@ import (
 	"github.com/telemachus/humane"
 )
 
+// staleTempFileAge is the age of the temporary files of the crashed runs
+const staleTempFileAge = 24 * time.Hour
+
 // SharedFlags collect all parameters that are common to all commands
 type SharedFlags struct {
 	ConfigurationFile string        // Path to the configuration file to use
@@ -40,6 +45,10 @@ type SharedFlags struct {
 	JSONLog           bool          // Enable JSON structured log
 	DebugCounters     bool          // Enable CSV action counters per file
 	DebugFileList     bool          // When true, the file argument is a file wile the list of Takeout files
+	NotifyURLs        []string      // Webhooks called at the end of the run
+	NotifyFormat      notify.Format // Format of the notification
+	DryRun            bool          // Simulate the changes on the server
+	ServerSnapshot    string        // Snapshot of the server used instead of the server
 
 	Immich             immich.ImmichInterface // Immich client
 	Log                *slog.Logger           // Logger
@@ -80,6 +89,13 @@ func (app *SharedFlags) SetFlags(fs *flag.FlagSet) {
 	fs.BoolFunc("no-ui", "Disable the user interface", myflag.BoolFlagFn(&app.NoUI, app.NoUI))
 	fs.Func("client-timeout", "Set server calls timeout, default 1m", myflag.DurationFlagFn(&app.ClientTimeout, app.ClientTimeout))
 	fs.BoolFunc("debug-counters", "generate a CSV file with actions per handled files", myflag.BoolFlagFn(&app.DebugCounters, false))
+	fs.Func("notify-url", "POST a summary of the run to this URL when the command ends. Repeat the option for each URL", func(s string) error {
+		app.NotifyURLs = append(app.NotifyURLs, s)
+		return nil
+	})
+	fs.Var(&app.NotifyFormat, "notify-format", "Format of the notification: json, ntfy, gotify or apprise (default json)")
+	fs.BoolFunc("dry-run", "Simulate the changes on the server, and keep the local files (default FALSE)", myflag.BoolFlagFn(&app.DryRun, false))
+	fs.StringVar(&app.ServerSnapshot, "server-snapshot", app.ServerSnapshot, "Work offline with the server's state saved by the command snapshot save, requires -dry-run")
 }
 
 func (app *SharedFlags) Start(ctx context.Context) error {
@@ -120,6 +136,24 @@ func (app *SharedFlags) Start(ctx context.Context) error {
 		}
 	}
 
+	// the temporary files of a crashed run are left behind
+	if n, err := browser.RemoveStaleTempFiles(staleTempFileAge); err == nil && n > 0 {
+		app.Log.Info(fmt.Sprintf("%d temporary files left by a previous run removed", n))
+	}
+
+	if app.ServerSnapshot != "" && app.Immich == nil {
+		if !app.DryRun {
+			return errors.New("the option -server-snapshot requires -dry-run")
+		}
+		snap, err := immich.LoadSnapshot(app.ServerSnapshot)
+		if err != nil {
+			return err
+		}
+		app.Server = snap.Server
+		app.Immich = immich.NewSnapshotClient(snap)
+		app.Log.Info(fmt.Sprintf("Offline analysis with the snapshot of %s taken on %s", snap.Server, snap.Date.Format(time.DateTime)))
+	}
+
 	// If the client isn't yet initialized
 	if app.Immich == nil {
 		if app.Server == "" && app.API == "" && app.Key == "" {
@@ -201,6 +235,11 @@ func (app *SharedFlags) Start(ctx context.Context) error {
 		app.Log.Info(fmt.Sprintf("Connected, user: %s", user.Email))
 	}
 
+	if app.DryRun {
+		// the server's changes are simulated
+		app.Immich = immich.NewDryRunClient(app.Immich)
+		app.Log.Info("Dry-run mode, the server isn't changed")
+	}
 	return nil
 }
 
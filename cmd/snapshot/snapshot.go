@@ -0,0 +1,68 @@
+// Package snapshot saves the state of the server for an offline analysis
+package snapshot
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+
+	"github.com/simulot/immich-go/cmd"
+	"github.com/simulot/immich-go/immich"
+)
+
+func SnapshotCommand(ctx context.Context, common *cmd.SharedFlags, args []string) error {
+	if len(args) > 0 {
+		cmd := args[0]
+		args = args[1:]
+
+		if cmd == "save" {
+			return saveSnapshot(ctx, common, args)
+		}
+	}
+	return fmt.Errorf("the snapshot command need a sub command: save")
+}
+
+type SaveSnapshotCmd struct {
+	*cmd.SharedFlags
+}
+
+func saveSnapshot(ctx context.Context, common *cmd.SharedFlags, args []string) error {
+	app := &SaveSnapshotCmd{
+		SharedFlags: common,
+	}
+	cmd := flag.NewFlagSet("snapshot save", flag.ExitOnError)
+	app.SharedFlags.SetFlags(cmd)
+	err := cmd.Parse(args)
+	if err != nil {
+		return err
+	}
+	if cmd.NArg() != 1 {
+		return errors.New("the command snapshot save needs the name of the snapshot file")
+	}
+	if app.ServerSnapshot != "" {
+		return errors.New("the option -server-snapshot can't be used to save a snapshot")
+	}
+	err = app.SharedFlags.Start(ctx)
+	if err != nil {
+		return err
+	}
+
+	server := app.Server
+	if server == "" {
+		server = app.API
+	}
+	fmt.Println("Get the server's assets and albums...")
+	snap, err := immich.TakeSnapshot(ctx, app.Immich, server)
+	if err != nil {
+		return fmt.Errorf("can't get the server's state: %w", err)
+	}
+	err = snap.Save(cmd.Arg(0))
+	if err != nil {
+		return fmt.Errorf("can't save the snapshot: %w", err)
+	}
+	msg := fmt.Sprintf("Snapshot of %s saved into %s: %d assets, %d albums", server, cmd.Arg(0), len(snap.Assets), len(snap.Albums))
+	fmt.Println(msg)
+	app.Log.Info(msg)
+	return nil
+}
@@ -0,0 +1,36 @@
+package upload
+
+import (
+	"github.com/simulot/immich-go/browser"
+	"github.com/simulot/immich-go/helpers/fshelper"
+)
+
+// identifyAsset gives the asset and its live photo a device asset ID derived from their content,
+// and the device ID of their source, when the option -device-asset-id=HASH is given.
+// The server's assets uploaded with the legacy ID are recognized by their checksum.
+func (app *UpCmd) identifyAsset(a *browser.LocalAssetFile) error {
+	if app.DeviceAssetID != "HASH" {
+		return nil
+	}
+	for _, la := range []*browser.LocalAssetFile{a, a.LivePhoto} {
+		if la == nil {
+			continue
+		}
+		err := la.ComputeChecksum()
+		if err != nil {
+			return err
+		}
+		if app.SharedFlags.DeviceUUID == "" {
+			la.DeviceID = sourceDeviceID(la)
+		}
+	}
+	return nil
+}
+
+// sourceDeviceID names the device after the asset's source: the archive or the folder
+func sourceDeviceID(a *browser.LocalAssetFile) string {
+	if name := fshelper.SourceName(a.FSys); name != "" {
+		return "immich-go/" + name
+	}
+	return "immich-go"
+}
@@ -0,0 +1,85 @@
+package upload
+
+import (
+	"context"
+	"crypto/sha1"
+	"encoding/base64"
+	"io"
+	"log/slog"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/simulot/immich-go/browser"
+	"github.com/simulot/immich-go/cmd"
+	"github.com/simulot/immich-go/helpers/fileevent"
+	"github.com/simulot/immich-go/immich"
+)
+
+// icCatchIDs has some assets, and catches the IDs of the uploaded ones
+type icCatchIDs struct {
+	icCatchUploadsAssets
+	serverAssets []*immich.Asset
+	ids          map[string]string // device asset ID by file name
+	devices      map[string]string // device ID by file name
+}
+
+func (c *icCatchIDs) GetAllAssetsWithFilter(ctx context.Context, fn func(*immich.Asset) error) error {
+	for _, a := range c.serverAssets {
+		if err := fn(a); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (c *icCatchIDs) AssetUpload(ctx context.Context, a *browser.LocalAssetFile) (immich.AssetResponse, error) {
+	c.ids[a.FileName] = a.DeviceAssetID()
+	c.devices[a.FileName] = a.DeviceID
+	return c.icCatchUploadsAssets.AssetUpload(ctx, a)
+}
+
+func TestUploadDeviceAssetIDHash(t *testing.T) {
+	b, err := os.ReadFile("TEST_DATA/folder/high/AlbumA/PXL_20231006_063000139.jpg")
+	if err != nil {
+		t.Fatal(err)
+	}
+	sum := sha1.Sum(b)
+
+	ic := &icCatchIDs{
+		icCatchUploadsAssets: icCatchUploadsAssets{albums: map[string][]string{}},
+		// the server has the first photo, uploaded under another name with the legacy ID
+		serverAssets: []*immich.Asset{{
+			ID:               "server-1",
+			DeviceAssetID:    "renamed.jpg-147869",
+			OriginalFileName: "renamed.jpg",
+			Checksum:         base64.StdEncoding.EncodeToString(sum[:]),
+			ExifInfo:         immich.ExifInfo{FileSizeInByte: len(b)},
+		}},
+		ids:     map[string]string{},
+		devices: map[string]string{},
+	}
+	log := slog.New(slog.NewTextHandler(io.Discard, nil))
+	serv := cmd.SharedFlags{
+		Immich: ic,
+		Jnl:    fileevent.NewRecorder(log, false),
+		Log:    log,
+	}
+	err = UploadCommand(context.Background(), &serv, []string{"-no-ui", "-device-asset-id=hash", "TEST_DATA/folder/high"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	counts := serv.Jnl.GetCounts()
+	if counts[fileevent.Uploaded] != 7 || counts[fileevent.UploadServerDuplicate] != 1 {
+		t.Errorf("expecting 7 uploads and 1 asset recognized on the server, got %d and %d", counts[fileevent.Uploaded], counts[fileevent.UploadServerDuplicate])
+	}
+	for name, id := range ic.ids {
+		if !strings.HasPrefix(id, browser.ContentIDPrefix) {
+			t.Errorf("%s: expecting a content ID, got %q", name, id)
+		}
+		if !strings.HasPrefix(ic.devices[name], "immich-go") {
+			t.Errorf("%s: expecting the device of the source, got %q", name, ic.devices[name])
+		}
+	}
+}
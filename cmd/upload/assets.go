@@ -6,6 +6,7 @@ import (
 	"strings"
 
 	"github.com/simulot/immich-go/browser"
+	"github.com/simulot/immich-go/helpers/namenorm"
 	"github.com/simulot/immich-go/immich"
 )
 
@@ -14,6 +15,9 @@ type AssetIndex struct {
 	byHash map[string][]*immich.Asset
 	byName map[string][]*immich.Asset
 	byID   map[string]*immich.Asset
+	policy qualityPolicy       // how to compare the local and the server's copies
+	names  namenorm.Normalizer // how to compare the names
+	rawJpg bool                // the RAW and JPEG copies are stacked, not compared
 	// albums []immich.AlbumSimplified
 }
 
@@ -23,16 +27,19 @@ func (ai *AssetIndex) ReIndex() {
 	ai.byID = map[string]*immich.Asset{}
 
 	for _, a := range ai.assets {
-		ID := fmt.Sprintf("%s-%d", a.OriginalFileName, a.ExifInfo.FileSizeInByte)
+		ID := ai.idKey(fmt.Sprintf("%s-%d", a.OriginalFileName, a.ExifInfo.FileSizeInByte))
 		l := ai.byHash[a.Checksum]
 		l = append(l, a)
 		ai.byHash[a.Checksum] = l
 
-		n := a.OriginalFileName
+		n := ai.names.Key(serverBaseName(a))
 		l = ai.byName[n]
 		l = append(l, a)
 		ai.byName[n] = l
 		ai.byID[ID] = a
+		if strings.HasPrefix(a.DeviceAssetID, browser.ContentIDPrefix) {
+			ai.byID[a.DeviceAssetID] = a
+		}
 	}
 }
 
@@ -44,7 +51,10 @@ func (ai *AssetIndex) AddLocalAsset(la *browser.LocalAssetFile, immichID string)
 	sa := &immich.Asset{
 		ID:               immichID,
 		DeviceAssetID:    la.DeviceAssetID(),
+		DeviceID:         la.DeviceID,
+		Checksum:         la.Checksum,
 		OriginalFileName: strings.TrimSuffix(path.Base(la.Title), path.Ext(la.Title)),
+		OriginalPath:     la.FileName,
 		ExifInfo: immich.ExifInfo{
 			FileSizeInByte:   int(la.Size()),
 			DateTimeOriginal: immich.ImmichTime{Time: la.Metadata.DateTaken},
@@ -54,8 +64,46 @@ func (ai *AssetIndex) AddLocalAsset(la *browser.LocalAssetFile, immichID string)
 		JustUploaded: true,
 	}
 	ai.assets = append(ai.assets, sa)
-	ai.byID[sa.DeviceAssetID] = sa
-	l := ai.byName[sa.OriginalFileName]
+	ai.byID[ai.idKey(sa.DeviceAssetID)] = sa
+	ai.byID[ai.idKey(la.LegacyDeviceAssetID())] = sa
+	if sa.Checksum != "" {
+		ai.byHash[sa.Checksum] = append(ai.byHash[sa.Checksum], sa)
+	}
+	n := ai.names.Key(sa.OriginalFileName)
+	l := ai.byName[n]
 	l = append(l, sa)
-	ai.byName[sa.OriginalFileName] = l
+	ai.byName[n] = l
+}
+
+// idKey gives the index key of a device asset ID. The IDs made with the file names are normalized,
+// the content IDs are kept as they are.
+func (ai *AssetIndex) idKey(id string) string {
+	if strings.HasPrefix(id, browser.ContentIDPrefix) {
+		return id
+	}
+	return ai.names.Key(id)
+}
+
+// HasAsset tells if the server has an asset with the same name and size.
+// The server's names are indexed without their extension, the format must be the same.
+func (ai *AssetIndex) HasAsset(name string, size int64) bool {
+	if _, ok := ai.byID[ai.idKey(fmt.Sprintf("%s-%d", name, size))]; ok {
+		return true
+	}
+	ext := path.Ext(name)
+	for _, sa := range ai.byName[ai.names.Key(strings.TrimSuffix(name, ext))] {
+		if int64(sa.ExifInfo.FileSizeInByte) == size && sameFormat(ext, serverQuality(sa).ext) {
+			return true
+		}
+	}
+	return false
+}
+
+// serverBaseName gives the server's file name without its extension, the copies in other formats have the same one
+func serverBaseName(a *immich.Asset) string {
+	ext := path.Ext(a.OriginalPath)
+	if ext == "" {
+		ext = path.Ext(a.OriginalFileName)
+	}
+	return strings.TrimSuffix(a.OriginalFileName, ext)
 }
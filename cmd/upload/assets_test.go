@@ -0,0 +1,51 @@
+package upload
+
+import (
+	"testing"
+	"time"
+
+	"github.com/simulot/immich-go/browser"
+	"github.com/simulot/immich-go/helpers/namenorm"
+	"github.com/simulot/immich-go/immich"
+)
+
+func TestShouldUploadNormalizedNames(t *testing.T) {
+	date := time.Date(2023, 10, 6, 6, 30, 0, 0, time.UTC)
+	server := []*immich.Asset{{
+		ID:               "1",
+		OriginalFileName: "Crème brûlée.jpg", // NFC, as given by immich
+		ExifInfo: immich.ExifInfo{
+			FileSizeInByte:   1000,
+			DateTimeOriginal: immich.ImmichTime{Time: date},
+		},
+	}}
+
+	tests := []struct {
+		name  string
+		title string
+		names namenorm.Normalizer
+		want  AdviceCode
+	}{
+		{name: "NFD", title: "Cre\u0300me bru\u0302le\u0301e.jpg", want: SameOnServer},
+		{name: "case", title: "CRE\u0300ME BRU\u0302LE\u0301E.JPG", want: NotOnServer},
+		{name: "folded case", title: "CRE\u0300ME BRU\u0302LE\u0301E.JPG", names: namenorm.Normalizer{FoldCase: true}, want: SameOnServer},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ai := AssetIndex{assets: server, names: tt.names, policy: qualityPolicy{qualitySize}}
+			ai.ReIndex()
+			la := &browser.LocalAssetFile{FileName: tt.title, Title: tt.title, FileSize: 1000}
+			la.Metadata.DateTaken = date
+			advice, err := ai.ShouldUpload(la)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if advice.Advice != tt.want {
+				t.Errorf("expecting %s, got %s: %s", tt.want, advice.Advice, advice.Message)
+			}
+			if !ai.HasAsset(tt.title, 1000) && tt.want == SameOnServer {
+				t.Errorf("HasAsset should find the asset")
+			}
+		})
+	}
+}
@@ -0,0 +1,29 @@
+package upload
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/simulot/immich-go/helpers/fileevent"
+	"github.com/simulot/immich-go/helpers/fshelper"
+)
+
+// recordLostFiles reports the files of the damaged archives that can't be recovered.
+// The archives must be downloaded again to import them.
+func (app *UpCmd) recordLostFiles(ctx context.Context) {
+	for _, fsys := range app.fsyss {
+		d, ok := fsys.(fshelper.DamagedFS)
+		if !ok {
+			continue
+		}
+		name := fshelper.SourceName(fsys)
+		lost := d.Lost()
+		msg := fmt.Sprintf("%s is damaged, its readable files are imported, %d files are lost. Download it again to get them.", name, len(lost))
+		fmt.Println(msg)
+		app.Log.Warn(msg)
+		for _, l := range lost {
+			app.Jnl.Record(ctx, fileevent.DiscoveredLost, nil, l.Name, "archive", name, "reason", l.Reason)
+		}
+		app.lostFiles += len(lost)
+	}
+}
@@ -0,0 +1,61 @@
+package upload
+
+import (
+	"context"
+	"path"
+
+	"github.com/simulot/immich-go/browser"
+	"github.com/simulot/immich-go/helpers/fileevent"
+	"github.com/simulot/immich-go/immich/metadata"
+)
+
+// geoTagAsset gives a position to assets without coordinates using the track logs.
+// Coordinates already known, from the Google Photos JSON or from the file itself,
+// are kept unless the option -gpx-overwrite is set.
+func (app *UpCmd) geoTagAsset(ctx context.Context, a *browser.LocalAssetFile) {
+	if app.geoTrack == nil {
+		return
+	}
+	if a.SideCar.IsSet() {
+		// the user's XMP file is uploaded as it is
+		return
+	}
+	if !app.GeoTagOverwrite {
+		if a.Metadata.Latitude != 0 || a.Metadata.Longitude != 0 {
+			return
+		}
+		if hasEmbeddedPosition(a) {
+			return
+		}
+	}
+
+	p, ok := app.geoTrack.Locate(a.Metadata.DateTaken.Add(app.GeoTagTimeOffset), app.GeoTagMaxGap)
+	if !ok {
+		return
+	}
+	for _, la := range []*browser.LocalAssetFile{a, a.LivePhoto} {
+		if la == nil {
+			continue
+		}
+		la.Metadata.Latitude = p.Latitude
+		la.Metadata.Longitude = p.Longitude
+		la.Metadata.Altitude = p.Altitude
+		if la.Metadata.DateTaken.IsZero() {
+			la.Metadata.DateTaken = a.Metadata.DateTaken
+		}
+	}
+	app.Jnl.Record(ctx, fileevent.GeoTagged, a, a.FileName, "latitude", p.Latitude, "longitude", p.Longitude, "altitude", p.Altitude)
+}
+
+// hasEmbeddedPosition checks if the file carries its own GPS coordinates
+func hasEmbeddedPosition(a *browser.LocalAssetFile) bool {
+	r, err := a.PartialSourceReader()
+	if err != nil {
+		return false
+	}
+	m, err := metadata.GetFromReader(r, path.Ext(a.FileName))
+	if err != nil {
+		return false
+	}
+	return m.Latitude != 0 || m.Longitude != 0
+}
@@ -0,0 +1,192 @@
+package upload
+
+import (
+	"context"
+	"fmt"
+	"slices"
+
+	"github.com/simulot/immich-go/browser"
+	"github.com/simulot/immich-go/helpers/fileevent"
+	"github.com/simulot/immich-go/helpers/fshelper"
+	"github.com/simulot/immich-go/helpers/hook"
+	"github.com/simulot/immich-go/helpers/rules"
+)
+
+// hookInput gives the facts of the asset to the hook
+func (app *UpCmd) hookInput(a *browser.LocalAssetFile, event hook.Event, decision string, reason string) hook.Input {
+	in := hook.Input{
+		Event:       event,
+		Server:      app.replicaName(),
+		File:        a.FileName,
+		Source:      fshelper.SourceName(a.FSys),
+		Title:       a.Title,
+		Size:        a.FileSize,
+		Description: a.Metadata.Description,
+		Latitude:    a.Metadata.Latitude,
+		Longitude:   a.Metadata.Longitude,
+		Favorite:    a.Favorite,
+		Archived:    a.Archived,
+		Trashed:     a.Trashed,
+		Decision:    decision,
+		Reason:      reason,
+	}
+	if !a.Metadata.DateTaken.IsZero() {
+		d := a.Metadata.DateTaken
+		in.DateTaken = &d
+	}
+	if a.LivePhoto != nil {
+		in.LivePhoto = a.LivePhoto.FileName
+	}
+	if a.SideCar.IsSet() {
+		in.SideCar = a.SideCar.FileName
+	}
+	for _, al := range a.Albums {
+		in.Albums = append(in.Albums, app.albumName(al))
+	}
+	return in
+}
+
+// beforeUpload determines the albums of the asset, and calls the before-upload hooks.
+// The hooks can veto the asset, change its albums, its favorite flag or its description, and give its tags.
+// The albums, the tags and the description given by the rules are changed the same way.
+// It returns false when the asset must not be uploaded.
+func (app *UpCmd) beforeUpload(ctx context.Context, a *browser.LocalAssetFile, decision string, advice *Advice, ruled rules.Result) ([]albumTarget, hook.Output, bool) {
+	albums := ruleAlbums(app.assetAlbums(a, advice), ruled)
+	changes := hook.Output{Tags: ruled.Tags, Description: ruled.Description}
+	if !app.Hooks.Has(hook.BeforeUpload) {
+		return albums, changes, true
+	}
+
+	in := app.hookInput(a, hook.BeforeUpload, decision, advice.Message)
+	in.Albums = nil
+	for _, al := range albums {
+		in.Albums = append(in.Albums, al.title)
+	}
+	out, err := app.Hooks.Run(ctx, in)
+	if err != nil {
+		app.Jnl.Record(ctx, fileevent.Error, a, a.FileName, "error", err.Error())
+		app.runErrorHook(ctx, a, err)
+		return nil, out, false
+	}
+	if out.Veto {
+		app.skipAsset(ctx, a, "vetoed", out.Reason)
+		return nil, out, false
+	}
+
+	if out.Albums != nil {
+		albums = albums[:0]
+		for _, title := range *out.Albums {
+			albums = append(albums, albumTarget{title: title, reason: "hook before-upload"})
+		}
+	}
+	if out.Favorite != nil {
+		a.Favorite = *out.Favorite
+	}
+	if out.Description != nil {
+		a.Metadata.Description = *out.Description
+		changes.Description = out.Description
+	}
+	for _, t := range out.Tags {
+		if !slices.Contains(changes.Tags, t) {
+			changes.Tags = append(changes.Tags, t)
+		}
+	}
+	return albums, changes, true
+}
+
+// afterUpload applies the changes of the before-upload hooks needing the asset's ID, and calls the after-upload hooks.
+func (app *UpCmd) afterUpload(ctx context.Context, a *browser.LocalAssetFile, id string, decision string, changes hook.Output) {
+	if changes.Description != nil {
+		_, err := app.Immich.UpdateAsset(ctx, id, a)
+		if err != nil {
+			app.Jnl.Record(ctx, fileevent.Error, a, a.FileName, "error", fmt.Sprintf("can't update the description: %s", err))
+		}
+	}
+	if len(changes.Tags) > 0 {
+		err := app.tagAsset(ctx, id, changes.Tags)
+		if err != nil {
+			app.Jnl.Record(ctx, fileevent.Error, a, a.FileName, "error", fmt.Sprintf("can't tag the asset: %s", err))
+		} else {
+			app.Jnl.Record(ctx, fileevent.Tagged, a, a.FileName, "tags", changes.Tags)
+		}
+	}
+
+	if !app.Hooks.Has(hook.AfterUpload) {
+		return
+	}
+	in := app.hookInput(a, hook.AfterUpload, decision, "")
+	in.ServerID = id
+	_, err := app.Hooks.Run(ctx, in)
+	if err != nil {
+		app.Jnl.Record(ctx, fileevent.Error, a, a.FileName, "error", err.Error())
+	}
+}
+
+// tagAsset creates the tags when needed, and adds them to the asset
+func (app *UpCmd) tagAsset(ctx context.Context, id string, tags []string) error {
+	serverTags, err := app.Immich.UpsertTags(ctx, tags)
+	if err != nil {
+		return err
+	}
+	ids := []string{}
+	for _, t := range serverTags {
+		ids = append(ids, t.ID)
+	}
+	if len(ids) == 0 {
+		return nil
+	}
+	return app.Immich.TagAssets(ctx, ids, []string{id})
+}
+
+// skipAsset records the asset as not selected, and calls the on-skip hooks
+func (app *UpCmd) skipAsset(ctx context.Context, a *browser.LocalAssetFile, decision string, reason string) {
+	app.Jnl.Record(ctx, fileevent.UploadNotSelected, a, a.FileName, "reason", reason)
+	app.runSkipHook(ctx, a, decision, reason, "")
+}
+
+// runSkipHook calls the on-skip hooks for an asset that isn't uploaded
+func (app *UpCmd) runSkipHook(ctx context.Context, a *browser.LocalAssetFile, decision string, reason string, serverID string) {
+	if !app.Hooks.Has(hook.OnSkip) {
+		return
+	}
+	in := app.hookInput(a, hook.OnSkip, decision, reason)
+	in.ServerID = serverID
+	_, err := app.Hooks.Run(ctx, in)
+	if err != nil {
+		app.Jnl.Record(ctx, fileevent.Error, a, a.FileName, "error", err.Error())
+	}
+}
+
+// runErrorHook calls the on-error hooks for an asset that can't be uploaded
+func (app *UpCmd) runErrorHook(ctx context.Context, a *browser.LocalAssetFile, uploadErr error) {
+	if !app.Hooks.Has(hook.OnError) {
+		return
+	}
+	in := app.hookInput(a, hook.OnError, "error", "")
+	in.Error = uploadErr.Error()
+	_, err := app.Hooks.Run(ctx, in)
+	if err != nil {
+		app.Log.Error(err.Error())
+	}
+}
+
+// runEndHook calls the end-of-run hooks with the counters of the run
+func (app *UpCmd) runEndHook(ctx context.Context) {
+	if !app.Hooks.Has(hook.EndOfRun) {
+		return
+	}
+	in := hook.Input{
+		Event:  hook.EndOfRun,
+		Server: app.replicaName(),
+		Counts: map[string]int64{},
+	}
+	for c, v := range app.Jnl.GetCounts() {
+		if v > 0 {
+			in.Counts[fileevent.Code(c).String()] = v
+		}
+	}
+	_, err := app.Hooks.Run(ctx, in)
+	if err != nil {
+		app.Log.Error(err.Error())
+	}
+}
@@ -0,0 +1,70 @@
+package upload
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"sort"
+	"strings"
+
+	"github.com/simulot/immich-go/helpers/configuration"
+	"github.com/simulot/immich-go/helpers/fileevent"
+	"github.com/simulot/immich-go/helpers/fshelper"
+	"github.com/simulot/immich-go/helpers/incremental"
+)
+
+// openIncremental loads the states of the folders for the servers.
+// The files that fail or that aren't selected are forgotten, to be processed by the next run.
+func (app *UpCmd) openIncremental() error {
+	servers := []string{app.replicaName()}
+	for _, r := range app.replicas {
+		servers = append(servers, r.replicaName())
+	}
+	sort.Strings(servers[1:])
+	server := strings.Join(servers, ",")
+
+	app.incremental = map[fs.FS]*incremental.State{}
+	for _, fsys := range app.fsyss {
+		rfs, ok := fsys.(fshelper.RootFS)
+		if !ok {
+			continue
+		}
+		state, err := incremental.Load(configuration.DefaultStateDir(), server, rfs.Root())
+		if err != nil {
+			return err
+		}
+		app.incremental[fsys] = state
+		if !state.Watermark().IsZero() {
+			app.Log.Info(fmt.Sprintf("%s: %d files uploaded until %s", rfs.Root(), state.Len(), state.Watermark().Format("2006-01-02 15:04:05")))
+		}
+	}
+
+	forget := func(code fileevent.Code, file string) {
+		switch code {
+		case fileevent.Error, fileevent.UploadServerError, fileevent.UploadNotSelected:
+			for _, state := range app.incremental {
+				state.Forget(file)
+			}
+		}
+	}
+	app.Jnl.AddHook(forget)
+	for _, r := range app.replicas {
+		r.Jnl.AddHook(forget)
+	}
+	return nil
+}
+
+// saveIncremental saves the states of the folders once the upload is completed
+func (app *UpCmd) saveIncremental() error {
+	if app.DryRun {
+		return nil
+	}
+	var errs error
+	for _, state := range app.incremental {
+		errs = errors.Join(errs, state.Save())
+	}
+	if errs != nil {
+		return fmt.Errorf("can't save the incremental state: %w", errs)
+	}
+	return nil
+}
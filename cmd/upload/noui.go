@@ -60,6 +60,8 @@ func (app *UpCmd) runNoUI(ctx context.Context) error {
 
 		return fmt.Sprintf("\rImmich read %d%%, Assets found: %d, Upload errors: %d, Uploaded %d %s", immichPct, app.Jnl.TotalAssets(), counts[fileevent.UploadServerError], counts[fileevent.Uploaded], string(spinner[spinIdx]))
 	}
+	go app.watchJobQueues(ctx)
+
 	uiGrp := errgroup.Group{}
 
 	uiGrp.Go(func() error {
@@ -96,6 +98,13 @@ func (app *UpCmd) runNoUI(ctx context.Context) error {
 		processGrp.Go(func() error {
 			return app.getImmichAlbums(ctx)
 		})
+		processGrp.Go(func() error {
+			err := app.prepareReplicas(ctx)
+			if err != nil {
+				cancel(err)
+			}
+			return err
+		})
 		processGrp.Go(func() error {
 			// Run Prepare
 			err := app.browser.Prepare(ctx)
@@ -112,6 +121,14 @@ func (app *UpCmd) runNoUI(ctx context.Context) error {
 				return err
 			}
 		}
+		estimate, err := app.preflight(ctx)
+		if err != nil {
+			cancel(err)
+			return err
+		}
+		if estimate != nil {
+			fmt.Println("\n" + estimate.String())
+		}
 		preparationDone.Store(true)
 		err = app.uploadLoop(ctx)
 		if err != nil {
@@ -139,6 +156,6 @@ func (app *UpCmd) runNoUI(ctx context.Context) error {
 	if err != nil {
 		err = context.Cause(ctx)
 	}
-	app.Jnl.Report()
+	app.report()
 	return err
 }
@@ -0,0 +1,221 @@
+package upload
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/simulot/immich-go/immich"
+)
+
+// errAssetSkipped is the cause of the cancellation of an asset skipped by the user
+var errAssetSkipped = errors.New("skipped by the user")
+
+// uploadControl lets the user, or the server's job queues, pause the upload
+// and skip the asset being uploaded.
+type uploadControl struct {
+	mu         sync.Mutex
+	userPaused bool                    // paused from the keyboard
+	jobsPaused string                  // reason of the automatic pause, empty when the queues are below the thresholds
+	resume     chan struct{}           // closed when the upload can go on
+	skip       context.CancelCauseFunc // cancels the asset being uploaded
+}
+
+func newUploadControl() *uploadControl {
+	c := &uploadControl{
+		resume: make(chan struct{}),
+	}
+	close(c.resume)
+	return c
+}
+
+// update opens or closes the gate after a change of state. The lock must be held.
+func (c *uploadControl) update() {
+	paused := c.userPaused || c.jobsPaused != ""
+	select {
+	case <-c.resume:
+		if paused {
+			c.resume = make(chan struct{})
+		}
+	default:
+		if !paused {
+			close(c.resume)
+		}
+	}
+}
+
+// TogglePause pauses or resumes the upload, and returns the new state
+func (c *uploadControl) TogglePause() bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.userPaused = !c.userPaused
+	c.update()
+	return c.userPaused
+}
+
+// SetJobsPause pauses the upload while the reason isn't empty, and returns the previous reason
+func (c *uploadControl) SetJobsPause(reason string) string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	prev := c.jobsPaused
+	c.jobsPaused = reason
+	c.update()
+	return prev
+}
+
+// Status describes the pause state, empty when the upload runs
+func (c *uploadControl) Status() string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	switch {
+	case c.userPaused:
+		return "paused"
+	case c.jobsPaused != "":
+		return "paused: " + c.jobsPaused
+	}
+	return ""
+}
+
+// Wait blocks while the upload is paused
+func (c *uploadControl) Wait(ctx context.Context) error {
+	c.mu.Lock()
+	resume := c.resume
+	c.mu.Unlock()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-resume:
+		return nil
+	}
+}
+
+// startAsset gives the context for an asset that can be skipped by the user.
+// The returned function must be called at the end of the asset processing.
+func (c *uploadControl) startAsset(ctx context.Context) (context.Context, func()) {
+	ctx, cancel := context.WithCancelCause(ctx)
+	c.mu.Lock()
+	c.skip = cancel
+	c.mu.Unlock()
+	return ctx, func() {
+		c.mu.Lock()
+		c.skip = nil
+		c.mu.Unlock()
+		cancel(nil)
+	}
+}
+
+// Skip cancels the asset being uploaded. It returns false when there is nothing to skip.
+func (c *uploadControl) Skip() bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.skip == nil {
+		return false
+	}
+	c.skip(errAssetSkipped)
+	c.skip = nil
+	return true
+}
+
+// isSkipped tells if the asset's context has been cancelled by the user
+func isSkipped(ctx context.Context) bool {
+	return errors.Is(context.Cause(ctx), errAssetSkipped)
+}
+
+// jobThresholds gives the maximum number of active and waiting jobs per server's queue
+type jobThresholds map[string]int
+
+// Set parses a list of queue:threshold separated by commas
+func (t jobThresholds) Set(s string) error {
+	for _, item := range strings.Split(s, ",") {
+		item = strings.TrimSpace(item)
+		if item == "" {
+			continue
+		}
+		queue, value, found := strings.Cut(item, ":")
+		if !found {
+			return fmt.Errorf("invalid job threshold %q, expecting queue:count", item)
+		}
+		n, err := strconv.Atoi(strings.TrimSpace(value))
+		if err != nil || n < 0 {
+			return fmt.Errorf("invalid job threshold %q, expecting queue:count", item)
+		}
+		t[strings.TrimSpace(queue)] = n
+	}
+	return nil
+}
+
+func (t jobThresholds) String() string {
+	queues := make([]string, 0, len(t))
+	for q := range t {
+		queues = append(queues, q)
+	}
+	sort.Strings(queues)
+	s := strings.Builder{}
+	for i, q := range queues {
+		if i > 0 {
+			s.WriteRune(',')
+		}
+		s.WriteString(fmt.Sprintf("%s:%d", q, t[q]))
+	}
+	return s.String()
+}
+
+// exceeded lists the queues above their threshold
+func (t jobThresholds) exceeded(jobs map[string]immich.Job) string {
+	queues := []string{}
+	for q, max := range t {
+		j, ok := jobs[q]
+		if !ok {
+			continue
+		}
+		if n := j.JobCounts.Active + j.JobCounts.Waiting; n > max {
+			queues = append(queues, fmt.Sprintf("%s %d>%d", q, n, max))
+		}
+	}
+	sort.Strings(queues)
+	return strings.Join(queues, ", ")
+}
+
+// checkJobQueues pauses the upload while the server's queues are above the thresholds
+func (app *UpCmd) checkJobQueues(jobs map[string]immich.Job) {
+	if len(app.PauseOnJobs) == 0 {
+		return
+	}
+	reason := app.PauseOnJobs.exceeded(jobs)
+	prev := app.control.SetJobsPause(reason)
+	switch {
+	case reason != "" && prev == "":
+		app.Log.Info("Upload paused, server's jobs: " + reason)
+	case reason == "" && prev != "":
+		app.Log.Info("Upload resumed, the server's jobs have caught up")
+	}
+}
+
+// watchJobQueues polls the server's queues when the UI doesn't do it
+func (app *UpCmd) watchJobQueues(ctx context.Context) {
+	if len(app.PauseOnJobs) == 0 {
+		return
+	}
+	if _, err := app.Immich.GetJobs(ctx); err != nil {
+		app.Log.Warn(fmt.Sprintf("can't watch the server's jobs, the option -pause-on-jobs is ignored: %s", err))
+		return
+	}
+	tick := time.NewTicker(2 * time.Second)
+	defer tick.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-tick.C:
+			jobs, err := app.Immich.GetJobs(ctx)
+			if err == nil {
+				app.checkJobQueues(jobs)
+			}
+		}
+	}
+}
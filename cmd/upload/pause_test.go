@@ -0,0 +1,89 @@
+package upload
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/simulot/immich-go/immich"
+)
+
+func TestUploadControlPause(t *testing.T) {
+	c := newUploadControl()
+	ctx := context.Background()
+
+	if err := c.Wait(ctx); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	c.TogglePause()
+	c.SetJobsPause("thumbnailGeneration 12>10")
+	released := make(chan error)
+	go func() {
+		released <- c.Wait(ctx)
+	}()
+
+	c.TogglePause()
+	select {
+	case <-released:
+		t.Fatal("the upload must stay paused while the job queues are busy")
+	case <-time.After(20 * time.Millisecond):
+	}
+
+	if prev := c.SetJobsPause(""); prev == "" {
+		t.Error("expecting the previous reason")
+	}
+	select {
+	case err := <-released:
+		if err != nil {
+			t.Errorf("unexpected error: %s", err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("the upload should be resumed")
+	}
+}
+
+func TestUploadControlSkip(t *testing.T) {
+	c := newUploadControl()
+	if c.Skip() {
+		t.Error("nothing to skip")
+	}
+	ctx, done := c.startAsset(context.Background())
+	if !c.Skip() {
+		t.Error("the asset should be skipped")
+	}
+	done()
+	if !isSkipped(ctx) {
+		t.Error("the cause of the cancellation should be the skip")
+	}
+
+	ctx, done = c.startAsset(context.Background())
+	done()
+	if isSkipped(ctx) {
+		t.Error("the asset wasn't skipped")
+	}
+}
+
+func TestJobThresholds(t *testing.T) {
+	th := jobThresholds{}
+	if err := th.Set("thumbnailGeneration:10, faceDetection:5"); err != nil {
+		t.Fatal(err)
+	}
+	if err := th.Set("videoConversion"); err == nil {
+		t.Error("expecting an error for a missing count")
+	}
+	if th.String() != "faceDetection:5,thumbnailGeneration:10" {
+		t.Errorf("unexpected value: %s", th.String())
+	}
+
+	jobs := map[string]immich.Job{}
+	j := immich.Job{}
+	j.JobCounts.Active, j.JobCounts.Waiting = 4, 7
+	jobs["thumbnailGeneration"] = j
+	j.JobCounts.Active, j.JobCounts.Waiting = 1, 2
+	jobs["faceDetection"] = j
+
+	if r := th.exceeded(jobs); r != "thumbnailGeneration 11>10" {
+		t.Errorf("unexpected result: %q", r)
+	}
+}
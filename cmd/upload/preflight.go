@@ -0,0 +1,111 @@
+package upload
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/simulot/immich-go/browser"
+	"github.com/simulot/immich-go/ui"
+)
+
+// spaceEstimate is the result of the pre-flight check
+type spaceEstimate struct {
+	Assets int   // Number of assets to be uploaded
+	Needed int64 // Bytes to be uploaded
+	Usage  int64 // Bytes already used by the user
+	Quota  int64 // User's quota in bytes, 0 when unlimited
+}
+
+// Projected gives the user's storage usage after the upload
+func (e spaceEstimate) Projected() int64 {
+	return e.Usage + e.Needed
+}
+
+// Fits tells if the upload fits in the user's quota
+func (e spaceEstimate) Fits() bool {
+	return e.Quota == 0 || e.Projected() <= e.Quota
+}
+
+func (e spaceEstimate) String() string {
+	s := fmt.Sprintf("Pre-flight check: %d assets to upload (%s), current usage %s", e.Assets, ui.FormatBytes(int(e.Needed)), ui.FormatBytes(int(e.Usage)))
+	if e.Quota == 0 {
+		return s + ", no quota"
+	}
+	return s + fmt.Sprintf(", projected usage %s of %s (%d%%)", ui.FormatBytes(int(e.Projected())), ui.FormatBytes(int(e.Quota)), 100*e.Projected()/e.Quota)
+}
+
+// preflight sums the size of the assets that are not yet on the server and selected by the options,
+// and compares the total with the user's quota.
+//
+// It returns nil when the browser can't enumerate the assets before browsing them.
+// An error is returned when the upload doesn't fit the quota and -require-space is set.
+func (app *UpCmd) preflight(ctx context.Context) (*spaceEstimate, error) {
+	inv, ok := app.browser.(browser.Inventory)
+	if !ok {
+		return nil, nil
+	}
+
+	e := spaceEstimate{}
+	seen := map[string]any{}
+	err := inv.Inventory(ctx, func(a *browser.LocalAssetFile) error {
+		if app.excluded(a) != "" {
+			return nil
+		}
+		// the date of capture may be known only when reading the file, the asset is counted
+		if !a.Metadata.DateTaken.IsZero() && app.outOfDateRange(a) != "" {
+			return nil
+		}
+		if app.retry != nil && !app.retry.Match(a) {
+			return nil
+		}
+		size := int64(a.FileSize)
+		id := fmt.Sprintf("%s-%d", a.Title, size)
+		if _, exists := seen[id]; exists {
+			return nil
+		}
+		seen[id] = nil
+		if app.AssetIndex != nil && app.AssetIndex.HasAsset(a.Title, size) {
+			return nil
+		}
+		e.Assets++
+		e.Needed += size
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	user, err := app.Immich.ValidateConnection(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("can't get the user's quota: %w", err)
+	}
+	e.Usage = user.QuotaUsageInBytes
+	if user.QuotaSizeInBytes != nil {
+		e.Quota = *user.QuotaSizeInBytes
+	}
+
+	// Older servers don't give the usage in the user's record. The server statistics are available to admins only.
+	if e.Usage == 0 {
+		if stats, err := app.Immich.GetServerStatistics(ctx); err == nil {
+			for _, u := range stats.UsageByUser {
+				if u.UserID != user.ID {
+					continue
+				}
+				e.Usage = u.Usage
+				if q, ok := u.QuotaSizeInBytes.(float64); ok && e.Quota == 0 {
+					e.Quota = int64(q)
+				}
+			}
+		}
+	}
+
+	app.Log.Info(e.String())
+	if !e.Fits() {
+		msg := fmt.Sprintf("the upload of %s exceeds the user's quota of %s (current usage: %s)", ui.FormatBytes(int(e.Needed)), ui.FormatBytes(int(e.Quota)), ui.FormatBytes(int(e.Usage)))
+		if app.RequireSpace {
+			return &e, fmt.Errorf("%s. Upload aborted", msg)
+		}
+		app.Log.Warn(msg)
+	}
+	return &e, nil
+}
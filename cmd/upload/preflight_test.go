@@ -0,0 +1,108 @@
+package upload
+
+import (
+	"context"
+	"io"
+	"log/slog"
+	"testing"
+	"time"
+
+	"github.com/simulot/immich-go/cmd"
+	"github.com/simulot/immich-go/helpers/fileevent"
+	"github.com/simulot/immich-go/immich"
+)
+
+type icWithQuota struct {
+	icCatchUploadsAssets
+	quota  int64
+	usage  int64
+	server []*immich.Asset
+}
+
+func (c *icWithQuota) GetAllAssetsWithFilter(ctx context.Context, fn func(*immich.Asset) error) error {
+	for _, a := range c.server {
+		if err := fn(a); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (c *icWithQuota) ValidateConnection(ctx context.Context) (immich.User, error) {
+	return immich.User{QuotaSizeInBytes: &c.quota, QuotaUsageInBytes: c.usage}, nil
+}
+
+func TestPreflight(t *testing.T) {
+	testCases := []struct {
+		name         string
+		args         []string
+		quota        int64
+		server       []*immich.Asset
+		expectedErr  bool
+		expectUpload bool
+	}{
+		{
+			name:         "fits",
+			args:         []string{"-require-space", "TEST_DATA/folder/low/PXL_20231006_063000139.jpg"},
+			quota:        1 << 30,
+			expectUpload: true,
+		},
+		{
+			name:         "exceeds, warning only",
+			args:         []string{"TEST_DATA/folder/low/PXL_20231006_063000139.jpg"},
+			quota:        1024,
+			expectUpload: true,
+		},
+		{
+			name:        "exceeds, required",
+			args:        []string{"-require-space", "TEST_DATA/folder/low/PXL_20231006_063000139.jpg"},
+			quota:       1024,
+			expectedErr: true,
+		},
+		{
+			name:  "out of the date range, not counted",
+			args:  []string{"-require-space", "-date=2020", "TEST_DATA/folder/low/PXL_20231006_063000139.jpg"},
+			quota: 1024,
+		},
+		{
+			name:  "excluded extension, not counted",
+			args:  []string{"-require-space", "-exclude-types=.jpg", "TEST_DATA/folder/low/PXL_20231006_063000139.jpg"},
+			quota: 1024,
+		},
+		{
+			name:  "already on the server, not counted",
+			args:  []string{"-require-space", "TEST_DATA/folder/low/PXL_20231006_063000139.jpg"},
+			quota: 1024,
+			// the older servers give the name without its extension
+			server: []*immich.Asset{{
+				ID:               "1",
+				OriginalFileName: "PXL_20231006_063000139",
+				OriginalPath:     "upload/library/admin/2023/PXL_20231006_063000139.jpg",
+				ExifInfo:         immich.ExifInfo{FileSizeInByte: 136452, DateTimeOriginal: immich.ImmichTime{Time: time.Date(2023, 10, 6, 6, 30, 0, 0, time.UTC)}},
+			}},
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			ic := &icWithQuota{
+				icCatchUploadsAssets: icCatchUploadsAssets{albums: map[string][]string{}},
+				quota:                tc.quota,
+				usage:                512,
+				server:               tc.server,
+			}
+			log := slog.New(slog.NewTextHandler(io.Discard, nil))
+			serv := cmd.SharedFlags{
+				Immich: ic,
+				Jnl:    fileevent.NewRecorder(log, false),
+				Log:    log,
+			}
+			err := UploadCommand(context.Background(), &serv, append([]string{"-no-ui"}, tc.args...))
+			if tc.expectedErr != (err != nil) {
+				t.Errorf("unexpected error condition: %v, %v", tc.expectedErr, err)
+			}
+			if tc.expectUpload != (len(ic.assets) > 0) {
+				t.Errorf("unexpected upload: %v", ic.assets)
+			}
+		})
+	}
+}
@@ -0,0 +1,246 @@
+package upload
+
+import (
+	"fmt"
+	"image"
+	_ "image/gif"  // register the GIF decoder for image.DecodeConfig
+	_ "image/jpeg" // register the JPEG decoder for image.DecodeConfig
+	_ "image/png"  // register the PNG decoder for image.DecodeConfig
+	"path"
+	"strings"
+
+	"github.com/simulot/immich-go/browser"
+	"github.com/simulot/immich-go/immich"
+	"github.com/simulot/immich-go/immich/metadata"
+)
+
+// qualityCriterion is a criterion used to compare the local copy of an asset with the server's one
+type qualityCriterion string
+
+const (
+	qualityPixels qualityCriterion = "PIXELS" // the biggest image wins
+	qualityFormat qualityCriterion = "FORMAT" // RAW > HEIC/AVIF/JXL/TIFF > JPEG > WEBP > PNG/GIF/BMP
+	qualityDepth  qualityCriterion = "DEPTH"  // the deepest colors of the format win
+	qualitySize   qualityCriterion = "SIZE"   // the biggest file wins
+)
+
+var qualityCriteria = []qualityCriterion{qualityPixels, qualityFormat, qualityDepth, qualitySize}
+
+// qualityPolicy lists the criteria in their order of importance.
+// A criterion unknown for one of the copies is ignored.
+// It implements the flag.Value interface, the value is a comma separated list.
+type qualityPolicy []qualityCriterion
+
+var defaultQualityPolicy = qualityPolicy{qualityPixels, qualityFormat, qualityDepth, qualitySize}
+
+func (p qualityPolicy) String() string {
+	s := []string{}
+	for _, c := range p {
+		s = append(s, strings.ToLower(string(c)))
+	}
+	return strings.Join(s, ",")
+}
+
+func (p *qualityPolicy) Set(s string) error {
+	policy := qualityPolicy{}
+	for _, c := range strings.Split(s, ",") {
+		c = strings.ToUpper(strings.TrimSpace(c))
+		if c == "" {
+			continue
+		}
+		known := false
+		for _, k := range qualityCriteria {
+			if qualityCriterion(c) == k {
+				known = true
+				break
+			}
+		}
+		if !known {
+			return fmt.Errorf("unknown quality criterion %q, expecting pixels, format, depth or size", c)
+		}
+		policy = append(policy, qualityCriterion(c))
+	}
+	if len(policy) == 0 {
+		return fmt.Errorf("the quality policy needs at least one criterion")
+	}
+	*p = policy
+	return nil
+}
+
+// needsContent tells if the policy reads the content of the local file
+func (p qualityPolicy) needsContent() bool {
+	for _, c := range p {
+		if c == qualityPixels {
+			return true
+		}
+	}
+	return false
+}
+
+// copyQuality describes a copy of an asset. Zero values are unknown.
+type copyQuality struct {
+	kind          string // image or video
+	width, height int
+	ext           string
+	depth         int
+	size          int
+}
+
+func (q copyQuality) pixels() int { return q.width * q.height }
+
+// formatRank ranks the file formats, 0 when unknown
+func formatRank(ext string) int {
+	switch strings.ToLower(ext) {
+	case ".3fr", ".ari", ".arw", ".cap", ".cin", ".cr2", ".cr3", ".crw", ".dcr", ".dng", ".erf", ".fff", ".iiq",
+		".k25", ".kdc", ".mrw", ".nef", ".nrw", ".orf", ".ori", ".pef", ".raf", ".raw", ".rw2", ".rwl", ".sr2", ".srf", ".srw", ".x3f":
+		return 5
+	case ".heic", ".heif", ".hif", ".avif", ".jxl", ".tif", ".tiff":
+		return 4
+	case ".jpg", ".jpeg", ".jpe":
+		return 3
+	case ".webp":
+		return 2
+	case ".png", ".gif", ".bmp":
+		return 1
+	}
+	return 0
+}
+
+// formatDepth gives the usual bits per sample of the format, 0 when unknown.
+// The depth is given by the format for both copies, the EXIF often describes the preview.
+func formatDepth(ext string) int {
+	switch formatRank(ext) {
+	case 5:
+		return 12
+	case 4:
+		return 10
+	case 3, 2, 1:
+		return 8
+	}
+	return 0
+}
+
+// mediaType gives the type of the file, image or video, given by its extension
+func mediaType(ext string) string {
+	return immich.DefaultSupportedMedia.TypeFromExt(ext)
+}
+
+var formatAliases = map[string]string{".jpeg": ".jpg", ".jpe": ".jpg", ".tiff": ".tif", ".heif": ".heic", ".hif": ".heic"}
+
+// sameFormat tells if the extensions are the ones of the same file format
+func sameFormat(ext1, ext2 string) bool {
+	canonical := func(ext string) string {
+		ext = strings.ToLower(ext)
+		if a, ok := formatAliases[ext]; ok {
+			return a
+		}
+		return ext
+	}
+	return canonical(ext1) == canonical(ext2)
+}
+
+// rawJpgPair tells if the extensions are the ones of a RAW file and of its JPEG
+func rawJpgPair(ext1, ext2 string) bool {
+	r1, r2 := formatRank(ext1), formatRank(ext2)
+	return r1 == 5 && r2 == 3 || r1 == 3 && r2 == 5
+}
+
+// serverQuality describes the server's copy
+func serverQuality(sa *immich.Asset) copyQuality {
+	name := sa.OriginalPath
+	if name == "" {
+		name = sa.OriginalFileName
+	}
+	ext := path.Ext(name)
+	kind := strings.ToLower(sa.Type) // IMAGE or VIDEO
+	if kind == "" {
+		kind = mediaType(ext)
+	}
+	return copyQuality{
+		kind:   kind,
+		width:  sa.ExifInfo.ExifImageWidth,
+		height: sa.ExifInfo.ExifImageHeight,
+		ext:    ext,
+		depth:  formatDepth(ext),
+		size:   sa.ExifInfo.FileSizeInByte,
+	}
+}
+
+// localQuality describes the local copy. The dimensions are read from the file when the policy needs them.
+func localQuality(la *browser.LocalAssetFile, p qualityPolicy) copyQuality {
+	ext := path.Ext(la.FileName)
+	q := copyQuality{
+		kind:  mediaType(ext),
+		ext:   ext,
+		depth: formatDepth(ext),
+		size:  int(la.Size()),
+	}
+	if !p.needsContent() || formatRank(ext) == 0 {
+		return q
+	}
+	if r, err := la.PartialSourceReader(); err == nil {
+		if m, err := metadata.GetFromReader(r, ext); err == nil || m.Width > 0 {
+			q.width, q.height = m.Width, m.Height
+		}
+	}
+	if q.width == 0 || q.height == 0 {
+		// the EXIF doesn't give the dimensions, read them in the image header
+		if r, err := la.PartialSourceReader(); err == nil {
+			if c, _, err := image.DecodeConfig(r); err == nil {
+				q.width, q.height = c.Width, c.Height
+			}
+		}
+	}
+	return q
+}
+
+// values gives the values of the criterion for both copies, and their descriptions
+func (c qualityCriterion) values(local, server copyQuality) (l, s int, lDesc, sDesc string) {
+	switch c {
+	case qualityPixels:
+		l, s = local.pixels(), server.pixels()
+		lDesc, sDesc = fmt.Sprintf("%dx%d", local.width, local.height), fmt.Sprintf("%dx%d", server.width, server.height)
+	case qualityFormat:
+		l, s = formatRank(local.ext), formatRank(server.ext)
+		lDesc, sDesc = formatName(local.ext), formatName(server.ext)
+	case qualityDepth:
+		l, s = local.depth, server.depth
+		lDesc, sDesc = fmt.Sprintf("%d bits", local.depth), fmt.Sprintf("%d bits", server.depth)
+	case qualitySize:
+		l, s = local.size, server.size
+		lDesc, sDesc = formatBytes(local.size), formatBytes(server.size)
+	}
+	return l, s, lDesc, sDesc
+}
+
+// comparable tells if one criterion of the policy is known for both copies
+func (p qualityPolicy) comparable(local, server copyQuality) bool {
+	for _, c := range p {
+		if l, s, _, _ := c.values(local, server); l != 0 && s != 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// compare tells which copy is the best, following the policy.
+// It returns a positive value when the local copy is better, a negative one when the server's copy is better,
+// and 0 when they are equivalent. The criterion and the reason explain the decision.
+func (p qualityPolicy) compare(local, server copyQuality) (int, qualityCriterion, string) {
+	for _, c := range p {
+		l, s, lDesc, sDesc := c.values(local, server)
+		if l == 0 || s == 0 || l == s {
+			continue
+		}
+		reason := fmt.Sprintf("%s: local %s, server %s", strings.ToLower(string(c)), lDesc, sDesc)
+		if l > s {
+			return 1, c, reason
+		}
+		return -1, c, reason
+	}
+	return 0, "", ""
+}
+
+func formatName(ext string) string {
+	return strings.ToUpper(strings.TrimPrefix(ext, "."))
+}
@@ -0,0 +1,214 @@
+package upload
+
+import (
+	"os"
+	"strings"
+	"testing"
+	"testing/fstest"
+	"time"
+
+	"github.com/simulot/immich-go/browser"
+	"github.com/simulot/immich-go/immich"
+)
+
+func TestQualityPolicySet(t *testing.T) {
+	p := qualityPolicy{}
+	if err := p.Set("format, Size"); err != nil {
+		t.Fatal(err)
+	}
+	if p.String() != "format,size" {
+		t.Errorf("unexpected policy %s", p)
+	}
+	if err := p.Set("pixels,colors"); err == nil {
+		t.Error("expecting an error for an unknown criterion")
+	}
+	if err := p.Set(""); err == nil {
+		t.Error("expecting an error for an empty policy")
+	}
+}
+
+func TestQualityCompare(t *testing.T) {
+	tc := []struct {
+		name   string
+		policy qualityPolicy
+		local  copyQuality
+		server copyQuality
+		want   int
+		reason string
+	}{
+		{
+			name:   "bigger re-encode has fewer pixels",
+			policy: defaultQualityPolicy,
+			local:  copyQuality{width: 4000, height: 3000, ext: ".jpg", depth: 8, size: 3_000_000},
+			server: copyQuality{width: 2000, height: 1500, ext: ".jpg", depth: 8, size: 4_000_000},
+			want:   1,
+			reason: "pixels: local 4000x3000, server 2000x1500",
+		},
+		{
+			name:   "HEIC original smaller than its JPEG export",
+			policy: defaultQualityPolicy,
+			local:  copyQuality{width: 4032, height: 3024, ext: ".jpg", depth: 8, size: 3_000_000},
+			server: copyQuality{width: 4032, height: 3024, ext: ".heic", depth: 10, size: 1_500_000},
+			want:   -1,
+			reason: "format: local JPG, server HEIC",
+		},
+		{
+			name:   "unknown dimensions fall back on the size",
+			policy: defaultQualityPolicy,
+			local:  copyQuality{ext: ".jpg", depth: 8, size: 3_000_000},
+			server: copyQuality{width: 4032, height: 3024, ext: ".jpg", depth: 8, size: 2_000_000},
+			want:   1,
+			reason: "size: local 2.9 MB, server 1.9 MB",
+		},
+		{
+			name:   "size only",
+			policy: qualityPolicy{qualitySize},
+			local:  copyQuality{ext: ".dng", size: 1000},
+			server: copyQuality{ext: ".jpg", size: 2000},
+			want:   -1,
+			reason: "size: local 1000 B, server 2.0 KB",
+		},
+		{
+			name:   "same",
+			policy: defaultQualityPolicy,
+			local:  copyQuality{width: 10, height: 10, ext: ".jpg", depth: 8, size: 1000},
+			server: copyQuality{width: 10, height: 10, ext: ".jpg", depth: 8, size: 1000},
+			want:   0,
+		},
+	}
+	for _, c := range tc {
+		t.Run(c.name, func(t *testing.T) {
+			got, _, reason := c.policy.compare(c.local, c.server)
+			if got != c.want || reason != c.reason {
+				t.Errorf("got %d %q, want %d %q", got, reason, c.want, c.reason)
+			}
+		})
+	}
+}
+
+func TestShouldUploadQuality(t *testing.T) {
+	const name = "PXL_20231006_063000139.jpg"
+	fsys := os.DirFS("TEST_DATA/folder/high/AlbumA")
+	date := time.Date(2023, 10, 6, 6, 30, 0, 0, time.UTC)
+	la := &browser.LocalAssetFile{FSys: fsys, FileName: name, Title: name, FileSize: 147869}
+	la.Metadata.DateTaken = date
+	defer la.Close()
+
+	q := localQuality(la, defaultQualityPolicy)
+	if q.pixels() == 0 {
+		t.Fatalf("the dimensions should be read from the file")
+	}
+
+	// the server has a bigger file, but with fewer pixels
+	ai := AssetIndex{
+		assets: []*immich.Asset{{
+			ID:               "1",
+			OriginalFileName: name,
+			ExifInfo: immich.ExifInfo{
+				FileSizeInByte:   500_000,
+				ExifImageWidth:   q.width / 2,
+				ExifImageHeight:  q.height / 2,
+				DateTimeOriginal: immich.ImmichTime{Time: date},
+			},
+		}},
+	}
+	ai.ReIndex()
+	advice, err := ai.ShouldUpload(la)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if advice.Advice != SmallerOnServer || !strings.Contains(advice.Message, "pixels:") {
+		t.Errorf("expecting the server's asset to be replaced, got %s: %s", advice.Advice, advice.Message)
+	}
+
+	ai.policy = qualityPolicy{qualitySize}
+	advice, _ = ai.ShouldUpload(la)
+	if advice.Advice != BetterOnServer {
+		t.Errorf("expecting the server's asset to be kept with a size policy, got %s: %s", advice.Advice, advice.Message)
+	}
+
+	// the server has the HEIC original of the local JPEG export
+	ai = AssetIndex{
+		assets: []*immich.Asset{{
+			ID:               "2",
+			OriginalFileName: "PXL_20231006_063000139",
+			OriginalPath:     "upload/library/admin/2023/PXL_20231006_063000139.HEIC",
+			ExifInfo: immich.ExifInfo{
+				FileSizeInByte:   100_000,
+				ExifImageWidth:   q.width,
+				ExifImageHeight:  q.height,
+				DateTimeOriginal: immich.ImmichTime{Time: date},
+			},
+		}},
+	}
+	ai.ReIndex()
+	advice, _ = ai.ShouldUpload(la)
+	if advice.Advice != BetterOnServer || !strings.Contains(advice.Message, "format: local JPG, server HEIC") {
+		t.Errorf("expecting the server's HEIC to be kept, got %s: %s", advice.Advice, advice.Message)
+	}
+
+	// the RAW and the JPEG are stacked
+	ai.assets[0].OriginalPath = "upload/library/admin/2023/PXL_20231006_063000139.DNG"
+	ai.rawJpg = true
+	ai.ReIndex()
+	advice, _ = ai.ShouldUpload(la)
+	if advice.Advice != NotOnServer {
+		t.Errorf("expecting the JPEG of the RAW file to be uploaded, got %s: %s", advice.Advice, advice.Message)
+	}
+}
+
+func TestShouldUploadLivePhoto(t *testing.T) {
+	date := time.Date(2023, 10, 6, 6, 30, 0, 0, time.UTC)
+	serverAsset := func(id, name, kind string, size int) *immich.Asset {
+		return &immich.Asset{
+			ID:               id,
+			Type:             kind,
+			OriginalFileName: name,
+			OriginalPath:     "upload/library/admin/2023/" + name,
+			ExifInfo:         immich.ExifInfo{FileSizeInByte: size, DateTimeOriginal: immich.ImmichTime{Time: date}},
+		}
+	}
+	// the video is listed first, and it's smaller than the local photo
+	livePhoto := []*immich.Asset{
+		serverAsset("mov", "IMG_0001.MOV", "VIDEO", 1000),
+		serverAsset("heic", "IMG_0001.HEIC", "IMAGE", 2000),
+	}
+	tc := []struct {
+		name   string
+		file   string
+		size   int
+		server []*immich.Asset
+		advice AdviceCode
+		id     string
+	}{
+		{name: "photo of the pair", file: "IMG_0001.HEIC", size: 2000, server: livePhoto, advice: SameOnServer, id: "heic"},
+		{name: "video of the pair", file: "IMG_0001.MOV", size: 1000, server: livePhoto, advice: SameOnServer, id: "mov"},
+		{name: "photo beside the video", file: "IMG_0001.HEIC", size: 2000, server: livePhoto[:1], advice: NotOnServer},
+		{name: "bigger photo", file: "IMG_0001.HEIC", size: 3000, server: livePhoto, advice: NotOnServer},
+		{name: "bigger photo in another format", file: "IMG_0001.HEIC", size: 3000, server: []*immich.Asset{serverAsset("jpg", "IMG_0001.JPG", "IMAGE", 1000)}, advice: NotOnServer},
+	}
+	for _, c := range tc {
+		t.Run(c.name, func(t *testing.T) {
+			fsys := fstest.MapFS{c.file: &fstest.MapFile{Data: make([]byte, c.size)}}
+			la := &browser.LocalAssetFile{FSys: fsys, FileName: c.file, Title: c.file, FileSize: c.size}
+			la.Metadata.DateTaken = date
+			defer la.Close()
+
+			ai := AssetIndex{assets: c.server}
+			ai.ReIndex()
+			advice, err := ai.ShouldUpload(la)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if advice.Advice != c.advice {
+				t.Errorf("expecting %s, got %s: %s", c.advice, advice.Advice, advice.Message)
+			}
+			if c.id != "" && (advice.ServerAsset == nil || advice.ServerAsset.ID != c.id) {
+				t.Errorf("expecting the server's asset %s, got %+v", c.id, advice.ServerAsset)
+			}
+			if c.advice == NotOnServer && advice.ServerAsset != nil {
+				t.Errorf("the server's asset %s must not be replaced", advice.ServerAsset.ID)
+			}
+		})
+	}
+}
@@ -0,0 +1,205 @@
+package upload
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/simulot/immich-go/browser"
+	"github.com/simulot/immich-go/cmd"
+	"github.com/simulot/immich-go/helpers/configuration"
+	"github.com/simulot/immich-go/helpers/fileevent"
+	"github.com/simulot/immich-go/helpers/stacking"
+	"github.com/simulot/immich-go/immich"
+	"golang.org/x/sync/errgroup"
+)
+
+// newReplicaClient opens the connection to a replica server.
+// Tests replace it by a stub.
+var newReplicaClient = func(ctx context.Context, app *cmd.SharedFlags, conf configuration.Configuration) (immich.ImmichInterface, error) {
+	server := conf.ServerURL
+	if server == "" {
+		server = conf.APIURL
+	}
+	ic, err := immich.NewImmichClient(server, conf.APIKey, immich.OptionVerifySSL(app.SkipSSL), immich.OptionConnectionTimeout(app.ClientTimeout))
+	if err != nil {
+		return nil, err
+	}
+	if conf.APIURL != "" {
+		ic.SetEndPoint(conf.APIURL)
+	}
+	if app.DeviceUUID != "" {
+		ic.SetDeviceUUID(app.DeviceUUID)
+	}
+	err = ic.PingServer(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return ic, nil
+}
+
+// replicaConfigurations gives the connection details of the replicas given
+// with -replica-server/-replica-key pairs and -replica-config files
+func (app *UpCmd) replicaConfigurations() ([]configuration.Configuration, error) {
+	if len(app.ReplicaServers) != len(app.ReplicaKeys) {
+		return nil, fmt.Errorf("each -replica-server needs its -replica-key")
+	}
+	confs := []configuration.Configuration{}
+	for i := range app.ReplicaServers {
+		confs = append(confs, configuration.Configuration{
+			ServerURL: app.ReplicaServers[i],
+			APIKey:    app.ReplicaKeys[i],
+		})
+	}
+	for _, f := range app.ReplicaConfigs {
+		conf, err := configuration.ConfigRead(f)
+		if err != nil {
+			return nil, fmt.Errorf("can't read the replica configuration %q: %w", f, err)
+		}
+		if conf.ServerURL == "" && conf.APIURL == "" || conf.APIKey == "" {
+			return nil, fmt.Errorf("the replica configuration %q needs a server and a key", f)
+		}
+		confs = append(confs, conf)
+	}
+	return confs, nil
+}
+
+// openReplicas connects to the replica servers. Each replica is a copy of the upload command
+// with its own client, journal, asset index and albums.
+func (app *UpCmd) openReplicas(ctx context.Context) error {
+	confs, err := app.replicaConfigurations()
+	if err != nil {
+		return err
+	}
+	for _, conf := range confs {
+		ic, err := newReplicaClient(ctx, app.SharedFlags, conf)
+		if err != nil {
+			return fmt.Errorf("can't connect to the replica %s: %w", conf.ServerURL, err)
+		}
+		user, err := ic.ValidateConnection(ctx)
+		if err != nil {
+			return fmt.Errorf("can't connect to the replica %s: %w", conf.ServerURL, err)
+		}
+		if app.DryRun {
+			ic = immich.NewDryRunClient(ic)
+		}
+
+		sf := *app.SharedFlags
+		sf.Server = conf.ServerURL
+		sf.API = conf.APIURL
+		sf.Key = conf.APIKey
+		sf.Immich = ic
+		sf.Jnl = fileevent.NewRecorder(nil, app.DebugCounters)
+
+		r := *app
+		r.SharedFlags = &sf
+		r.replicas = nil
+		r.albums = nil
+		r.orderedAlbums = nil
+		r.AssetIndex = nil
+		r.deleteServerList = nil
+		r.deleteLocalList = nil
+		r.stacks = nil
+		app.replicas = append(app.replicas, &r)
+		r.setReplicaLog()
+		app.Log.Info(fmt.Sprintf("Replica %s, user: %s", r.replicaName(), user.Email))
+	}
+	return nil
+}
+
+// replicaName identifies the replica in logs and reports
+func (app *UpCmd) replicaName() string {
+	if app.Server != "" {
+		return app.Server
+	}
+	return app.API
+}
+
+// setReplicaLog makes the replica use the command's log, tagged with the replica's name
+func (app *UpCmd) setReplicaLog() {
+	app.Log = app.Log.With("replica", app.replicaName())
+	app.Jnl.SetLogger(app.Log)
+}
+
+// syncReplicaLogs gives to the replicas the command's current logger
+func (app *UpCmd) syncReplicaLogs() {
+	for _, r := range app.replicas {
+		r.Log = app.Log
+		r.setReplicaLog()
+	}
+}
+
+// prepareReplicas gets the assets and the albums of each replica
+func (app *UpCmd) prepareReplicas(ctx context.Context) error {
+	grp := errgroup.Group{}
+	for _, r := range app.replicas {
+		r := r
+		grp.Go(func() error {
+			err := r.getImmichAssets(ctx, nil)
+			if err != nil {
+				return fmt.Errorf("replica %s: %w", r.replicaName(), err)
+			}
+			err = r.getImmichAlbums(ctx)
+			if err != nil {
+				return fmt.Errorf("replica %s: %w", r.replicaName(), err)
+			}
+			return nil
+		})
+	}
+	return grp.Wait()
+}
+
+// handleAssetOnTargets processes the asset on the main server and on each replica.
+// Each target gets its own copy of the asset, as the processing changes it.
+func (app *UpCmd) handleAssetOnTargets(ctx context.Context, a *browser.LocalAssetFile) error {
+	// the copies reopen the files by themselves
+	a.Close()
+	if a.LivePhoto != nil {
+		a.LivePhoto.Close()
+	}
+	for _, t := range append([]*UpCmd{app}, app.replicas...) {
+		b := *a
+		if a.LivePhoto != nil {
+			lp := *a.LivePhoto
+			b.LivePhoto = &lp
+		}
+		err := t.handleAsset(ctx, &b)
+		if b.LivePhoto != nil {
+			b.LivePhoto.Close()
+		}
+		if err != nil {
+			t.Jnl.Record(ctx, fileevent.Error, &b, b.FileName, "error", err.Error())
+		}
+		if ctx.Err() != nil {
+			return nil
+		}
+	}
+	return nil
+}
+
+// finishReplicas creates the replicas' stacks and deletes the assets marked for deletion
+func (app *UpCmd) finishReplicas(ctx context.Context) error {
+	for _, r := range app.replicas {
+		err := r.finishUpload(ctx)
+		if err != nil {
+			return fmt.Errorf("replica %s: %w", r.replicaName(), err)
+		}
+	}
+	return nil
+}
+
+// initReplicaStacks gives a stack builder to each replica
+func (app *UpCmd) initReplicaStacks() {
+	for _, r := range app.replicas {
+		if app.stacks != nil {
+			r.stacks = stacking.NewStackBuilder(r.Immich.SupportedMedia()).SetNameNormalizer(r.nameNormalizer())
+		}
+	}
+}
+
+// report prints the journal's report, followed by the upload's report of each replica
+func (app *UpCmd) report() {
+	app.Jnl.Report()
+	for _, r := range app.replicas {
+		r.Jnl.ReportUploads("Replica " + r.replicaName())
+	}
+}
@@ -0,0 +1,82 @@
+package upload
+
+import (
+	"context"
+	"io"
+	"log/slog"
+	"testing"
+
+	"github.com/kr/pretty"
+	"github.com/simulot/immich-go/cmd"
+	"github.com/simulot/immich-go/helpers/configuration"
+	"github.com/simulot/immich-go/helpers/fileevent"
+	"github.com/simulot/immich-go/immich"
+)
+
+func TestUploadReplicas(t *testing.T) {
+	replicas := map[string]*icCatchUploadsAssets{}
+	defer func(fn func(context.Context, *cmd.SharedFlags, configuration.Configuration) (immich.ImmichInterface, error)) {
+		newReplicaClient = fn
+	}(newReplicaClient)
+	newReplicaClient = func(ctx context.Context, app *cmd.SharedFlags, conf configuration.Configuration) (immich.ImmichInterface, error) {
+		ic := &icCatchUploadsAssets{albums: map[string][]string{}}
+		replicas[conf.ServerURL+"|"+conf.APIKey] = ic
+		return ic, nil
+	}
+
+	ic := &icCatchUploadsAssets{albums: map[string][]string{}}
+	log := slog.New(slog.NewTextHandler(io.Discard, nil))
+	serv := cmd.SharedFlags{
+		Immich: ic,
+		Jnl:    fileevent.NewRecorder(log, false),
+		Log:    log,
+	}
+	err := UploadCommand(context.Background(), &serv, []string{
+		"-no-ui",
+		"-replica-server=http://replica1", "-replica-key=key1",
+		"-replica-server=http://replica2", "-replica-key=key2",
+		"-google-photos", "-trashed=trash", "TEST_DATA/Takeout4",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expectedAssets := []string{
+		"Google Photos/Trip/PXL_20231006_063000139.jpg",
+		"Google Photos/Trip/PXL_20231006_063029647.jpg",
+	}
+	expectedAlbums := map[string][]string{
+		"Trip": {"Google Photos/Trip/PXL_20231006_063000139.jpg"},
+	}
+
+	if len(replicas) != 2 {
+		t.Fatalf("expecting 2 replicas, got %d", len(replicas))
+	}
+	for name, c := range map[string]*icCatchUploadsAssets{
+		"main":     ic,
+		"replica1": replicas["http://replica1|key1"],
+		"replica2": replicas["http://replica2|key2"],
+	} {
+		if c == nil {
+			t.Errorf("%s: missing target", name)
+			continue
+		}
+		if !cmpSlices(expectedAssets, c.assets) {
+			t.Errorf("%s: expected upload differs", name)
+			pretty.Ldiff(t, expectedAssets, c.assets)
+		}
+		if !cmpAlbums(expectedAlbums, c.albums) {
+			t.Errorf("%s: expected albums differs", name)
+			pretty.Ldiff(t, expectedAlbums, c.albums)
+		}
+	}
+}
+
+func TestReplicaConfigurations(t *testing.T) {
+	app := UpCmd{
+		ReplicaServers: []string{"http://replica1"},
+	}
+	if _, err := app.replicaConfigurations(); err == nil {
+		t.Error("expecting an error for a server without key")
+	}
+}
@@ -0,0 +1,154 @@
+package upload
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/simulot/immich-go/browser"
+	"github.com/simulot/immich-go/helpers/fileevent"
+	"github.com/simulot/immich-go/helpers/fshelper"
+)
+
+// retryList is the list of the files that have failed during a previous run
+type retryList struct {
+	files map[string]map[string]bool // sources by file name, the source is empty when unknown
+}
+
+// readRetryList reads the failed entries of a previous run's log file.
+// The log can be either the text log or the JSON log. The entries
+// "upload error" and "error" are retained.
+func readRetryList(name string) (*retryList, error) {
+	f, err := os.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	rl, err := parseRetryList(f)
+	if err != nil {
+		return nil, fmt.Errorf("can't read the failures from %q: %w", name, err)
+	}
+	return rl, nil
+}
+
+func parseRetryList(r io.Reader) (*retryList, error) {
+	rl := retryList{
+		files: map[string]map[string]bool{},
+	}
+	s := bufio.NewScanner(r)
+	s.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+	for s.Scan() {
+		line := strings.TrimSpace(s.Text())
+		if line == "" {
+			continue
+		}
+		var msg string
+		var attrs map[string]string
+		if strings.HasPrefix(line, "{") {
+			msg, attrs = parseJSONLogLine(line)
+		} else {
+			msg, attrs = parseTextLogLine(line)
+		}
+		switch msg {
+		case fileevent.UploadServerError.String(), fileevent.Error.String():
+		default:
+			continue
+		}
+		file := attrs["file"]
+		if file == "" {
+			continue
+		}
+		source := attrs["source"]
+		sources := rl.files[file]
+		if sources == nil {
+			sources = map[string]bool{}
+			rl.files[file] = sources
+		}
+		sources[source] = true
+	}
+	return &rl, s.Err()
+}
+
+// parseJSONLogLine decodes a line of the JSON log
+func parseJSONLogLine(line string) (string, map[string]string) {
+	var m map[string]any
+	if json.Unmarshal([]byte(line), &m) != nil {
+		return "", nil
+	}
+	attrs := map[string]string{}
+	for k, v := range m {
+		if s, ok := v.(string); ok {
+			attrs[k] = s
+		}
+	}
+	return attrs["msg"], attrs
+}
+
+// parseTextLogLine decodes a line of the text log:
+//
+//	ERROR | upload error | file="Google Photos/IMG_0001.jpg" error="..." time="..."
+func parseTextLogLine(line string) (string, map[string]string) {
+	parts := strings.SplitN(line, " | ", 3)
+	if len(parts) < 3 {
+		return "", nil
+	}
+	msg := strings.TrimSpace(parts[1])
+	attrs := map[string]string{}
+	rest := parts[2]
+	for {
+		rest = strings.TrimLeft(rest, " ")
+		k, v, found := strings.Cut(rest, "=")
+		if !found || k == "" {
+			break
+		}
+		if strings.HasPrefix(v, `"`) {
+			end := 1
+			for end < len(v) && v[end] != '"' {
+				if v[end] == '\\' {
+					end++
+				}
+				end++
+			}
+			if end >= len(v) {
+				break
+			}
+			value, err := strconv.Unquote(v[:end+1])
+			if err != nil {
+				break
+			}
+			attrs[k] = value
+			rest = v[end+1:]
+		} else {
+			value, next, _ := strings.Cut(v, " ")
+			attrs[k] = value
+			rest = next
+		}
+	}
+	return msg, attrs
+}
+
+// Len gives the number of files to retry
+func (rl *retryList) Len() int {
+	return len(rl.files)
+}
+
+// Match tells if the asset, or its live photo, has failed
+func (rl *retryList) Match(a *browser.LocalAssetFile) bool {
+	for _, la := range []*browser.LocalAssetFile{a, a.LivePhoto} {
+		if la == nil {
+			continue
+		}
+		sources, ok := rl.files[la.FileName]
+		if !ok {
+			continue
+		}
+		if sources[""] || sources[fshelper.SourceName(la.FSys)] {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,43 @@
+package upload
+
+import (
+	"strings"
+	"testing"
+	"testing/fstest"
+
+	"github.com/simulot/immich-go/browser"
+	"github.com/simulot/immich-go/helpers/fshelper"
+)
+
+func TestParseRetryList(t *testing.T) {
+	log := strings.Join([]string{
+		` INFO | uploaded successfully | file="Google Photos/Trip/IMG_001.jpg" time="2024-05-01T10:00:00+02:00"`,
+		`ERROR | upload error | file="Google Photos/Trip/IMG 002.jpg" source=takeout-001.zip error="server error: \"quota\"" time="2024-05-01T10:00:01+02:00"`,
+		`{"time":"2024-05-01T10:00:02+02:00","level":"ERROR","msg":"upload error","file":"Photos/IMG_003.jpg","source":"pictures","error":"timeout"}`,
+		`{"time":"2024-05-01T10:00:03+02:00","level":"INFO","msg":"uploaded successfully","file":"Photos/IMG_004.jpg"}`,
+		`not a log line`,
+	}, "\n")
+
+	rl, err := parseRetryList(strings.NewReader(log))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rl.Len() != 2 {
+		t.Errorf("expecting 2 files, got %d", rl.Len())
+	}
+	takeout := fshelper.NewFSWithName(fstest.MapFS{}, "takeout-001.zip")
+	other := fshelper.NewFSWithName(fstest.MapFS{}, "takeout-002.zip")
+	pictures := fshelper.NewFSWithName(fstest.MapFS{}, "pictures")
+	if !rl.Match(&browser.LocalAssetFile{FSys: pictures, FileName: "Photos/IMG_003.jpg"}) {
+		t.Error("IMG_003.jpg should be retried")
+	}
+	if rl.Match(&browser.LocalAssetFile{FSys: takeout, FileName: "Google Photos/Trip/IMG_001.jpg"}) {
+		t.Error("IMG_001.jpg should not be retried")
+	}
+	if !rl.Match(&browser.LocalAssetFile{FSys: takeout, FileName: "Google Photos/Trip/IMG 002.jpg"}) {
+		t.Error("the file of the archive takeout-001.zip should be retried")
+	}
+	if rl.Match(&browser.LocalAssetFile{FSys: other, FileName: "Google Photos/Trip/IMG 002.jpg"}) {
+		t.Error("the file of the archive takeout-002.zip should not be retried")
+	}
+}
@@ -0,0 +1,128 @@
+package upload
+
+import (
+	"context"
+	"fmt"
+	"path"
+	"sort"
+	"strings"
+
+	"github.com/simulot/immich-go/browser"
+	"github.com/simulot/immich-go/helpers/fileevent"
+	"github.com/simulot/immich-go/helpers/rules"
+	"github.com/simulot/immich-go/immich/metadata"
+)
+
+// ruleFacts gives the facts of the asset to the rules.
+// The embedded metadata are read only when a rule checks the camera or the GPS position.
+func ruleFacts(a *browser.LocalAssetFile) rules.Facts {
+	var embedded *metadata.Metadata
+	readEmbedded := func() metadata.Metadata {
+		if embedded == nil {
+			embedded = &metadata.Metadata{}
+			if r, err := a.PartialSourceReader(); err == nil {
+				*embedded, _ = metadata.GetFromReader(r, path.Ext(a.FileName))
+			}
+		}
+		return *embedded
+	}
+
+	return rules.Facts{
+		Name:     a.FileName,
+		Size:     int64(a.FileSize),
+		Date:     a.Metadata.DateTaken,
+		Favorite: a.Favorite,
+		Archived: a.Archived,
+		Trashed:  a.Trashed,
+		Partner:  a.FromPartner,
+		Camera: func() string {
+			m := readEmbedded()
+			return strings.TrimSpace(m.Make + " " + m.Model)
+		},
+		GPS: func() bool {
+			if a.Metadata.Latitude != 0 || a.Metadata.Longitude != 0 {
+				return true
+			}
+			m := readEmbedded()
+			return m.Latitude != 0 || m.Longitude != 0
+		},
+	}
+}
+
+// applyRules evaluates the rules on the asset, and applies the actions changing the asset.
+// It returns false when a rule skips the asset.
+func (app *UpCmd) applyRules(ctx context.Context, a *browser.LocalAssetFile) (rules.Result, bool) {
+	if app.rules == nil {
+		return rules.Result{}, true
+	}
+	res := app.rules.Evaluate(ruleFacts(a))
+	for _, name := range res.Matched {
+		app.Jnl.Record(ctx, fileevent.Ruled, a, a.FileName, "rule", name)
+	}
+	if res.Skip {
+		app.skipAsset(ctx, a, "rule", "skipped by the rule "+res.Matched[len(res.Matched)-1])
+		return res, false
+	}
+	if res.Archive {
+		a.Archived = true
+	}
+	if res.Favorite {
+		a.Favorite = true
+	}
+	if res.Description != nil {
+		a.Metadata.Description = *res.Description
+	}
+	return res, true
+}
+
+// ruleAlbums adds the albums given by the rules
+func ruleAlbums(albums []albumTarget, res rules.Result) []albumTarget {
+	for _, title := range res.Albums {
+		albums = append(albums, albumTarget{title: title, reason: "rule"})
+	}
+	return albums
+}
+
+// stackByRule registers the asset in the stack given by the rules
+func (app *UpCmd) stackByRule(res rules.Result, id string, name string) {
+	if res.StackWith == "" || id == "" {
+		return
+	}
+	if app.ruleStacks == nil {
+		app.ruleStacks = map[string][]ruleStackMember{}
+	}
+	app.ruleStacks[res.StackWith] = append(app.ruleStacks[res.StackWith], ruleStackMember{id: id, name: name})
+}
+
+type ruleStackMember struct {
+	id   string
+	name string
+}
+
+// createRuleStacks stacks the assets grouped by the rules, the first asset of a group is the cover
+func (app *UpCmd) createRuleStacks(ctx context.Context) {
+	keys := []string{}
+	for k, members := range app.ruleStacks {
+		if len(members) > 1 {
+			keys = append(keys, k)
+		}
+	}
+	if len(keys) == 0 {
+		return
+	}
+	sort.Strings(keys)
+	app.Log.Info("Creating the stacks given by the rules")
+	for _, k := range keys {
+		ids := []string{}
+		names := []string{}
+		for _, m := range app.ruleStacks[k] {
+			ids = append(ids, m.id)
+			names = append(names, m.name)
+		}
+		app.Log.Info(fmt.Sprintf("Stacking %s...", strings.Join(names, ", ")))
+		err := app.Immich.StackAssets(ctx, ids[0], ids)
+		if err != nil {
+			app.Log.Error(fmt.Sprintf("Can't stack images: %s", err))
+		}
+	}
+}
@@ -13,6 +13,7 @@ import (
 	"github.com/gdamore/tcell/v2"
 	"github.com/navidys/tvxwidgets"
 	"github.com/rivo/tview"
+	"github.com/simulot/immich-go/cmd"
 	"github.com/simulot/immich-go/helpers/fileevent"
 	"golang.org/x/sync/errgroup"
 )
@@ -35,6 +36,9 @@ type uiPage struct {
 	immichPrepare *tvxwidgets.PercentageModeGauge
 	immichUpload  *tvxwidgets.PercentageModeGauge
 
+	projectedUsage *tvxwidgets.PercentageModeGauge
+	projectedLabel *tview.TextView
+
 	// page      *tview.Application
 	watchJobs bool
 	// quitting  chan any
@@ -65,16 +69,32 @@ func (app *UpCmd) runUI(ctx context.Context) error {
 
 	pages.AddPage("ui", ui.screen, true, true)
 
-	// handle Ctrl+C and Ctrl+Q
+	// handle Ctrl+C and Ctrl+Q, pause and skip keys
 	uiApp.SetInputCapture(func(event *tcell.EventKey) *tcell.EventKey {
 		switch event.Key() {
 		case tcell.KeyCtrlQ, tcell.KeyCtrlC:
 			app.Log = ui.prevSlog
-			cancel(errors.New("interrupted: Ctrl+C or Ctrl+Q pressed"))
+			cancel(fmt.Errorf("%w: Ctrl+C or Ctrl+Q pressed", cmd.ErrInterrupted))
 		case tcell.KeyEnter:
 			if uploadDone.Load() {
 				stopUI(nil)
 			}
+		case tcell.KeyRune:
+			if uploadDone.Load() {
+				break
+			}
+			switch event.Rune() {
+			case 'p', 'P', ' ':
+				if app.control.TogglePause() {
+					app.Log.Info("Upload paused by the user")
+				} else {
+					app.Log.Info("Upload resumed by the user")
+				}
+			case 's', 'S':
+				if app.control.Skip() {
+					app.Log.Info("Skipping the current file")
+				}
+			}
 		}
 		return event
 	})
@@ -107,10 +127,13 @@ func (app *UpCmd) runUI(ctx context.Context) error {
 						if jobCount > 0 {
 							ui.lastTimeServerActive.Store(time.Now().Unix())
 						}
+						app.checkJobQueues(jobs)
 					}
 				}
 			}
 		}()
+	} else {
+		go app.watchJobQueues(ctx)
 	}
 
 	// force the ui to redraw counters
@@ -127,6 +150,11 @@ func (app *UpCmd) runUI(ctx context.Context) error {
 					for c := range ui.counts {
 						ui.getCountView(c, counts[c])
 					}
+					if status := app.control.Status(); status != "" {
+						ui.uploadCounts.SetTitle("Uploading (" + status + ")")
+					} else {
+						ui.uploadCounts.SetTitle("Uploading")
+					}
 					if app.GooglePhotos {
 						ui.immichPrepare.SetMaxValue(int(app.Jnl.TotalAssets()))
 						ui.immichPrepare.SetValue(int(app.Jnl.TotalProcessedGP()))
@@ -171,6 +199,13 @@ func (app *UpCmd) runUI(ctx context.Context) error {
 			}
 			return err
 		})
+		processGrp.Go(func() error {
+			err := app.prepareReplicas(ctx)
+			if err != nil {
+				stopUI(err)
+			}
+			return err
+		})
 		processGrp.Go(func() error {
 			// Run Prepare
 			err := app.browser.Prepare(ctx)
@@ -185,6 +220,18 @@ func (app *UpCmd) runUI(ctx context.Context) error {
 		if err != nil {
 			return context.Cause(ctx)
 		}
+
+		// Check the user's quota before uploading
+		estimate, err := app.preflight(ctx)
+		if err != nil {
+			stopUI(err)
+			return err
+		}
+		if estimate != nil {
+			uiApp.QueueUpdateDraw(func() {
+				ui.updateProjectedUsage(*estimate)
+			})
+		}
 		preparationDone.Store(true)
 
 		// we can upload assets
@@ -218,7 +265,7 @@ func (app *UpCmd) runUI(ctx context.Context) error {
 	}
 
 	// Time to leave
-	app.Jnl.Report()
+	app.report()
 	if messages.Len() > 0 {
 		return (errors.New(messages.String()))
 	}
@@ -268,7 +315,16 @@ func newUI(ctx context.Context, app *UpCmd) *uiPage {
 	ui.addCounter(ui.prepareCounts, 6, "Files with a sidecar", fileevent.AnalysisAssociatedMetadata)
 	ui.addCounter(ui.prepareCounts, 7, "Files without sidecar", fileevent.AnalysisMissingAssociatedMetadata)
 
-	ui.prepareCounts.SetSize(8, 2, 1, 1).SetColumns(30, 10)
+	prepareRows := 8
+	if app.incremental != nil {
+		ui.addCounter(ui.prepareCounts, prepareRows, "Unchanged since the last run", fileevent.DiscoveredUnchanged)
+		prepareRows++
+	}
+	if app.lostFiles > 0 {
+		ui.addCounter(ui.prepareCounts, prepareRows, "Lost in damaged archives", fileevent.DiscoveredLost)
+		prepareRows++
+	}
+	ui.prepareCounts.SetSize(prepareRows, 2, 1, 1).SetColumns(30, 10)
 
 	ui.uploadCounts = tview.NewGrid()
 	ui.uploadCounts.SetBorder(true).SetTitle("Uploading")
@@ -314,7 +370,8 @@ func newUI(ctx context.Context, app *UpCmd) *uiPage {
 		app.SetLogWriter(ui.logView)
 	}
 	app.SharedFlags.Jnl.SetLogger(app.SharedFlags.Log)
-	ui.logView.SetBorder(true).SetTitle("Log")
+	app.syncReplicaLogs()
+	ui.logView.SetBorder(true).SetTitle("Log - [p] pause/resume, [s] skip the current file, [Ctrl+Q] quit")
 	ui.screen.AddItem(ui.logView, 2, 0, 1, 1, 0, 0, false)
 
 	ui.immichReading = tvxwidgets.NewPercentageModeGauge()
@@ -332,19 +389,26 @@ func newUI(ctx context.Context, app *UpCmd) *uiPage {
 	ui.immichUpload.SetMaxValue(0)
 	ui.immichUpload.SetValue(0)
 
+	ui.projectedUsage = tvxwidgets.NewPercentageModeGauge()
+	ui.projectedUsage.SetRect(0, 0, 50, 1)
+	ui.projectedUsage.SetMaxValue(0)
+	ui.projectedUsage.SetValue(0)
+	ui.projectedLabel = tview.NewTextView().SetText("Projected usage:").SetTextAlign(tview.AlignCenter)
+
 	ui.footer = tview.NewGrid()
 	ui.footer.AddItem(tview.NewTextView().SetText("Immich content:").SetTextAlign(tview.AlignCenter), 0, 0, 1, 1, 0, 0, false).AddItem(ui.immichReading, 0, 1, 1, 1, 0, 0, false)
+	ui.footer.AddItem(ui.projectedLabel, 0, 2, 1, 1, 0, 0, false).AddItem(ui.projectedUsage, 0, 3, 1, 1, 0, 0, false)
 	if app.GooglePhotos {
-		ui.footer.AddItem(tview.NewTextView().SetText("Google Photo puzzle:").SetTextAlign(tview.AlignCenter), 0, 2, 1, 1, 0, 0, false).AddItem(ui.immichPrepare, 0, 3, 1, 1, 0, 0, false)
-		ui.footer.AddItem(tview.NewTextView().SetText("Uploading:").SetTextAlign(tview.AlignCenter), 0, 4, 1, 1, 0, 0, false).AddItem(ui.immichUpload, 0, 5, 1, 1, 0, 0, false)
-		ui.footer.SetColumns(25, 0, 25, 0, 25, 0)
+		ui.footer.AddItem(tview.NewTextView().SetText("Google Photo puzzle:").SetTextAlign(tview.AlignCenter), 0, 4, 1, 1, 0, 0, false).AddItem(ui.immichPrepare, 0, 5, 1, 1, 0, 0, false)
+		ui.footer.AddItem(tview.NewTextView().SetText("Uploading:").SetTextAlign(tview.AlignCenter), 0, 6, 1, 1, 0, 0, false).AddItem(ui.immichUpload, 0, 7, 1, 1, 0, 0, false)
+		ui.footer.SetColumns(25, 0, 25, 0, 25, 0, 25, 0)
 	} else {
-		ui.footer.SetColumns(25, 0)
+		ui.footer.SetColumns(25, 0, 25, 0)
 	}
 	ui.screen.AddItem(ui.footer, 3, 0, 1, 1, 0, 0, false)
 
 	// Adjust section's height
-	ui.screen.SetRows(4, 10, 0, 1)
+	ui.screen.SetRows(4, prepareRows+2, 0, 1)
 	return ui
 }
 
@@ -359,6 +423,21 @@ func (p *uiPage) updateImmichReading(value, total int) {
 	p.immichReading.SetValue(value)
 }
 
+// updateProjectedUsage shows the user's storage usage after the upload, in MB
+func (p *uiPage) updateProjectedUsage(e spaceEstimate) {
+	if e.Quota == 0 {
+		p.projectedLabel.SetText("Projected usage: no quota")
+		return
+	}
+	p.projectedUsage.SetMaxValue(int(e.Quota >> 20))
+	if !e.Fits() {
+		p.projectedLabel.SetText("Projected usage: OVER QUOTA")
+		p.projectedUsage.SetValue(int(e.Quota >> 20))
+		return
+	}
+	p.projectedUsage.SetValue(int(e.Projected() >> 20))
+}
+
 func (p *uiPage) getCountView(c fileevent.Code, count int64) *tview.TextView {
 	v, ok := p.counts[c]
 	if !ok {
@@ -11,11 +11,11 @@ import (
 	"os"
 	"path"
 	"path/filepath"
+	"slices"
 	"strings"
 	"time"
 
 	"github.com/gdamore/tcell/v2"
-	"github.com/google/uuid"
 	"github.com/simulot/immich-go/browser"
 	"github.com/simulot/immich-go/browser/files"
 	"github.com/simulot/immich-go/browser/gp"
@@ -23,8 +23,14 @@ import (
 	"github.com/simulot/immich-go/helpers/fileevent"
 	"github.com/simulot/immich-go/helpers/fshelper"
 	"github.com/simulot/immich-go/helpers/gen"
+	"github.com/simulot/immich-go/helpers/geotag"
+	"github.com/simulot/immich-go/helpers/hook"
+	"github.com/simulot/immich-go/helpers/incremental"
 	"github.com/simulot/immich-go/helpers/myflag"
 	"github.com/simulot/immich-go/helpers/namematcher"
+	"github.com/simulot/immich-go/helpers/namenorm"
+	"github.com/simulot/immich-go/helpers/quarantine"
+	"github.com/simulot/immich-go/helpers/rules"
 	"github.com/simulot/immich-go/helpers/stacking"
 	"github.com/simulot/immich-go/immich"
 	"github.com/simulot/immich-go/internal/fakefs"
@@ -48,11 +54,10 @@ type UpCmd struct {
 	DateRange              immich.DateRange // Set capture date range
 	ImportFromAlbum        string           // Import assets from this albums
 	CreateAlbums           bool             // Create albums when exists in the source
-	KeepTrashed            bool             // Import trashed assets
+	Trashed                string           // What to do with trashed assets: SKIP, TRASH or KEEP (default: SKIP)
 	KeepPartner            bool             // Import partner's assets
 	KeepUntitled           bool             // Keep untitled albums
 	UseFolderAsAlbumName   bool             // Use folder's name instead of metadata's title as Album name
-	DryRun                 bool             // Display actions but don't change anything
 	CreateStacks           bool             // Stack jpg/raw/burst (Default: TRUE)
 	StackJpgRaws           bool             // Stack jpg/raw (Default: TRUE)
 	StackBurst             bool             // Stack burst (Default: TRUE)
@@ -61,17 +66,47 @@ type UpCmd struct {
 	WhenNoDate             string           // When the date can't be determined use the FILE's date or NOW (default: FILE)
 	ForceUploadWhenNoJSON  bool             // Some takeout don't supplies all JSON. When true, files are uploaded without any additional metadata
 	BannedFiles            namematcher.List // List of banned file name patterns
+	GeoTrackFiles          []string         // GPX, KML or GeoJSON track logs used to geotag assets
+	GeoTagMaxGap           time.Duration    // Maximum time between the capture and the nearest track point
+	GeoTagTimeOffset       time.Duration    // Offset added to the capture date before searching the track
+	GeoTagOverwrite        bool             // Replace the coordinates already known with the track's ones
+	RequireSpace           bool             // Abort the upload when it doesn't fit the user's quota
+	PauseOnJobs            jobThresholds    // Pause the upload while the server's job queues exceed these thresholds
+	ReplicaServers         []string         // Replica servers receiving the same uploads
+	ReplicaKeys            []string         // API keys of the replica servers
+	ReplicaConfigs         []string         // Configuration files of replica servers
+	QuarantineDir          string           // Folder receiving a copy of the files that can't be imported
+	RetryFrom              string           // Log of a previous run, only its failed files are processed
+	Incremental            bool             // Skip the files unchanged since the last completed run
+	Order                  string           // Order of the upload: NEWEST, OLDEST, ALBUM, SIZE-ASC, SIZE-DESC
+	Hooks                  hook.Commands    // Commands called before and after each upload
+	QualityPolicy          qualityPolicy    // How to tell which copy of an asset is the best
+	DeviceAssetID          string           // Scheme of the device asset IDs: NAME (title and size) or HASH (content)
+	IgnoreNameCase         bool             // Compare the file names without case
+	RulesFile              string           // JSON file of rules routing the assets
+	FollowSymlinks         bool             // Walk the symbolic links to folders
+	AppleEdits             string           // Apple's edited photos: STACK, EDIT or ORIGINAL
 
 	BrowserConfig Configuration
 
-	albums map[string]immich.AlbumSimplified // Albums by title
+	albums        map[string]immich.AlbumSimplified // Albums by title
+	orderedAlbums map[string]bool                   // Albums whose sort order has been set during the run
 
 	AssetIndex       *AssetIndex               // List of assets present on the server
 	deleteServerList []*immich.Asset           // List of server assets to remove
 	deleteLocalList  []*browser.LocalAssetFile // List of local assets to remove
 	// updateAlbums     map[string]map[string]any // track immich albums changes
-	stacks  *stacking.StackBuilder
-	browser browser.Browser
+	stacks      *stacking.StackBuilder
+	browser     browser.Browser
+	geoTrack    *geotag.Track                // track logs
+	control     *uploadControl               // pause, resume and skip
+	replicas    []*UpCmd                     // the same upload on other servers
+	quarantine  *quarantine.Quarantine       // copies of the files that can't be imported
+	retry       *retryList                   // failed files of a previous run
+	incremental map[fs.FS]*incremental.State // files handled by the previous runs, by folder
+	rules       *rules.Set                   // rules routing the assets
+	ruleStacks  map[string][]ruleStackMember // assets to stack, by group given by the rules
+	lostFiles   int                          // files lost in the damaged archives
 }
 
 func UploadCommand(ctx context.Context, common *cmd.SharedFlags, args []string) error {
@@ -92,7 +127,11 @@ func newCommand(ctx context.Context, common *cmd.SharedFlags, args []string, fsO
 	cmd := flag.NewFlagSet("upload", flag.ExitOnError)
 
 	app := UpCmd{
-		SharedFlags: common,
+		SharedFlags:   common,
+		PauseOnJobs:   jobThresholds{},
+		Hooks:         hook.Commands{},
+		QualityPolicy: append(qualityPolicy{}, defaultQualityPolicy...),
+		control:       newUploadControl(),
 	}
 	app.BannedFiles, err = namematcher.New(
 		`@eaDir/`,
@@ -107,10 +146,6 @@ func newCommand(ctx context.Context, common *cmd.SharedFlags, args []string, fsO
 	}
 
 	app.SharedFlags.SetFlags(cmd)
-	cmd.BoolFunc(
-		"dry-run",
-		"display actions but don't touch source or destination",
-		myflag.BoolFlagFn(&app.DryRun, false))
 	cmd.Var(&app.DateRange,
 		"date",
 		"Date of capture range.")
@@ -132,11 +167,11 @@ func newCommand(ctx context.Context, common *cmd.SharedFlags, args []string, fsO
 		" when use-full-path-album-name = true, determines how multiple (sub) folders, if any, will be joined")
 	cmd.BoolFunc(
 		"google-photos",
-		"Import GooglePhotos takeout zip files",
+		"Import GooglePhotos takeout zip or tgz files",
 		myflag.BoolFlagFn(&app.GooglePhotos, false))
 	cmd.BoolFunc(
 		"create-albums",
-		" google-photos only: Create albums like there were in the source (default: TRUE)",
+		" Create albums like there were in the source, or described by the album files of the folders (default: TRUE)",
 		myflag.BoolFlagFn(&app.CreateAlbums, true))
 	cmd.StringVar(&app.PartnerAlbum,
 		"partner-album",
@@ -158,6 +193,11 @@ func newCommand(ctx context.Context, common *cmd.SharedFlags, args []string, fsO
 		"use-album-folder-as-name",
 		" google-photos only: Use folder name and ignore albums' title (default:FALSE)", myflag.BoolFlagFn(&app.UseFolderAsAlbumName, false))
 
+	cmd.StringVar(&app.Trashed,
+		"trashed",
+		"SKIP",
+		" google-photos only: What to do with trashed assets: SKIP them, upload them into the immich TRASH, or KEEP them as normal assets (default: SKIP)")
+
 	cmd.BoolFunc(
 		"discard-archived",
 		" google-photos only: Do not import archived photos (default FALSE)", myflag.BoolFlagFn(&app.DiscardArchived, false))
@@ -192,6 +232,53 @@ func newCommand(ctx context.Context, common *cmd.SharedFlags, args []string, fsO
 	cmd.BoolVar(&app.ForceUploadWhenNoJSON, "upload-when-missing-JSON", app.ForceUploadWhenNoJSON, "when true, photos are upload even without associated JSON file.")
 	cmd.BoolVar(&app.DebugFileList, "debug-file-list", app.DebugFileList, "Check how the your file list would be processed")
 
+	cmd.Func("gpx", "Geotag assets without coordinates with a GPX, KML or GeoJSON track log. Repeat the option for each file.", func(s string) error {
+		app.GeoTrackFiles = append(app.GeoTrackFiles, s)
+		return nil
+	})
+	cmd.Func("gpx-max-gap", "Maximum time between the capture and the track points (default 5m)", myflag.DurationFlagFn(&app.GeoTagMaxGap, 5*time.Minute))
+	cmd.Func("gpx-time-offset", "Offset added to the capture date before searching the track, ex: -2h for a camera set 2 hours ahead of UTC (default 0)", myflag.DurationFlagFn(&app.GeoTagTimeOffset, 0))
+	cmd.BoolFunc("gpx-overwrite", "Replace coordinates already known with the track's ones (default FALSE)", myflag.BoolFlagFn(&app.GeoTagOverwrite, false))
+
+	cmd.BoolFunc("require-space", "Abort before uploading when the assets don't fit the user's quota (default FALSE)", myflag.BoolFlagFn(&app.RequireSpace, false))
+
+	cmd.Var(&app.PauseOnJobs, "pause-on-jobs", "Pause the upload while the server's job queues exceed the given counts, ex: thumbnailGeneration:100,faceDetection:50")
+
+	cmd.Func("replica-server", "Upload also to this server. Repeat the option for each replica, with its -replica-key", func(s string) error {
+		app.ReplicaServers = append(app.ReplicaServers, s)
+		return nil
+	})
+	cmd.Func("replica-key", "API key of the replica server given by the -replica-server at the same position", func(s string) error {
+		app.ReplicaKeys = append(app.ReplicaKeys, s)
+		return nil
+	})
+	cmd.Func("replica-config", "Upload also to the server described by this configuration file. Repeat the option for each replica", func(s string) error {
+		app.ReplicaConfigs = append(app.ReplicaConfigs, s)
+		return nil
+	})
+
+	cmd.StringVar(&app.QuarantineDir, "quarantine", "", "Copy unsupported, unmatched and failed files into this folder, with the reason of their rejection")
+
+	cmd.StringVar(&app.RetryFrom, "retry-from", "", "Process only the files that have failed in the run logged in this file (text or JSON log)")
+
+	cmd.Var(app.Hooks, "hook", "Call the command for the event: before-upload, after-upload, on-skip, on-error or end-of-run, given as EVENT=COMMAND. Repeat the option for each hook")
+
+	cmd.StringVar(&app.DeviceAssetID, "device-asset-id", "NAME", "Identify the assets by NAME (title and size) or by HASH of their content, with a device per source")
+
+	cmd.BoolFunc("ignore-name-case", "Compare the file names without case when matching the files, the JSONs and the server's assets (default FALSE)", myflag.BoolFlagFn(&app.IgnoreNameCase, false))
+
+	cmd.StringVar(&app.AppleEdits, "apple-edits", "STACK", " folder import only: Upload the Apple's edits IMG_E1234 with their original IMG_1234 stacked with the edit as cover (STACK), only the EDIT, or only the ORIGINAL")
+
+	cmd.BoolFunc("follow-symlinks", "Walk the symbolic links to folders, the links making a loop are ignored (default FALSE)", myflag.BoolFlagFn(&app.FollowSymlinks, false))
+
+	cmd.Var(&app.QualityPolicy, "quality-policy", "Criteria telling if the local copy of an asset is better than the server's one, in order: pixels, format, depth, size")
+
+	cmd.StringVar(&app.RulesFile, "rules", "", "Route the assets with the rules of this JSON or YAML file: skip, archive, favorite, add to albums, tag, describe or stack them")
+
+	cmd.StringVar(&app.Order, "order", "", "Order of the upload: newest, oldest, album, size-asc, size-desc or any, the fastest (default: the order of the folders)")
+
+	cmd.BoolFunc("incremental", "Skip the files of the folders unchanged since the last completed run (default FALSE)", myflag.BoolFlagFn(&app.Incremental, false))
+
 	err = cmd.Parse(args)
 	if err != nil {
 		return nil, err
@@ -217,11 +304,81 @@ func newCommand(ctx context.Context, common *cmd.SharedFlags, args []string, fsO
 		return nil, fmt.Errorf("the -when-no-date accepts FILE or NOW")
 	}
 
+	app.Trashed = strings.ToUpper(app.Trashed)
+	switch app.Trashed {
+	case "SKIP", "TRASH", "KEEP":
+	default:
+		return nil, fmt.Errorf("the -trashed accepts SKIP, TRASH or KEEP")
+	}
+
+	app.DeviceAssetID = strings.ToUpper(app.DeviceAssetID)
+	switch app.DeviceAssetID {
+	case "NAME", "HASH":
+	default:
+		return nil, fmt.Errorf("the -device-asset-id accepts NAME or HASH")
+	}
+
+	app.AppleEdits = strings.ToUpper(app.AppleEdits)
+	switch files.AppleEdits(app.AppleEdits) {
+	case files.AppleEditsStack, files.AppleEditsEdit, files.AppleEditsOriginal:
+	default:
+		return nil, fmt.Errorf("the -apple-edits accepts STACK, EDIT or ORIGINAL")
+	}
+
+	app.Order = strings.ToUpper(app.Order)
+	switch browser.Order(app.Order) {
+	case browser.OrderNone, browser.OrderNewest, browser.OrderOldest, browser.OrderAlbum, browser.OrderSizeAsc, browser.OrderSizeDesc, browser.OrderAny:
+	default:
+		return nil, fmt.Errorf("the -order accepts newest, oldest, album, size-asc, size-desc or any")
+	}
+
+	if len(app.GeoTrackFiles) > 0 {
+		app.geoTrack, err = geotag.LoadFiles(app.GeoTrackFiles...)
+		if err != nil {
+			return nil, fmt.Errorf("can't read the track logs: %w", err)
+		}
+		if app.geoTrack.Len() == 0 {
+			return nil, fmt.Errorf("the track logs don't contain any timed position")
+		}
+	}
+
+	if app.QuarantineDir != "" {
+		app.quarantine, err = quarantine.New(app.QuarantineDir)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if app.RulesFile != "" {
+		app.rules, err = rules.Load(app.RulesFile)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if app.RetryFrom != "" {
+		app.retry, err = readRetryList(app.RetryFrom)
+		if err != nil {
+			return nil, err
+		}
+		if app.retry.Len() == 0 {
+			fmt.Println("No failed file found in ", app.RetryFrom)
+			return &app, nil
+		}
+	}
+
 	app.BrowserConfig.Validate()
 	err = app.SharedFlags.Start(ctx)
 	if err != nil {
 		return nil, err
 	}
+	if app.geoTrack != nil {
+		app.Log.Info(fmt.Sprintf("%d track points loaded", app.geoTrack.Len()))
+	}
+	err = app.openReplicas(ctx)
+	if err != nil {
+		return nil, err
+	}
 
 	if fsOpener == nil {
 		fsOpener = func() ([]fs.FS, error) {
@@ -232,6 +389,20 @@ func newCommand(ctx context.Context, common *cmd.SharedFlags, args []string, fsO
 	if err != nil {
 		return nil, err
 	}
+	if app.FollowSymlinks {
+		for _, fsys := range app.fsyss {
+			if gw, ok := fsys.(*fshelper.GlobWalkFS); ok {
+				gw.SetFollowSymlinks(true)
+			}
+		}
+	}
+	app.recordLostFiles(ctx)
+	if app.Incremental && !app.GooglePhotos {
+		err = app.openIncremental()
+		if err != nil {
+			return nil, err
+		}
+	}
 	if len(app.fsyss) == 0 {
 		fmt.Println("No file found matching the pattern: ", strings.Join(cmd.Args(), ","))
 		app.Log.Info("No file found matching the pattern: " + strings.Join(cmd.Args(), ","))
@@ -244,9 +415,10 @@ func (app *UpCmd) run(ctx context.Context) error {
 		_ = fshelper.CloseFSs(app.fsyss)
 	}()
 
-	if app.CreateStacks || app.StackBurst || app.StackJpgRaws {
-		app.stacks = stacking.NewStackBuilder(app.Immich.SupportedMedia())
+	if app.CreateStacks || app.StackBurst || app.StackJpgRaws || app.stackAppleEdits() {
+		app.stacks = stacking.NewStackBuilder(app.Immich.SupportedMedia()).SetNameNormalizer(app.nameNormalizer())
 	}
+	app.initReplicaStacks()
 
 	var err error
 	switch {
@@ -290,6 +462,7 @@ func (app *UpCmd) run(ctx context.Context) error {
 func (app *UpCmd) getImmichAlbums(ctx context.Context) error {
 	serverAlbums, err := app.Immich.GetAllAlbums(ctx)
 	app.albums = map[string]immich.AlbumSimplified{}
+	app.orderedAlbums = map[string]bool{}
 	if err != nil {
 		return fmt.Errorf("can't get the album list from the server: %w", err)
 	}
@@ -335,6 +508,9 @@ func (app *UpCmd) getImmichAssets(ctx context.Context, updateFn progressUpdate)
 	}
 	app.AssetIndex = &AssetIndex{
 		assets: list,
+		policy: app.QualityPolicy,
+		names:  app.nameNormalizer(),
+		rawJpg: app.StackJpgRaws,
 	}
 	app.AssetIndex.ReIndex()
 	return nil
@@ -355,38 +531,73 @@ assetLoop:
 			}
 			if a.Err != nil {
 				app.Jnl.Record(ctx, fileevent.Error, a, a.FileName, a.Err.Error())
+			} else if app.retry != nil && !app.retry.Match(a) {
+				app.skipAsset(ctx, a, "not selected", "not in the retry list")
 			} else {
-				err = app.handleAsset(ctx, a)
+				err = app.control.Wait(ctx)
+				if err != nil {
+					return err
+				}
+				actx, done := app.control.startAsset(ctx)
+				if len(app.replicas) > 0 {
+					err = app.handleAssetOnTargets(actx, a)
+				} else {
+					err = app.handleAsset(actx, a)
+				}
+				done()
 				if err != nil {
-					app.Jnl.Record(ctx, fileevent.Error, a, a.FileName, a.Err.Error())
+					app.Jnl.Record(ctx, fileevent.Error, a, a.FileName, err.Error())
+					app.runErrorHook(ctx, a, err)
 				}
 			}
 		}
 	}
 
-	if app.CreateStacks {
+	err = app.finishUpload(ctx)
+	if err != nil {
+		return err
+	}
+	err = app.finishReplicas(ctx)
+	if err != nil {
+		return err
+	}
+	app.runEndHook(ctx)
+	return app.saveIncremental()
+}
+
+// stackAppleEdits tells if the Apple's edits are stacked with their original, even without -create-stacks
+func (app *UpCmd) stackAppleEdits() bool {
+	return !app.GooglePhotos && app.AppleEdits == string(files.AppleEditsStack)
+}
+
+// finishUpload creates the stacks and deletes the assets marked for deletion
+func (app *UpCmd) finishUpload(ctx context.Context) error {
+	var err error
+	if app.CreateStacks || app.stackAppleEdits() {
 		stacks := app.stacks.Stacks()
 		if len(stacks) > 0 {
 			app.Log.Info("Creating stacks")
 		nextStack:
 			for _, s := range stacks {
 				switch {
+				case !app.CreateStacks && s.StackType != stacking.StackAppleEdit:
+					continue nextStack
 				case !app.StackBurst && s.StackType == stacking.StackBurst:
 					continue nextStack
 				case !app.StackJpgRaws && s.StackType == stacking.StackRawJpg:
 					continue nextStack
 				}
 				app.Log.Info(fmt.Sprintf("Stacking %s...", strings.Join(s.Names, ", ")))
-				if !app.DryRun {
-					err = app.Immich.StackAssets(ctx, s.CoverID, s.IDs)
-					if err != nil {
-						app.Log.Error(fmt.Sprintf("Can't stack images: %s", err))
-					}
+				err = app.Immich.StackAssets(ctx, s.CoverID, s.IDs)
+				if err != nil {
+					app.Log.Error(fmt.Sprintf("Can't stack images: %s", err))
 				}
 			}
 		}
 	}
 
+	app.createRuleStacks(ctx)
+
 	// if app.CreateAlbums || app.CreateAlbumAfterFolder || (app.KeepPartner && app.PartnerAlbum != "") || app.ImportIntoAlbum != "" {
 	// 	app.Log.Info("Managing albums")
 	// 	err = app.ManageAlbums(ctx)
@@ -417,53 +628,36 @@ assetLoop:
 func (app *UpCmd) handleAsset(ctx context.Context, a *browser.LocalAssetFile) error {
 	defer func() {
 		a.Close()
+		if a.LivePhoto != nil {
+			a.LivePhoto.Close()
+		}
 	}()
-	ext := path.Ext(a.FileName)
-	if app.BrowserConfig.ExcludeExtensions.Exclude(ext) {
-		app.Jnl.Record(ctx, fileevent.UploadNotSelected, a, a.FileName, "reason", "extension in rejection list")
-		return nil
-	}
-	if !app.BrowserConfig.SelectExtensions.Include(ext) {
-		app.Jnl.Record(ctx, fileevent.UploadNotSelected, a, a.FileName, "reason", "extension not in selection list")
-		return nil
-	}
 
-	if !app.KeepPartner && a.FromPartner {
-		app.Jnl.Record(ctx, fileevent.UploadNotSelected, a, a.FileName, "reason", "partners asset excluded")
+	if reason := app.notSelected(a); reason != "" {
+		app.skipAsset(ctx, a, "not selected", reason)
 		return nil
 	}
 
-	if !app.KeepTrashed && a.Trashed {
-		app.Jnl.Record(ctx, fileevent.UploadNotSelected, a, a.FileName, "reason", "trashed asset excluded")
-		return nil
+	if !app.KeepUntitled {
+		a.Albums = gen.Filter(a.Albums, func(i browser.LocalAlbum) bool {
+			return i.Title != ""
+		})
 	}
 
-	if app.ImportFromAlbum != "" && !app.isInAlbum(a, app.ImportFromAlbum) {
-		app.Jnl.Record(ctx, fileevent.UploadNotSelected, a.FileName, "reason", "doesn't belong to required album")
-		return nil
-	}
+	app.geoTagAsset(ctx, a)
 
-	if app.DiscardArchived && a.Archived {
-		app.Jnl.Record(ctx, fileevent.UploadNotSelected, a, a.FileName, "reason", "archived asset are discarded")
+	ruled, ok := app.applyRules(ctx, a)
+	if !ok {
 		return nil
 	}
-
-	if app.DateRange.IsSet() {
-		d := a.Metadata.DateTaken
-		if d.IsZero() {
-			app.Jnl.Record(ctx, fileevent.UploadNotSelected, a, a.FileName, "reason", "date of capture is unknown")
-			return nil
-		}
-		if !app.DateRange.InRange(d) {
-			app.Jnl.Record(ctx, fileevent.UploadNotSelected, a, a.FileName, "reason", "date of capture is out of the given range")
-			return nil
-		}
+	if !app.AutoArchive && !ruled.Archive {
+		a.Archived = false
 	}
 
-	if !app.KeepUntitled {
-		a.Albums = gen.Filter(a.Albums, func(i browser.LocalAlbum) bool {
-			return i.Title != ""
-		})
+	err := app.identifyAsset(a)
+	if err != nil {
+		app.Jnl.Record(ctx, fileevent.Error, a, a.FileName, "error", "can't compute the checksum: "+err.Error())
+		return nil
 	}
 
 	advice, err := app.AssetIndex.ShouldUpload(a)
@@ -473,25 +667,46 @@ func (app *UpCmd) handleAsset(ctx context.Context, a *browser.LocalAssetFile) er
 
 	switch advice.Advice {
 	case NotOnServer: // Upload and manage albums
+		albums, changes, ok := app.beforeUpload(ctx, a, "upload", advice, ruled)
+		if !ok {
+			return nil
+		}
 		ID, err := app.UploadAsset(ctx, a)
 		if err != nil {
 			return nil
 		}
-		app.manageAssetAlbum(ctx, ID, a, advice)
+		if app.toTrash(a) {
+			app.moveToTrash(ctx, a, ID)
+			return nil
+		}
+		app.manageAssetAlbum(ctx, ID, a, albums)
+		app.stackByRule(ruled, ID, a.FileName)
+		app.afterUpload(ctx, a, ID, "upload", changes)
 
 	case SmallerOnServer: // Upload, manage albums and delete the server's asset
+		if app.toTrash(a) {
+			// the server's asset is visible, don't replace it by a trashed one
+			app.skipAsset(ctx, a, "not selected", "trashed asset, the server has a visible copy")
+			return nil
+		}
+		albums, changes, ok := app.beforeUpload(ctx, a, "upgrade", advice, ruled)
+		if !ok {
+			return nil
+		}
 		app.Jnl.Record(ctx, fileevent.UploadUpgraded, a, a.FileName, "reason", advice.Message)
 		// add the superior asset into albums of the original asset.
 		ID, err := app.UploadAsset(ctx, a)
 		if err != nil {
 			return nil
 		}
-		app.manageAssetAlbum(ctx, ID, a, advice)
+		app.manageAssetAlbum(ctx, ID, a, albums)
+		app.stackByRule(ruled, ID, a.FileName)
 		// delete the existing lower quality asset
 		err = app.deleteAsset(ctx, advice.ServerAsset.ID)
 		if err != nil {
 			app.Jnl.Record(ctx, fileevent.Error, a, a.FileName, "error", err.Error())
 		}
+		app.afterUpload(ctx, a, ID, "upgrade", changes)
 
 	case SameOnServer: // manage albums
 		// Set add the server asset into albums determined locally
@@ -500,37 +715,146 @@ func (app *UpCmd) handleAsset(ctx context.Context, a *browser.LocalAssetFile) er
 		} else {
 			app.Jnl.Record(ctx, fileevent.AnalysisLocalDuplicate, a, a.FileName)
 		}
-		app.manageAssetAlbum(ctx, advice.ServerAsset.ID, a, advice)
+		if !app.toTrash(a) {
+			app.manageAssetAlbum(ctx, advice.ServerAsset.ID, a, ruleAlbums(app.assetAlbums(a, advice), ruled))
+			app.stackByRule(ruled, advice.ServerAsset.ID, a.FileName)
+		}
+		app.runSkipHook(ctx, a, "same on server", advice.Message, advice.ServerAsset.ID)
 
 	case BetterOnServer: // and manage albums
 		app.Jnl.Record(ctx, fileevent.UploadServerBetter, a, a.FileName, "reason", advice.Message)
-		app.manageAssetAlbum(ctx, advice.ServerAsset.ID, a, advice)
+		if !app.toTrash(a) {
+			app.manageAssetAlbum(ctx, advice.ServerAsset.ID, a, ruleAlbums(app.assetAlbums(a, advice), ruled))
+			app.stackByRule(ruled, advice.ServerAsset.ID, a.FileName)
+		}
+		app.runSkipHook(ctx, a, "better on server", advice.Message, advice.ServerAsset.ID)
 	}
 
 	return nil
 }
 
+// readVideoMetadata reads the duration of a video just before its upload, the upload reads the file anyway
+func (app *UpCmd) readVideoMetadata(ctx context.Context, a *browser.LocalAssetFile) {
+	if a.Metadata.Duration != 0 || app.Immich.SupportedMedia().TypeFromExt(path.Ext(a.FileName)) != immich.TypeVideo {
+		return
+	}
+	if err := a.ReadVideoMetadata(); err != nil {
+		app.Jnl.Record(ctx, fileevent.INFO, a, a.FileName, "info", "the duration of the video isn't read: "+err.Error())
+	}
+}
+
+// notSelected gives the reason why the asset isn't selected by the options, or an empty string
+func (app *UpCmd) notSelected(a *browser.LocalAssetFile) string {
+	if reason := app.excluded(a); reason != "" {
+		return reason
+	}
+	return app.outOfDateRange(a)
+}
+
+// nameNormalizer gives how the file names are compared
+func (app *UpCmd) nameNormalizer() namenorm.Normalizer {
+	return namenorm.Normalizer{FoldCase: app.IgnoreNameCase}
+}
+
+// excluded gives the reason why the asset is excluded by the options, the date of capture apart
+func (app *UpCmd) excluded(a *browser.LocalAssetFile) string {
+	ext := path.Ext(a.FileName)
+	if app.BrowserConfig.ExcludeExtensions.Exclude(ext) {
+		return "extension in rejection list"
+	}
+	if !app.BrowserConfig.SelectExtensions.Include(ext) {
+		return "extension not in selection list"
+	}
+	if !app.KeepPartner && a.FromPartner {
+		return "partners asset excluded"
+	}
+	if app.Trashed == "SKIP" && a.Trashed {
+		return "trashed asset excluded"
+	}
+	if app.ImportFromAlbum != "" && !app.isInAlbum(a, app.ImportFromAlbum) {
+		return "doesn't belong to required album"
+	}
+	if app.DiscardArchived && a.Archived {
+		return "archived asset are discarded"
+	}
+	return ""
+}
+
+// outOfDateRange gives the reason why the asset's date of capture isn't selected, or an empty string
+func (app *UpCmd) outOfDateRange(a *browser.LocalAssetFile) string {
+	if app.DateRange.IsSet() {
+		d := a.Metadata.DateTaken
+		if d.IsZero() {
+			return "date of capture is unknown"
+		}
+		if !app.DateRange.InRange(d) {
+			return "date of capture is out of the given range"
+		}
+	}
+	return ""
+}
+
 func (app *UpCmd) deleteAsset(ctx context.Context, id string) error {
 	return app.Immich.DeleteAssets(ctx, []string{id}, true)
 }
 
-// manageAssetAlbum keep the albums updated
-// errors are logged, but not returned
-func (app *UpCmd) manageAssetAlbum(ctx context.Context, assetID string, a *browser.LocalAssetFile, advice *Advice) {
+// putInQuarantine copies the asset with its JSON and its sidecar in the quarantine folder, when any
+func (app *UpCmd) putInQuarantine(ctx context.Context, a *browser.LocalAssetFile, reason string) {
+	if app.quarantine == nil {
+		return
+	}
+	if server := app.replicaName(); server != "" {
+		reason = fmt.Sprintf("%s (server %s)", reason, server)
+	}
+	err := app.quarantine.Put(ctx, a.FSys, a.FileName, reason, a.JSONFile, a.SideCar)
+	if err != nil {
+		app.Jnl.Record(ctx, fileevent.Error, a, a.FileName, "error", "can't copy the file in the quarantine: "+err.Error())
+	}
+}
+
+// toTrash tells if the asset goes into the immich trash after its upload
+func (app *UpCmd) toTrash(a *browser.LocalAssetFile) bool {
+	return a.Trashed && app.Trashed == "TRASH"
+}
+
+// moveToTrash sends the freshly uploaded asset and its live photo into the immich trash.
+// The server's trash retention applies to them.
+func (app *UpCmd) moveToTrash(ctx context.Context, a *browser.LocalAssetFile, id string) {
+	ids := []string{id}
+	if a.LivePhoto != nil && a.LivePhotoID != "" {
+		ids = append(ids, a.LivePhotoID)
+	}
+	err := app.Immich.DeleteAssets(ctx, ids, false)
+	if err != nil {
+		app.Jnl.Record(ctx, fileevent.Error, a, a.FileName, "error", fmt.Sprintf("can't move the asset to the trash: %s", err))
+		return
+	}
+	app.Jnl.Record(ctx, fileevent.UploadTrashed, a, a.FileName)
+}
+
+// albumTarget is an album receiving an asset
+type albumTarget struct {
+	title       string
+	description string
+	reason      string // reason logged with the addition, if any
+	order       string // sort order of the album's assets, if any
+	cover       bool   // the asset is the album's cover
+}
+
+// assetAlbums determines the albums of the asset
+func (app *UpCmd) assetAlbums(a *browser.LocalAssetFile, advice *Advice) []albumTarget {
+	albums := []albumTarget{}
 	addedTo := map[string]any{}
-	if advice.ServerAsset != nil {
+	if advice != nil && advice.ServerAsset != nil {
 		for _, al := range advice.ServerAsset.Albums {
-			app.Jnl.Record(ctx, fileevent.UploadAddToAlbum, a, a.FileName, "album", al.AlbumName, "reason", "lower quality asset's album")
-			if !app.DryRun {
-				err := app.AddToAlbum(ctx, assetID, browser.LocalAlbum{Title: al.AlbumName, Description: al.Description})
-				if err != nil {
-					app.Jnl.Record(ctx, fileevent.Error, a, a.FileName, "error", err.Error())
-				}
-			}
+			albums = append(albums, albumTarget{title: al.AlbumName, description: al.Description, reason: "lower quality asset's album"})
 			addedTo[al.AlbumName] = nil
 		}
 	}
 
+	// the asset's path and the other paths of the same file
+	paths := append([]browser.FileLink{{FSys: a.FSys, FileName: a.FileName}}, a.Links...)
+
 	if app.CreateAlbums {
 		for _, al := range a.Albums {
 			album := al.Title
@@ -538,59 +862,109 @@ func (app *UpCmd) manageAssetAlbum(ctx context.Context, assetID string, a *brows
 				album = filepath.Base(al.Path)
 			}
 			if _, exist := addedTo[album]; !exist {
-				app.Jnl.Record(ctx, fileevent.UploadAddToAlbum, a, a.FileName, "album", album)
-				if !app.DryRun {
-					err := app.AddToAlbum(ctx, assetID, browser.LocalAlbum{Title: album})
-					if err != nil {
-						app.Jnl.Record(ctx, fileevent.Error, a, a.FileName, "error", err.Error())
-					}
-				}
+				addedTo[album] = nil
+				albums = append(albums, albumTarget{
+					title:       album,
+					description: al.Description,
+					order:       al.Order,
+					cover:       al.Cover != "" && app.isCover(al, paths),
+				})
 			}
 		}
 	}
 	if app.ImportIntoAlbum != "" {
-		app.Jnl.Record(ctx, fileevent.UploadAddToAlbum, a, a.FileName, "album", app.ImportIntoAlbum, "reason", "option -album")
-		if !app.DryRun {
-			err := app.AddToAlbum(ctx, assetID, browser.LocalAlbum{Title: app.ImportIntoAlbum})
-			if err != nil {
-				app.Jnl.Record(ctx, fileevent.Error, a, a.FileName, "error", err.Error())
-			}
-		}
+		albums = append(albums, albumTarget{title: app.ImportIntoAlbum, reason: "option -album"})
 	}
 
 	if app.GooglePhotos {
 		if app.PartnerAlbum != "" && a.FromPartner {
-			app.Jnl.Record(ctx, fileevent.UploadAddToAlbum, a, a.FileName, "album", app.PartnerAlbum, "reason", "option -partner-album")
-			if !app.DryRun {
-				err := app.AddToAlbum(ctx, assetID, browser.LocalAlbum{Title: app.PartnerAlbum})
-				if err != nil {
-					app.Jnl.Record(ctx, fileevent.Error, a, a.FileName, "error", err.Error())
-				}
-			}
+			albums = append(albums, albumTarget{title: app.PartnerAlbum, reason: "option -partner-album"})
 		}
 	} else {
 		if app.CreateAlbumAfterFolder {
-			album := path.Base(path.Dir(a.FileName))
-			if !app.GooglePhotos && app.UseFullPathAsAlbumName {
-				// full path
-				album = strings.Replace(filepath.Dir(a.FileName), string(os.PathSeparator), app.AlbumNamePathSeparator, -1)
-			}
-			if album == "" || album == "." {
-				if fsys, ok := a.FSys.(fshelper.NameFS); ok {
-					album = fsys.Name()
-				} else {
-					album = "no-folder-name"
+			// the same file found in other folders goes in their albums too,
+			// the album file of a folder replaces the folder's name, unless the album files are ignored
+			for _, p := range paths {
+				if app.CreateAlbums && slices.ContainsFunc(a.Albums, func(al browser.LocalAlbum) bool { return al.Path == path.Dir(p.FileName) }) {
+					continue
 				}
-			}
-			app.Jnl.Record(ctx, fileevent.UploadAddToAlbum, a, a.FileName, "album", album, "reason", "option -create-album-folder")
-			if !app.DryRun {
-				err := app.AddToAlbum(ctx, assetID, browser.LocalAlbum{Title: album})
-				if err != nil {
-					app.Jnl.Record(ctx, fileevent.Error, a, a.FileName, "error", err.Error())
+				album := app.folderAlbum(p.FSys, p.FileName)
+				if !slices.ContainsFunc(albums, func(al albumTarget) bool { return al.title == album }) {
+					albums = append(albums, albumTarget{title: album, reason: "option -create-album-folder"})
 				}
 			}
 		}
 	}
+	return albums
+}
+
+// folderAlbum gives the album named after the folder of the file
+// isCover tells if the album's cover is one of the paths of the asset in the album's folder
+func (app *UpCmd) isCover(al browser.LocalAlbum, paths []browser.FileLink) bool {
+	return slices.ContainsFunc(paths, func(p browser.FileLink) bool {
+		return path.Dir(p.FileName) == al.Path && app.nameNormalizer().Equal(path.Base(p.FileName), al.Cover)
+	})
+}
+
+func (app *UpCmd) folderAlbum(fsys fs.FS, name string) string {
+	album := path.Base(path.Dir(name))
+	if !app.GooglePhotos && app.UseFullPathAsAlbumName {
+		// full path
+		album = strings.Replace(filepath.Dir(name), string(os.PathSeparator), app.AlbumNamePathSeparator, -1)
+	}
+	if album == "" || album == "." {
+		if fsys, ok := fsys.(fshelper.NameFS); ok {
+			album = fsys.Name()
+		} else {
+			album = "no-folder-name"
+		}
+	}
+	return album
+}
+
+// manageAssetAlbum keep the albums updated
+// errors are logged, but not returned
+func (app *UpCmd) manageAssetAlbum(ctx context.Context, assetID string, a *browser.LocalAssetFile, albums []albumTarget) {
+	for _, al := range albums {
+		if al.reason != "" {
+			app.Jnl.Record(ctx, fileevent.UploadAddToAlbum, a, a.FileName, "album", al.title, "reason", al.reason)
+		} else {
+			app.Jnl.Record(ctx, fileevent.UploadAddToAlbum, a, a.FileName, "album", al.title)
+		}
+		err := app.AddToAlbum(ctx, assetID, browser.LocalAlbum{Title: al.title, Description: al.description})
+		if err == nil {
+			err = app.updateAlbumInfo(ctx, assetID, al)
+		}
+		if err != nil {
+			app.Jnl.Record(ctx, fileevent.Error, a, a.FileName, "error", err.Error())
+		}
+	}
+}
+
+// updateAlbumInfo sets the album's sort order once during the run, and its cover when the asset is the cover
+func (app *UpCmd) updateAlbumInfo(ctx context.Context, assetID string, al albumTarget) error {
+	l, ok := app.albums[al.title]
+	if !ok {
+		return nil
+	}
+	update := immich.AlbumInfoUpdate{}
+	if al.order != "" && !app.orderedAlbums[al.title] {
+		update.Order = al.order
+	}
+	if al.cover {
+		update.AlbumThumbnailAssetID = assetID
+	}
+	if update == (immich.AlbumInfoUpdate{}) {
+		return nil
+	}
+	err := app.Immich.UpdateAlbumInfo(ctx, l.ID, update)
+	if err != nil {
+		return err
+	}
+	if update.Order != "" {
+		app.orderedAlbums[al.title] = true
+	}
+	return nil
 }
 
 func (app *UpCmd) isInAlbum(a *browser.LocalAssetFile, album string) bool {
@@ -610,6 +984,11 @@ func (app *UpCmd) ReadGoogleTakeOut(ctx context.Context, fsyss []fs.FS) (browser
 	}
 	b.SetBannedFiles(app.BannedFiles)
 	b.SetAcceptMissingJSON(app.ForceUploadWhenNoJSON)
+	b.SetNameNormalizer(app.nameNormalizer())
+	b.SetOrder(browser.Order(app.Order))
+	if app.quarantine != nil {
+		b.SetQuarantine(app.quarantine)
+	}
 	return b, err
 }
 
@@ -620,7 +999,16 @@ func (app *UpCmd) ExploreLocalFolder(ctx context.Context, fsyss []fs.FS) (browse
 	}
 	b.SetSupportedMedia(app.Immich.SupportedMedia())
 	b.SetWhenNoDate(app.WhenNoDate)
+	b.SetNameNormalizer(app.nameNormalizer())
 	b.SetBannedFiles(app.BannedFiles)
+	b.SetOrder(browser.Order(app.Order))
+	b.SetAppleEdits(files.AppleEdits(app.AppleEdits))
+	if app.quarantine != nil {
+		b.SetQuarantine(app.quarantine)
+	}
+	if app.incremental != nil {
+		b.SetIncremental(app.incremental)
+	}
 	return b, nil
 }
 
@@ -630,50 +1018,51 @@ func (app *UpCmd) ExploreLocalFolder(ctx context.Context, fsyss []fs.FS) (browse
 func (app *UpCmd) UploadAsset(ctx context.Context, a *browser.LocalAssetFile) (string, error) {
 	var resp, liveResp immich.AssetResponse
 	var err error
-	if !app.AutoArchive && a.Archived {
-		a.Archived = false
-	}
-	if !app.DryRun {
-		if a.LivePhoto != nil {
-			liveResp, err = app.Immich.AssetUpload(ctx, a.LivePhoto)
-			if err == nil {
-				if liveResp.Status == immich.UploadDuplicate {
-					app.Jnl.Record(ctx, fileevent.UploadServerDuplicate, a.LivePhoto, a.LivePhoto.FileName, "info", "the server has this file")
-				} else {
-					app.Jnl.Record(ctx, fileevent.Uploaded, a.LivePhoto, a.LivePhoto.FileName)
-				}
-				a.LivePhotoID = liveResp.ID
-			} else {
-				app.Jnl.Record(ctx, fileevent.UploadServerError, a.LivePhoto, a.LivePhoto.FileName, "error", err.Error())
-			}
-		}
-		b := *a // Keep a copy of the asset to log errors specifically on the image
-		resp, err = app.Immich.AssetUpload(ctx, a)
+	app.readVideoMetadata(ctx, a)
+	if a.LivePhoto != nil {
+		app.readVideoMetadata(ctx, a.LivePhoto)
+		liveResp, err = app.Immich.AssetUpload(ctx, a.LivePhoto)
 		if err == nil {
-			if resp.Status == immich.UploadDuplicate {
-				app.Jnl.Record(ctx, fileevent.UploadServerDuplicate, a, a.FileName, "info", "the server has this file")
+			if liveResp.Status == immich.UploadDuplicate {
+				app.Jnl.Record(ctx, fileevent.UploadServerDuplicate, a.LivePhoto, a.LivePhoto.FileName, "info", "the server has this file")
 			} else {
-				b.LivePhoto = nil
-				app.Jnl.Record(ctx, fileevent.Uploaded, &b, b.FileName, "capture date", b.Metadata.DateTaken.String())
+				app.Jnl.Record(ctx, fileevent.Uploaded, a.LivePhoto, a.LivePhoto.FileName)
 			}
+			a.LivePhotoID = liveResp.ID
+		} else if isSkipped(ctx) {
+			app.Jnl.Record(ctx, fileevent.UploadNotSelected, a.LivePhoto, a.LivePhoto.FileName, "reason", errAssetSkipped.Error())
 		} else {
-			app.Jnl.Record(ctx, fileevent.UploadServerError, a, a.FileName, "error", err.Error())
-			return "", err
+			app.Jnl.Record(ctx, fileevent.UploadServerError, a.LivePhoto, a.LivePhoto.FileName, "source", fshelper.SourceName(a.LivePhoto.FSys), "error", err.Error())
+			app.putInQuarantine(ctx, a.LivePhoto, "upload error: "+err.Error())
+			app.runErrorHook(ctx, a.LivePhoto, err)
+		}
+	}
+	b := *a // Keep a copy of the asset to log errors specifically on the image
+	resp, err = app.Immich.AssetUpload(ctx, a)
+	if err == nil {
+		if resp.Status == immich.UploadDuplicate {
+			app.Jnl.Record(ctx, fileevent.UploadServerDuplicate, a, a.FileName, "info", "the server has this file")
+		} else {
+			b.LivePhoto = nil
+			app.Jnl.Record(ctx, fileevent.Uploaded, &b, b.FileName, "capture date", b.Metadata.DateTaken.String())
 		}
 	} else {
-		// dry-run mode
-		if a.LivePhoto != nil {
-			liveResp.ID = uuid.NewString()
+		if isSkipped(ctx) {
+			app.Jnl.Record(ctx, fileevent.UploadNotSelected, a, a.FileName, "reason", errAssetSkipped.Error())
+		} else {
+			app.Jnl.Record(ctx, fileevent.UploadServerError, a, a.FileName, "source", fshelper.SourceName(a.FSys), "error", err.Error())
+			app.putInQuarantine(ctx, a, "upload error: "+err.Error())
+			app.runErrorHook(ctx, a, err)
 		}
-		resp.ID = uuid.NewString()
-		app.Jnl.Record(ctx, fileevent.Uploaded, a, a.FileName, "capture date", a.Metadata.DateTaken.String())
+		return "", err
 	}
-	if resp.Status != immich.UploadDuplicate {
+	// the trashed assets are not indexed, a visible copy must not be matched with them
+	if resp.Status != immich.UploadDuplicate && !app.toTrash(a) {
 		if a.LivePhoto != nil && liveResp.ID != "" {
 			app.AssetIndex.AddLocalAsset(a, liveResp.ID)
 		}
 		app.AssetIndex.AddLocalAsset(a, resp.ID)
-		if app.CreateStacks {
+		if app.CreateStacks || app.stackAppleEdits() {
 			app.stacks.ProcessAsset(resp.ID, a.FileName, a.Metadata.DateTaken)
 		}
 	}
@@ -734,12 +1123,7 @@ func (app *UpCmd) DeleteLocalAssets() error {
 func (app *UpCmd) DeleteServerAssets(ctx context.Context, ids []string) error {
 	app.Log.Info(fmt.Sprintf("%d server assets to delete.", len(ids)))
 
-	if !app.DryRun {
-		err := app.Immich.DeleteAssets(ctx, ids, false)
-		return err
-	}
-	app.Log.Info(fmt.Sprintf("%d server assets to delete. skipped dry-run mode", len(ids)))
-	return nil
+	return app.Immich.DeleteAssets(ctx, ids, false)
 }
 
 /*
@@ -857,18 +1241,25 @@ func (ai *AssetIndex) adviceSameOnServer(sa *immich.Asset) *Advice {
 	}
 }
 
-func (ai *AssetIndex) adviceSmallerOnServer(sa *immich.Asset) *Advice {
+func (ai *AssetIndex) adviceSmallerOnServer(sa *immich.Asset, reason string) *Advice {
 	return &Advice{
 		Advice:      SmallerOnServer,
-		Message:     fmt.Sprintf("An asset with the same name:%q and date:%q but with smaller size:%s exists on the server. Replace it.", sa.OriginalFileName, sa.ExifInfo.DateTimeOriginal.Format(time.DateTime), formatBytes(sa.ExifInfo.FileSizeInByte)),
+		Message:     fmt.Sprintf("An asset with the same name:%q and date:%q but with a lower quality (%s) exists on the server. Replace it.", sa.OriginalFileName, sa.ExifInfo.DateTimeOriginal.Format(time.DateTime), reason),
 		ServerAsset: sa,
 	}
 }
 
-func (ai *AssetIndex) adviceBetterOnServer(sa *immich.Asset) *Advice {
+func (ai *AssetIndex) adviceBesideOnServer(sa *immich.Asset, reason string) *Advice {
+	return &Advice{
+		Advice:  NotOnServer,
+		Message: fmt.Sprintf("An asset with the same name:%q and date:%q exists on the server, the local copy may be better (%s) but it doesn't replace it. Upload it.", sa.OriginalFileName, sa.ExifInfo.DateTimeOriginal.Format(time.DateTime), reason),
+	}
+}
+
+func (ai *AssetIndex) adviceBetterOnServer(sa *immich.Asset, reason string) *Advice {
 	return &Advice{
 		Advice:      BetterOnServer,
-		Message:     fmt.Sprintf("An asset with the same name:%q and date:%q but with bigger size:%s exists on the server. No need to upload.", sa.OriginalFileName, sa.ExifInfo.DateTimeOriginal.Format(time.DateTime), formatBytes(sa.ExifInfo.FileSizeInByte)),
+		Message:     fmt.Sprintf("An asset with the same name:%q and date:%q but with a better quality (%s) exists on the server. No need to upload.", sa.OriginalFileName, sa.ExifInfo.DateTimeOriginal.Format(time.DateTime), reason),
 		ServerAsset: sa,
 	}
 }
@@ -883,7 +1274,9 @@ func (ai *AssetIndex) adviceNotOnServer() *Advice {
 // ShouldUpload check if the server has this asset
 //
 // The server may have different assets with the same name. This happens with photos produced by digital cameras.
-// The server may have the asset, but in lower resolution. Compare the taken date and resolution
+// The server may have the asset, but in lower quality. Compare the taken date, then the quality with the policy.
+// Only the copies of the same type are compared, the video of a live photo has the name of its photo.
+// The server's copy is replaced only by a copy of the same format with more pixels.
 
 func (ai *AssetIndex) ShouldUpload(la *browser.LocalAssetFile) (*Advice, error) {
 	filename := la.Title
@@ -893,40 +1286,71 @@ func (ai *AssetIndex) ShouldUpload(la *browser.LocalAssetFile) (*Advice, error)
 
 	ID := la.DeviceAssetID()
 
-	sa := ai.byID[ID]
+	sa := ai.byID[ai.idKey(ID)]
 	if sa != nil {
 		// the same ID exist on the server
 		return ai.adviceSameOnServer(sa), nil
 	}
+	if la.Checksum != "" {
+		// the same content, uploaded under another name or with the legacy ID
+		if l := ai.byHash[la.Checksum]; len(l) > 0 {
+			return ai.adviceSameOnServer(l[0]), nil
+		}
+		if sa = ai.byID[ai.idKey(la.LegacyDeviceAssetID())]; sa != nil && sa.Checksum == "" {
+			return ai.adviceSameOnServer(sa), nil
+		}
+	}
 
 	var l []*immich.Asset
 
-	// check all files with the same name
+	// check all files with the same name, whatever their format
 
 	n := filepath.Base(filename)
-	l = ai.byName[n]
-	if len(l) == 0 {
-		// n = strings.TrimSuffix(n, filepath.Ext(n))
-		l = ai.byName[n]
-	}
+	l = ai.byName[ai.names.Key(strings.TrimSuffix(n, filepath.Ext(n)))]
 
 	if len(l) > 0 {
 		dateTaken := la.Metadata.DateTaken
-		size := int(la.Size())
+		policy := ai.policy
+		if len(policy) == 0 {
+			policy = defaultQualityPolicy
+		}
+		var local *copyQuality
+		var kept *immich.Asset // a server's copy not replaced by the better local one
+		var keptReason string
 
 		for _, sa = range l {
-			compareDate := compareDate(dateTaken, sa.ExifInfo.DateTimeOriginal.Time)
-			compareSize := size - sa.ExifInfo.FileSizeInByte
-
+			if compareDate(dateTaken, sa.ExifInfo.DateTimeOriginal.Time) != 0 {
+				continue
+			}
+			server := serverQuality(sa)
+			if mediaType(path.Ext(filename)) != server.kind {
+				continue
+			}
+			if ai.rawJpg && rawJpgPair(path.Ext(filename), server.ext) {
+				continue
+			}
+			if local == nil {
+				q := localQuality(la, policy)
+				local = &q
+			}
+			if !policy.comparable(*local, server) {
+				continue
+			}
+			compareQuality, criterion, reason := policy.compare(*local, server)
 			switch {
-			case compareDate == 0 && compareSize == 0:
+			case compareQuality == 0:
 				return ai.adviceSameOnServer(sa), nil
-			case compareDate == 0 && compareSize > 0:
-				return ai.adviceSmallerOnServer(sa), nil
-			case compareDate == 0 && compareSize < 0:
-				return ai.adviceBetterOnServer(sa), nil
+			case compareQuality < 0:
+				return ai.adviceBetterOnServer(sa, reason), nil
+			case criterion != qualityPixels || !sameFormat(local.ext, server.ext):
+				kept, keptReason = sa, reason
+			default:
+				return ai.adviceSmallerOnServer(sa, reason), nil
 			}
 		}
+		if kept != nil {
+			return ai.adviceBesideOnServer(kept, keptReason), nil
+		}
 	}
 	return ai.adviceNotOnServer(), nil
 }
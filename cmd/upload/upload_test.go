@@ -1,18 +1,28 @@
 package upload
 
 import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
 	"cmp"
+	"compress/gzip"
 	"context"
+	"errors"
 	"io"
 	"log/slog"
+	"os"
+	"path/filepath"
 	"reflect"
+	"runtime"
 	"slices"
+	"strings"
 	"testing"
 
 	"github.com/kr/pretty"
 	"github.com/simulot/immich-go/browser"
 	"github.com/simulot/immich-go/cmd"
 	"github.com/simulot/immich-go/helpers/fileevent"
+	"github.com/simulot/immich-go/helpers/fshelper"
 	"github.com/simulot/immich-go/helpers/gen"
 	"github.com/simulot/immich-go/immich"
 )
@@ -51,6 +61,14 @@ func (c *stubIC) StackAssets(ctx context.Context, cover string, ids []string) er
 	return nil
 }
 
+func (c *stubIC) UpsertTags(ctx context.Context, tags []string) ([]immich.TagSimplified, error) {
+	return nil, nil
+}
+
+func (c *stubIC) TagAssets(ctx context.Context, tagIDs []string, assetIDs []string) error {
+	return nil
+}
+
 func (c *stubIC) UpdateAsset(ctx context.Context, id string, a *browser.LocalAssetFile) (*immich.Asset, error) {
 	return nil, nil
 }
@@ -85,6 +103,10 @@ func (c *stubIC) DeleteAlbum(ctx context.Context, id string) error {
 	return nil
 }
 
+func (c *stubIC) UpdateAlbumInfo(ctx context.Context, id string, update immich.AlbumInfoUpdate) error {
+	return nil
+}
+
 func (c *stubIC) SupportedMedia() immich.SupportedMedia {
 	return immich.DefaultSupportedMedia
 }
@@ -592,3 +614,842 @@ func cmpSlices[T cmp.Ordered](a, b []T) bool {
 	slices.Sort(b)
 	return reflect.DeepEqual(a, b)
 }
+
+type icCatchTrash struct {
+	icCatchUploadsAssets
+	trashed []string
+}
+
+func (c *icCatchTrash) DeleteAssets(ctx context.Context, ids []string, force bool) error {
+	if !force {
+		c.trashed = append(c.trashed, ids...)
+	}
+	return nil
+}
+
+func TestUploadTrashed(t *testing.T) {
+	testCases := []struct {
+		name            string
+		args            []string
+		expectedAssets  []string
+		expectedTrashed []string
+		expectedAlbums  map[string][]string
+	}{
+		{
+			name: "skip",
+			args: []string{"-google-photos", "TEST_DATA/Takeout4"},
+			expectedAssets: []string{
+				"Google Photos/Trip/PXL_20231006_063000139.jpg",
+			},
+			expectedTrashed: []string{},
+			expectedAlbums: map[string][]string{
+				"Trip": {"Google Photos/Trip/PXL_20231006_063000139.jpg"},
+			},
+		},
+		{
+			name: "trash",
+			args: []string{"-google-photos", "-trashed=trash", "TEST_DATA/Takeout4"},
+			expectedAssets: []string{
+				"Google Photos/Trip/PXL_20231006_063000139.jpg",
+				"Google Photos/Trip/PXL_20231006_063029647.jpg",
+			},
+			expectedTrashed: []string{
+				"Google Photos/Trip/PXL_20231006_063029647.jpg",
+			},
+			expectedAlbums: map[string][]string{
+				"Trip": {"Google Photos/Trip/PXL_20231006_063000139.jpg"},
+			},
+		},
+		{
+			name: "keep",
+			args: []string{"-google-photos", "-trashed=keep", "TEST_DATA/Takeout4"},
+			expectedAssets: []string{
+				"Google Photos/Trip/PXL_20231006_063000139.jpg",
+				"Google Photos/Trip/PXL_20231006_063029647.jpg",
+			},
+			expectedTrashed: []string{},
+			expectedAlbums: map[string][]string{
+				"Trip": {
+					"Google Photos/Trip/PXL_20231006_063000139.jpg",
+					"Google Photos/Trip/PXL_20231006_063029647.jpg",
+				},
+			},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			ic := &icCatchTrash{
+				icCatchUploadsAssets: icCatchUploadsAssets{albums: map[string][]string{}},
+				trashed:              []string{},
+			}
+			log := slog.New(slog.NewTextHandler(io.Discard, nil))
+			serv := cmd.SharedFlags{
+				Immich: ic,
+				Jnl:    fileevent.NewRecorder(log, false),
+				Log:    log,
+			}
+			err := UploadCommand(context.Background(), &serv, append([]string{"-no-ui"}, tc.args...))
+			if err != nil {
+				t.Errorf("unexpected error: %s", err)
+				return
+			}
+			if !cmpSlices(tc.expectedAssets, ic.assets) {
+				t.Errorf("expected upload differs ")
+				pretty.Ldiff(t, tc.expectedAssets, ic.assets)
+			}
+			if !cmpSlices(tc.expectedTrashed, ic.trashed) {
+				t.Errorf("expected trash differs ")
+				pretty.Ldiff(t, tc.expectedTrashed, ic.trashed)
+			}
+			if !cmpAlbums(tc.expectedAlbums, ic.albums) {
+				t.Errorf("expected albums differs ")
+				pretty.Ldiff(t, tc.expectedAlbums, ic.albums)
+			}
+		})
+	}
+}
+
+func TestUploadTrashedAndVisibleCopy(t *testing.T) {
+	dir := t.TempDir()
+	files := map[string]string{
+		"Google Photos/Photos from 2023/IMG_0001.jpg":      "same content",
+		"Google Photos/Photos from 2023/IMG_0001.jpg.json": `{"title":"IMG_0001.jpg","photoTakenTime":{"timestamp":"1672567200"},"trashed":true}`,
+		"Google Photos/Trip/IMG_0002.jpg":                  "same content",
+		"Google Photos/Trip/IMG_0002.jpg.json":             `{"title":"IMG_0002.jpg","photoTakenTime":{"timestamp":"1672653600"}}`,
+		"Google Photos/Trip/metadata.json":                 `{"title":"Trip","date":{"timestamp":"1672653600"}}`,
+	}
+	for name, content := range files {
+		name = filepath.Join(dir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(name), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(name, []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	ic := &icCatchTrash{
+		icCatchUploadsAssets: icCatchUploadsAssets{albums: map[string][]string{}},
+		trashed:              []string{},
+	}
+	log := slog.New(slog.NewTextHandler(io.Discard, nil))
+	serv := cmd.SharedFlags{
+		Immich: ic,
+		Jnl:    fileevent.NewRecorder(log, false),
+		Log:    log,
+	}
+	err := UploadCommand(context.Background(), &serv, []string{"-no-ui", "-google-photos", "-trashed=trash", "-device-asset-id=HASH", "-order=oldest", dir})
+	if err != nil {
+		t.Fatal(err)
+	}
+	expectedAssets := []string{"Google Photos/Photos from 2023/IMG_0001.jpg", "Google Photos/Trip/IMG_0002.jpg"}
+	if !cmpSlices(expectedAssets, ic.assets) {
+		t.Errorf("expecting the assets %v, got %v", expectedAssets, ic.assets)
+	}
+	expectedTrashed := []string{"Google Photos/Photos from 2023/IMG_0001.jpg"}
+	if !cmpSlices(expectedTrashed, ic.trashed) {
+		t.Errorf("expecting the trashed assets %v, got %v", expectedTrashed, ic.trashed)
+	}
+	expectedAlbums := map[string][]string{"Trip": {"Google Photos/Trip/IMG_0002.jpg"}}
+	if !cmpAlbums(expectedAlbums, ic.albums) {
+		t.Errorf("expecting the albums %v, got %v", expectedAlbums, ic.albums)
+	}
+}
+
+type icFailUpload struct {
+	icCatchUploadsAssets
+	fail string
+}
+
+func (c *icFailUpload) AssetUpload(ctx context.Context, a *browser.LocalAssetFile) (immich.AssetResponse, error) {
+	if strings.Contains(a.FileName, c.fail) {
+		return immich.AssetResponse{}, errors.New("server error")
+	}
+	return c.icCatchUploadsAssets.AssetUpload(ctx, a)
+}
+
+func TestUploadQuarantine(t *testing.T) {
+	dir := t.TempDir()
+	ic := &icFailUpload{
+		icCatchUploadsAssets: icCatchUploadsAssets{albums: map[string][]string{}},
+		fail:                 "063029647",
+	}
+	log := slog.New(slog.NewTextHandler(io.Discard, nil))
+	serv := cmd.SharedFlags{
+		Immich: ic,
+		Jnl:    fileevent.NewRecorder(log, false),
+		Log:    log,
+	}
+	err := UploadCommand(context.Background(), &serv, []string{"-no-ui", "-google-photos", "-trashed=keep", "-quarantine=" + dir, "TEST_DATA/Takeout4"})
+	if err == nil {
+		t.Error("expecting an error message")
+	}
+
+	base := filepath.Join(dir, "Takeout4", "Google Photos", "Trip")
+	for _, f := range []string{"PXL_20231006_063029647.jpg", "PXL_20231006_063029647.jpg.json", "PXL_20231006_063029647.jpg.reason.txt"} {
+		if _, err := os.Stat(filepath.Join(base, f)); err != nil {
+			t.Errorf("missing file in the quarantine: %s", err)
+		}
+	}
+	if _, err := os.Stat(filepath.Join(base, "PXL_20231006_063000139.jpg")); err == nil {
+		t.Error("the uploaded file should not be in the quarantine")
+	}
+}
+
+func TestUploadRetry(t *testing.T) {
+	logFile := filepath.Join(t.TempDir(), "first.log")
+	f, err := os.Create(logFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ic := &icFailUpload{
+		icCatchUploadsAssets: icCatchUploadsAssets{albums: map[string][]string{}},
+		fail:                 "063029647",
+	}
+	log := slog.New(slog.NewJSONHandler(f, nil))
+	serv := cmd.SharedFlags{
+		Immich: ic,
+		Jnl:    fileevent.NewRecorder(log, false),
+		Log:    log,
+	}
+	_ = UploadCommand(context.Background(), &serv, []string{"-no-ui", "-google-photos", "-trashed=keep", "TEST_DATA/Takeout4"})
+	f.Close()
+
+	retry := &icCatchUploadsAssets{albums: map[string][]string{}}
+	log = slog.New(slog.NewTextHandler(io.Discard, nil))
+	serv = cmd.SharedFlags{
+		Immich: retry,
+		Jnl:    fileevent.NewRecorder(log, false),
+		Log:    log,
+	}
+	err = UploadCommand(context.Background(), &serv, []string{"-no-ui", "-google-photos", "-trashed=keep", "-retry-from=" + logFile, "TEST_DATA/Takeout4"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []string{"Google Photos/Trip/PXL_20231006_063029647.jpg"}
+	if !cmpSlices(expected, retry.assets) {
+		t.Errorf("expecting assets %v, got %v", expected, retry.assets)
+	}
+	expectedAlbums := map[string][]string{"Trip": {"Google Photos/Trip/PXL_20231006_063029647.jpg"}}
+	if !cmpAlbums(expectedAlbums, retry.albums) {
+		t.Errorf("expecting albums %v, got %v", expectedAlbums, retry.albums)
+	}
+}
+
+func TestUploadIncremental(t *testing.T) {
+	t.Setenv("XDG_CACHE_HOME", t.TempDir())
+	log := slog.New(slog.NewTextHandler(io.Discard, nil))
+	upload := func(ic immich.ImmichInterface) error {
+		serv := cmd.SharedFlags{
+			Immich: ic,
+			Jnl:    fileevent.NewRecorder(log, false),
+			Log:    log,
+		}
+		return UploadCommand(context.Background(), &serv, []string{"-no-ui", "-incremental", "TEST_DATA/folder/high"})
+	}
+
+	first := &icFailUpload{
+		icCatchUploadsAssets: icCatchUploadsAssets{albums: map[string][]string{}},
+		fail:                 "063029647",
+	}
+	if err := upload(first); err == nil {
+		t.Error("expecting an error message")
+	}
+	if len(first.assets) != 7 {
+		t.Errorf("expecting 7 assets uploaded by the first run, got %v", first.assets)
+	}
+
+	second := &icCatchUploadsAssets{albums: map[string][]string{}}
+	if err := upload(second); err != nil {
+		t.Fatal(err)
+	}
+	expected := []string{"AlbumA/PXL_20231006_063029647.jpg"}
+	if !cmpSlices(expected, second.assets) {
+		t.Errorf("expecting assets %v, got %v", expected, second.assets)
+	}
+
+	third := &icCatchUploadsAssets{albums: map[string][]string{}}
+	if err := upload(third); err != nil {
+		t.Fatal(err)
+	}
+	if len(third.assets) != 0 {
+		t.Errorf("expecting no upload, got %v", third.assets)
+	}
+}
+
+func TestUploadOrder(t *testing.T) {
+	tc := []struct {
+		order    string
+		expected []string
+	}{
+		{
+			order: "newest",
+			expected: []string{
+				"AlbumB/PXL_20231006_063851485.jpg",
+				"AlbumB/PXL_20231006_063536303.jpg",
+				"AlbumB/PXL_20231006_063528961.jpg",
+				"AlbumA/PXL_20231006_063357420.jpg",
+				"AlbumA/PXL_20231006_063121958.jpg",
+				"AlbumA/PXL_20231006_063108407.jpg",
+				"AlbumA/PXL_20231006_063029647.jpg",
+				"AlbumA/PXL_20231006_063000139.jpg",
+			},
+		},
+		{
+			order: "size-asc",
+			expected: []string{
+				"AlbumA/PXL_20231006_063029647.jpg",
+				"AlbumB/PXL_20231006_063536303.jpg",
+				"AlbumB/PXL_20231006_063528961.jpg",
+				"AlbumA/PXL_20231006_063357420.jpg",
+				"AlbumA/PXL_20231006_063108407.jpg",
+				"AlbumA/PXL_20231006_063121958.jpg",
+				"AlbumB/PXL_20231006_063851485.jpg",
+				"AlbumA/PXL_20231006_063000139.jpg",
+			},
+		},
+	}
+	for _, c := range tc {
+		t.Run(c.order, func(t *testing.T) {
+			ic := &icCatchUploadsAssets{albums: map[string][]string{}}
+			log := slog.New(slog.NewTextHandler(io.Discard, nil))
+			serv := cmd.SharedFlags{
+				Immich: ic,
+				Jnl:    fileevent.NewRecorder(log, false),
+				Log:    log,
+			}
+			err := UploadCommand(context.Background(), &serv, []string{"-no-ui", "-order=" + c.order, "TEST_DATA/folder/high"})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !slices.Equal(c.expected, ic.assets) {
+				t.Errorf("expecting assets in the order %v, got %v", c.expected, ic.assets)
+			}
+		})
+	}
+}
+
+func TestUploadHooks(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("shell scripts aren't available")
+	}
+	dir := t.TempDir()
+	hook := filepath.Join(dir, "hook.sh")
+	err := os.WriteFile(hook, []byte(`#!/bin/sh
+case "$(cat)" in
+*063029647*) echo '{"veto":true,"reason":"not for the DAM"}';;
+*AlbumB*) echo '{"albums":["Hooked"]}';;
+esac
+`), 0o755)
+	if err != nil {
+		t.Fatal(err)
+	}
+	skipped := filepath.Join(dir, "skipped.txt")
+	onSkip := filepath.Join(dir, "on-skip.sh")
+	err = os.WriteFile(onSkip, []byte("#!/bin/sh\ncat >> "+skipped+"\necho >> "+skipped+"\n"), 0o755)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ic := &icCatchUploadsAssets{albums: map[string][]string{}}
+	log := slog.New(slog.NewTextHandler(io.Discard, nil))
+	serv := cmd.SharedFlags{
+		Immich: ic,
+		Jnl:    fileevent.NewRecorder(log, false),
+		Log:    log,
+	}
+	err = UploadCommand(context.Background(), &serv, []string{"-no-ui", "-create-album-folder", "-hook=before-upload=" + hook, "-hook=on-skip=" + onSkip, "TEST_DATA/folder/high"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := map[string][]string{
+		"AlbumA": {
+			"AlbumA/PXL_20231006_063000139.jpg",
+			"AlbumA/PXL_20231006_063108407.jpg",
+			"AlbumA/PXL_20231006_063121958.jpg",
+			"AlbumA/PXL_20231006_063357420.jpg",
+		},
+		"Hooked": {
+			"AlbumB/PXL_20231006_063528961.jpg",
+			"AlbumB/PXL_20231006_063536303.jpg",
+			"AlbumB/PXL_20231006_063851485.jpg",
+		},
+	}
+	if !cmpAlbums(expected, ic.albums) {
+		t.Errorf("expecting albums %v, got %v", expected, ic.albums)
+	}
+	b, err := os.ReadFile(skipped)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(b), `"decision":"vetoed","reason":"not for the DAM"`) {
+		t.Errorf("the on-skip hook should receive the vetoed asset: %s", b)
+	}
+}
+
+type icCatchStacks struct {
+	icCatchUploadsAssets
+	stacks map[string][]string
+}
+
+func (c *icCatchStacks) StackAssets(ctx context.Context, cover string, ids []string) error {
+	c.stacks[cover] = ids
+	return nil
+}
+
+func TestUploadRules(t *testing.T) {
+	rulesFile := filepath.Join(t.TempDir(), "rules.json")
+	err := os.WriteFile(rulesFile, []byte(`{
+  "rules": [
+    { "name": "not this one", "if": { "name": "*063029647*" }, "then": { "skip": true } },
+    { "name": "album B", "if": { "path": "AlbumB/", "gps": false }, "then": { "add-album": "Ruled", "stack-with": "{dir}" } }
+  ]
+}`), 0o644)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ic := &icCatchStacks{
+		icCatchUploadsAssets: icCatchUploadsAssets{albums: map[string][]string{}},
+		stacks:               map[string][]string{},
+	}
+	log := slog.New(slog.NewTextHandler(io.Discard, nil))
+	serv := cmd.SharedFlags{
+		Immich: ic,
+		Jnl:    fileevent.NewRecorder(log, false),
+		Log:    log,
+	}
+	err = UploadCommand(context.Background(), &serv, []string{"-no-ui", "-create-album-folder", "-rules=" + rulesFile, "TEST_DATA/folder/high"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	albumB := []string{
+		"AlbumB/PXL_20231006_063528961.jpg",
+		"AlbumB/PXL_20231006_063536303.jpg",
+		"AlbumB/PXL_20231006_063851485.jpg",
+	}
+	expected := map[string][]string{
+		"AlbumA": {
+			"AlbumA/PXL_20231006_063000139.jpg",
+			"AlbumA/PXL_20231006_063108407.jpg",
+			"AlbumA/PXL_20231006_063121958.jpg",
+			"AlbumA/PXL_20231006_063357420.jpg",
+		},
+		"AlbumB": albumB,
+		"Ruled":  albumB,
+	}
+	if !cmpAlbums(expected, ic.albums) {
+		t.Errorf("expecting albums %v, got %v", expected, ic.albums)
+	}
+	if len(ic.stacks) != 1 {
+		t.Fatalf("expecting one stack, got %v", ic.stacks)
+	}
+	for _, ids := range ic.stacks {
+		if !cmpSlices(albumB, ids) {
+			t.Errorf("expecting the stack %v, got %v", albumB, ids)
+		}
+	}
+	if n := serv.Jnl.GetCounts()[fileevent.Ruled]; n != 4 {
+		t.Errorf("expecting 4 files matched by a rule, got %d", n)
+	}
+}
+
+func TestUploadDryRun(t *testing.T) {
+	ic := &icCatchUploadsAssets{albums: map[string][]string{}}
+	log := slog.New(slog.NewTextHandler(io.Discard, nil))
+	serv := cmd.SharedFlags{
+		Immich: ic,
+		Jnl:    fileevent.NewRecorder(log, false),
+		Log:    log,
+	}
+	err := UploadCommand(context.Background(), &serv, []string{"-no-ui", "-dry-run", "-create-album-folder", "TEST_DATA/folder/high"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(ic.assets) > 0 || len(ic.albums) > 0 {
+		t.Errorf("the server shouldn't be changed, got the assets %v and the albums %v", ic.assets, ic.albums)
+	}
+	counts := serv.Jnl.GetCounts()
+	if counts[fileevent.Uploaded] != 8 {
+		t.Errorf("expecting 8 simulated uploads, got %d", counts[fileevent.Uploaded])
+	}
+	if counts[fileevent.UploadAddToAlbum] != 8 {
+		t.Errorf("expecting 8 simulated additions to albums, got %d", counts[fileevent.UploadAddToAlbum])
+	}
+}
+
+func TestUploadServerSnapshot(t *testing.T) {
+	snap := &immich.Snapshot{
+		Version:        1,
+		Server:         "http://immich:2283",
+		SupportedMedia: immich.DefaultSupportedMedia,
+		Assets: []*immich.Asset{
+			{ID: "server-1", OriginalFileName: "PXL_20231006_063000139.jpg", ExifInfo: immich.ExifInfo{FileSizeInByte: 147869}},
+		},
+		Albums:      []immich.AlbumSimplified{{ID: "album-1", AlbumName: "AlbumA"}},
+		AlbumAssets: map[string][]string{"album-1": {"server-1"}},
+	}
+	file := filepath.Join(t.TempDir(), "snapshot.gz")
+	err := snap.Save(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	log := slog.New(slog.NewTextHandler(io.Discard, nil))
+	serv := cmd.SharedFlags{
+		Jnl: fileevent.NewRecorder(log, false),
+		Log: log,
+	}
+	err = UploadCommand(context.Background(), &serv, []string{"-no-ui", "-server-snapshot=" + file, "TEST_DATA/folder/high"})
+	if err == nil {
+		t.Error("the option -server-snapshot should require -dry-run")
+	}
+
+	serv = cmd.SharedFlags{
+		Jnl: fileevent.NewRecorder(log, false),
+		Log: log,
+	}
+	err = UploadCommand(context.Background(), &serv, []string{"-no-ui", "-dry-run", "-server-snapshot=" + file, "-create-album-folder", "TEST_DATA/folder/high"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	counts := serv.Jnl.GetCounts()
+	if counts[fileevent.Uploaded] != 7 {
+		t.Errorf("expecting 7 simulated uploads, got %d", counts[fileevent.Uploaded])
+	}
+	if counts[fileevent.UploadServerDuplicate] != 1 {
+		t.Errorf("expecting 1 asset already on the server, got %d", counts[fileevent.UploadServerDuplicate])
+	}
+}
+
+// icCatchAlbumInfo catches the changes of the albums' cover and order
+type icCatchAlbumInfo struct {
+	icCatchUploadsAssets
+	updates map[string][]immich.AlbumInfoUpdate
+}
+
+func (c *icCatchAlbumInfo) UpdateAlbumInfo(ctx context.Context, id string, update immich.AlbumInfoUpdate) error {
+	c.updates[id] = append(c.updates[id], update)
+	return nil
+}
+
+func TestUploadAlbumFile(t *testing.T) {
+	dir := t.TempDir()
+	files := map[string]string{
+		"Summer/PXL_20230801_120000000.jpg":  "jpg",
+		"Summer/PXL_20230802_120000000.jpg":  "jpg",
+		"Summer/album.json":                  `{"title":"Holidays","description":"Brittany","cover":"PXL_20230802_120000000.jpg","order":"desc"}`,
+		"Winter/PXL_20231201_120000000.jpg":  "jpg",
+		"Private/PXL_20230901_120000000.jpg": "jpg",
+		"Private/.immichskip":                "",
+	}
+	for name, content := range files {
+		name = filepath.Join(dir, name)
+		err := os.MkdirAll(filepath.Dir(name), 0o755)
+		if err == nil {
+			err = os.WriteFile(name, []byte(content), 0o644)
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	tc := []struct {
+		name    string
+		args    []string
+		albums  map[string][]string
+		updates map[string][]immich.AlbumInfoUpdate
+	}{
+		{
+			name: "album files",
+			args: []string{"-create-album-folder"},
+			albums: map[string][]string{
+				"Holidays": {"Summer/PXL_20230801_120000000.jpg", "Summer/PXL_20230802_120000000.jpg"},
+				"Winter":   {"Winter/PXL_20231201_120000000.jpg"},
+			},
+			updates: map[string][]immich.AlbumInfoUpdate{
+				"Holidays": {
+					{Order: "desc"},
+					{AlbumThumbnailAssetID: "Summer/PXL_20230802_120000000.jpg"},
+				},
+			},
+		},
+		{
+			name: "album files ignored",
+			args: []string{"-create-album-folder", "-create-albums=false"},
+			albums: map[string][]string{
+				"Summer": {"Summer/PXL_20230801_120000000.jpg", "Summer/PXL_20230802_120000000.jpg"},
+				"Winter": {"Winter/PXL_20231201_120000000.jpg"},
+			},
+			updates: map[string][]immich.AlbumInfoUpdate{},
+		},
+	}
+	for _, c := range tc {
+		t.Run(c.name, func(t *testing.T) {
+			ic := &icCatchAlbumInfo{
+				icCatchUploadsAssets: icCatchUploadsAssets{albums: map[string][]string{}},
+				updates:              map[string][]immich.AlbumInfoUpdate{},
+			}
+			log := slog.New(slog.NewTextHandler(io.Discard, nil))
+			serv := cmd.SharedFlags{
+				Immich: ic,
+				Jnl:    fileevent.NewRecorder(log, false),
+				Log:    log,
+			}
+			err := UploadCommand(context.Background(), &serv, append(append([]string{"-no-ui"}, c.args...), dir))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !cmpAlbums(c.albums, ic.albums) {
+				t.Errorf("expecting albums %v, got %v", c.albums, ic.albums)
+			}
+			if !reflect.DeepEqual(c.updates, ic.updates) {
+				t.Errorf("expecting the album updates %v, got %v", c.updates, ic.updates)
+			}
+		})
+	}
+}
+
+func TestUploadHardLinkAlbums(t *testing.T) {
+	dir := t.TempDir()
+	files := map[string]string{
+		"Summer/PXL_20230801_120000000.jpg": "jpg",
+		"Trip/album.json":                   `{"title":"Best of","cover":"PXL_20230801_120000000.jpg"}`,
+	}
+	for name, content := range files {
+		name = filepath.Join(dir, name)
+		err := os.MkdirAll(filepath.Dir(name), 0o755)
+		if err == nil {
+			err = os.WriteFile(name, []byte(content), 0o644)
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := os.MkdirAll(filepath.Join(dir, "Family"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	for _, link := range []string{"Trip/PXL_20230801_120000000.jpg", "Family/PXL_20230801_120000000.jpg"} {
+		if err := os.Link(filepath.Join(dir, "Summer/PXL_20230801_120000000.jpg"), filepath.Join(dir, link)); err != nil {
+			t.Skip("hard links not supported:", err)
+		}
+	}
+	if info, err := os.Stat(filepath.Join(dir, "Family/PXL_20230801_120000000.jpg")); err != nil {
+		t.Fatal(err)
+	} else if _, ok := fshelper.FileIDOf(info); !ok {
+		t.Skip("files can't be identified on this OS")
+	}
+
+	ic := &icCatchAlbumInfo{
+		icCatchUploadsAssets: icCatchUploadsAssets{albums: map[string][]string{}},
+		updates:              map[string][]immich.AlbumInfoUpdate{},
+	}
+	log := slog.New(slog.NewTextHandler(io.Discard, nil))
+	serv := cmd.SharedFlags{
+		Immich: ic,
+		Jnl:    fileevent.NewRecorder(log, false),
+		Log:    log,
+	}
+	err := UploadCommand(context.Background(), &serv, []string{"-no-ui", "-create-album-folder", dir})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// the album file of the other path replaces its folder's name
+	expectedAlbums := map[string][]string{
+		"Summer":  {"Family/PXL_20230801_120000000.jpg"},
+		"Best of": {"Family/PXL_20230801_120000000.jpg"},
+		"Family":  {"Family/PXL_20230801_120000000.jpg"},
+	}
+	if !cmpAlbums(expectedAlbums, ic.albums) {
+		t.Errorf("expecting albums %v, got %v", expectedAlbums, ic.albums)
+	}
+	expectedUpdates := map[string][]immich.AlbumInfoUpdate{
+		"Best of": {{AlbumThumbnailAssetID: "Family/PXL_20230801_120000000.jpg"}},
+	}
+	if !reflect.DeepEqual(expectedUpdates, ic.updates) {
+		t.Errorf("expecting the album updates %v, got %v", expectedUpdates, ic.updates)
+	}
+}
+
+func TestUploadAppleEdits(t *testing.T) {
+	tc := []struct {
+		keep   string
+		assets []string
+		stacks map[string][]string
+	}{
+		{
+			keep:   "STACK",
+			assets: []string{"IMG_1234.HEIC", "IMG_E1234.JPG"},
+			stacks: map[string][]string{"IMG_E1234.JPG": {"IMG_1234.HEIC"}},
+		},
+		{
+			keep:   "edit",
+			assets: []string{"IMG_E1234.JPG"},
+			stacks: map[string][]string{},
+		},
+		{
+			keep:   "ORIGINAL",
+			assets: []string{"IMG_1234.HEIC"},
+			stacks: map[string][]string{},
+		},
+	}
+	for _, c := range tc {
+		t.Run(c.keep, func(t *testing.T) {
+			dir := t.TempDir()
+			for _, name := range []string{"IMG_1234.HEIC", "IMG_E1234.JPG"} {
+				if err := os.WriteFile(filepath.Join(dir, name), []byte(name), 0o644); err != nil {
+					t.Fatal(err)
+				}
+			}
+			ic := &icCatchStacks{
+				icCatchUploadsAssets: icCatchUploadsAssets{albums: map[string][]string{}},
+				stacks:               map[string][]string{},
+			}
+			log := slog.New(slog.NewTextHandler(io.Discard, nil))
+			serv := cmd.SharedFlags{
+				Immich: ic,
+				Jnl:    fileevent.NewRecorder(log, false),
+				Log:    log,
+			}
+			err := UploadCommand(context.Background(), &serv, []string{"-no-ui", "-apple-edits=" + c.keep, dir})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !cmpSlices(c.assets, ic.assets) {
+				t.Errorf("expecting the assets %v, got %v", c.assets, ic.assets)
+			}
+			if !reflect.DeepEqual(c.stacks, ic.stacks) {
+				t.Errorf("expecting the stacks %v, got %v", c.stacks, ic.stacks)
+			}
+		})
+	}
+}
+
+func TestUploadDamagedZip(t *testing.T) {
+	var b bytes.Buffer
+	w := zip.NewWriter(&b)
+	for _, name := range []string{"photos/IMG_0001.jpg", "photos/IMG_0002.jpg"} {
+		f, err := w.Create(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err = f.Write(bytes.Repeat([]byte(name), 100)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	data := b.Bytes()
+	name := filepath.Join(t.TempDir(), "photos.zip")
+	// the download stopped in the middle of the second photo
+	if err := os.WriteFile(name, data[:bytes.Index(data, []byte("photos/IMG_0002.jpg"))+30], 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	ic := &icCatchUploadsAssets{albums: map[string][]string{}}
+	log := slog.New(slog.NewTextHandler(io.Discard, nil))
+	serv := cmd.SharedFlags{
+		Immich: ic,
+		Jnl:    fileevent.NewRecorder(log, false),
+		Log:    log,
+	}
+	err := UploadCommand(context.Background(), &serv, []string{"-no-ui", name})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !cmpSlices([]string{"photos/IMG_0001.jpg"}, ic.assets) {
+		t.Errorf("expecting the readable photo, got %v", ic.assets)
+	}
+	if lost := serv.Jnl.GetCounts()[fileevent.DiscoveredLost]; lost != 1 {
+		t.Errorf("expecting 1 lost file, got %d", lost)
+	}
+}
+
+type icCatchFavorites struct {
+	icCatchUploadsAssets
+	favorites []string
+}
+
+func (c *icCatchFavorites) AssetUpload(ctx context.Context, a *browser.LocalAssetFile) (immich.AssetResponse, error) {
+	if a.Favorite {
+		c.favorites = append(c.favorites, a.FileName)
+	}
+	return c.icCatchUploadsAssets.AssetUpload(ctx, a)
+}
+
+// writeTgz writes the files in a compressed tar archive
+func writeTgz(t *testing.T, name string, files map[string]string) {
+	f, err := os.Create(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	gz := gzip.NewWriter(f)
+	defer gz.Close()
+	tw := tar.NewWriter(gz)
+	defer tw.Close()
+	for n, content := range files {
+		err = tw.WriteHeader(&tar.Header{Name: n, Typeflag: tar.TypeReg, Mode: 0o644, Size: int64(len(content))})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err = tw.Write([]byte(content)); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestUploadTakeoutTgzParts(t *testing.T) {
+	dir := t.TempDir()
+	// the JSON files are in the first part, the photos in the second one
+	writeTgz(t, filepath.Join(dir, "takeout-001.tgz"), map[string]string{
+		"Takeout/Google Photos/Photos from 2023/IMG_0001.jpg.json": `{"title":"IMG_0001.jpg","photoTakenTime":{"timestamp":"1672567200"},"favorited":true}`,
+		"Takeout/Google Photos/Trip/IMG_0002.jpg.json":             `{"title":"IMG_0002.jpg","photoTakenTime":{"timestamp":"1672653600"}}`,
+		"Takeout/Google Photos/Trip/metadata.json":                 `{"title":"Trip","date":{"timestamp":"1672653600"}}`,
+	})
+	writeTgz(t, filepath.Join(dir, "takeout-002.tgz"), map[string]string{
+		"Takeout/Google Photos/Photos from 2023/IMG_0001.jpg": "first photo",
+		"Takeout/Google Photos/Trip/IMG_0002.jpg":             "second photo",
+	})
+
+	tc := []struct {
+		name  string
+		limit int
+	}{
+		{name: "index in memory", limit: fshelper.ArchiveIndexMemoryLimit},
+		{name: "index in a temporary file", limit: 1},
+	}
+	for _, c := range tc {
+		t.Run(c.name, func(t *testing.T) {
+			defer func(limit int) { fshelper.ArchiveIndexMemoryLimit = limit }(fshelper.ArchiveIndexMemoryLimit)
+			fshelper.ArchiveIndexMemoryLimit = c.limit
+
+			ic := &icCatchFavorites{icCatchUploadsAssets: icCatchUploadsAssets{albums: map[string][]string{}}}
+			log := slog.New(slog.NewTextHandler(io.Discard, nil))
+			serv := cmd.SharedFlags{
+				Immich: ic,
+				Jnl:    fileevent.NewRecorder(log, false),
+				Log:    log,
+			}
+			err := UploadCommand(context.Background(), &serv, []string{"-no-ui", "-google-photos", filepath.Join(dir, "takeout-*.tgz")})
+			if err != nil {
+				t.Fatal(err)
+			}
+			expectedAssets := []string{"Takeout/Google Photos/Photos from 2023/IMG_0001.jpg", "Takeout/Google Photos/Trip/IMG_0002.jpg"}
+			if !cmpSlices(expectedAssets, ic.assets) {
+				t.Errorf("expecting the assets %v, got %v", expectedAssets, ic.assets)
+			}
+			expectedFavorites := []string{"Takeout/Google Photos/Photos from 2023/IMG_0001.jpg"}
+			if !cmpSlices(expectedFavorites, ic.favorites) {
+				t.Errorf("expecting the favorites %v, got %v", expectedFavorites, ic.favorites)
+			}
+			expectedAlbums := map[string][]string{"Trip": {"Takeout/Google Photos/Trip/IMG_0002.jpg"}}
+			if !cmpAlbums(expectedAlbums, ic.albums) {
+				t.Errorf("expecting the albums %v, got %v", expectedAlbums, ic.albums)
+			}
+		})
+	}
+}
@@ -76,3 +76,13 @@ func MakeDirForFile(f string) error {
 	dir := filepath.Dir(f)
 	return os.MkdirAll(dir, 0o700)
 }
+
+// DefaultStateDir gives the folder of the incremental states
+// Return a local folder when $HOME not $XDG_CACHE_HOME are not set
+func DefaultStateDir() string {
+	d, err := os.UserCacheDir()
+	if err != nil {
+		return "immich-go-state"
+	}
+	return filepath.Join(d, "immich-go", "incremental")
+}
@@ -0,0 +1,202 @@
+// Package extsort sorts key/value entries with a bounded memory.
+//
+// Entries are kept in memory up to a limit. Beyond, they are sorted and
+// written into temporary files, merged when reading back the sorted entries.
+package extsort
+
+import (
+	"bufio"
+	"container/heap"
+	"encoding/binary"
+	"errors"
+	"io"
+	"os"
+	"sort"
+)
+
+// DefaultChunkSize is the number of entries kept in memory before spilling them to the disk
+const DefaultChunkSize = 100_000
+
+// Entry is a value to sort by its key
+type Entry struct {
+	Key   string
+	Value []byte
+}
+
+// Sorter collects the entries to sort
+type Sorter struct {
+	chunkSize int
+	entries   []Entry
+	runs      []*os.File // sorted runs spilled to the disk
+}
+
+// New gives a sorter keeping at most chunkSize entries in memory
+func New(chunkSize int) *Sorter {
+	if chunkSize <= 0 {
+		chunkSize = DefaultChunkSize
+	}
+	return &Sorter{chunkSize: chunkSize}
+}
+
+// Add an entry to the sorter
+func (s *Sorter) Add(key string, value []byte) error {
+	s.entries = append(s.entries, Entry{Key: key, Value: value})
+	if len(s.entries) >= s.chunkSize {
+		return s.spill()
+	}
+	return nil
+}
+
+// spill writes the sorted entries into a temporary file
+func (s *Sorter) spill() error {
+	s.sortEntries()
+	f, err := os.CreateTemp("", "immich-go_sort_*.tmp")
+	if err != nil {
+		return err
+	}
+	s.runs = append(s.runs, f)
+	w := bufio.NewWriter(f)
+	for _, e := range s.entries {
+		err = writeEntry(w, e)
+		if err != nil {
+			return err
+		}
+	}
+	s.entries = s.entries[:0]
+	return w.Flush()
+}
+
+func (s *Sorter) sortEntries() {
+	sort.SliceStable(s.entries, func(i, j int) bool {
+		return s.entries[i].Key < s.entries[j].Key
+	})
+}
+
+// Sort calls fn with each entry, in the order of the keys.
+// Entries with the same key are given in their order of addition.
+func (s *Sorter) Sort(fn func(Entry) error) error {
+	if len(s.runs) == 0 {
+		s.sortEntries()
+		for _, e := range s.entries {
+			if err := fn(e); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	if len(s.entries) > 0 {
+		if err := s.spill(); err != nil {
+			return err
+		}
+	}
+	h := mergeHeap{}
+	for i, f := range s.runs {
+		if _, err := f.Seek(0, io.SeekStart); err != nil {
+			return err
+		}
+		r := &run{index: i, r: bufio.NewReader(f)}
+		ok, err := r.next()
+		if err != nil {
+			return err
+		}
+		if ok {
+			h = append(h, r)
+		}
+	}
+	heap.Init(&h)
+	for h.Len() > 0 {
+		r := h[0]
+		if err := fn(r.entry); err != nil {
+			return err
+		}
+		ok, err := r.next()
+		if err != nil {
+			return err
+		}
+		if ok {
+			heap.Fix(&h, 0)
+		} else {
+			heap.Pop(&h)
+		}
+	}
+	return nil
+}
+
+// Close removes the temporary files
+func (s *Sorter) Close() error {
+	var errs error
+	for _, f := range s.runs {
+		errs = errors.Join(errs, f.Close(), os.Remove(f.Name()))
+	}
+	s.runs = nil
+	s.entries = nil
+	return errs
+}
+
+func writeEntry(w *bufio.Writer, e Entry) error {
+	var b [binary.MaxVarintLen64]byte
+	for _, field := range [][]byte{[]byte(e.Key), e.Value} {
+		n := binary.PutUvarint(b[:], uint64(len(field)))
+		if _, err := w.Write(b[:n]); err != nil {
+			return err
+		}
+		if _, err := w.Write(field); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func readField(r *bufio.Reader) ([]byte, error) {
+	l, err := binary.ReadUvarint(r)
+	if err != nil {
+		return nil, err
+	}
+	b := make([]byte, l)
+	_, err = io.ReadFull(r, b)
+	return b, err
+}
+
+// run reads back a sorted run
+type run struct {
+	index int
+	r     *bufio.Reader
+	entry Entry
+}
+
+func (r *run) next() (bool, error) {
+	k, err := readField(r.r)
+	if err != nil {
+		if errors.Is(err, io.EOF) {
+			return false, nil
+		}
+		return false, err
+	}
+	v, err := readField(r.r)
+	if err != nil {
+		return false, err
+	}
+	r.entry = Entry{Key: string(k), Value: v}
+	return true, nil
+}
+
+// mergeHeap gives the run with the smallest key, the oldest run first for equal keys
+type mergeHeap []*run
+
+func (h mergeHeap) Len() int { return len(h) }
+func (h mergeHeap) Less(i, j int) bool {
+	if h[i].entry.Key == h[j].entry.Key {
+		return h[i].index < h[j].index
+	}
+	return h[i].entry.Key < h[j].entry.Key
+}
+func (h mergeHeap) Swap(i, j int) { h[i], h[j] = h[j], h[i] }
+func (h *mergeHeap) Push(x any)   { *h = append(*h, x.(*run)) }
+func (h *mergeHeap) Pop() any {
+	old := *h
+	n := len(old)
+	x := old[n-1]
+	*h = old[:n-1]
+	return x
+}
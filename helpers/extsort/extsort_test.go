@@ -0,0 +1,45 @@
+package extsort
+
+import (
+	"fmt"
+	"math/rand"
+	"testing"
+)
+
+func TestSort(t *testing.T) {
+	for _, chunk := range []int{1000, 7} {
+		t.Run(fmt.Sprintf("chunk %d", chunk), func(t *testing.T) {
+			s := New(chunk)
+			defer s.Close()
+
+			r := rand.New(rand.NewSource(1))
+			for i := 0; i < 100; i++ {
+				k := fmt.Sprintf("%03d", r.Intn(50))
+				err := s.Add(k, []byte(fmt.Sprintf("%s-%03d", k, i)))
+				if err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			count := 0
+			prev := Entry{}
+			err := s.Sort(func(e Entry) error {
+				if e.Key < prev.Key {
+					t.Errorf("%s given after %s", e.Key, prev.Key)
+				}
+				if e.Key == prev.Key && string(e.Value) < string(prev.Value) {
+					t.Errorf("%s given after %s, the order of addition is lost", e.Value, prev.Value)
+				}
+				prev = e
+				count++
+				return nil
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if count != 100 {
+				t.Errorf("expecting 100 entries, got %d", count)
+			}
+		})
+	}
+}
@@ -26,6 +26,8 @@ const (
 	DiscoveredSidecar                 // = "Scanned side car file"
 	DiscoveredDiscarded               // = "Discarded"
 	DiscoveredUnsupported             // = "File type not supported"
+	DiscoveredUnchanged               // = "unchanged since the last run"
+	DiscoveredLost                    // = "lost in a damaged archive"
 
 	AnalysisAssociatedMetadata
 	AnalysisMissingAssociatedMetadata
@@ -38,10 +40,14 @@ const (
 	UploadAlbumCreated
 	UploadAddToAlbum  // = "Added to an album"
 	UploadServerError // = "Server error"
+	UploadTrashed     // = "Moved to the trash"
 
 	Uploaded  // = "Uploaded"
 	Stacked   // = "Stacked"
 	LivePhoto // = "Live photo"
+	GeoTagged // = "geotagged from a track log"
+	Tagged    // = "tagged"
+	Ruled     // = "matched by a rule"
 	Metadata  // = "Metadata files"
 	INFO      // = "Info"
 	Error
@@ -54,6 +60,8 @@ var _code = map[Code]string{
 	DiscoveredSidecar:     "scanned sidecar file",
 	DiscoveredDiscarded:   "discarded file",
 	DiscoveredUnsupported: "unsupported file",
+	DiscoveredUnchanged:   "unchanged since the last run",
+	DiscoveredLost:        "lost in a damaged archive",
 
 	AnalysisAssociatedMetadata:        "associated metadata file",
 	AnalysisMissingAssociatedMetadata: "missing associated metadata file",
@@ -66,10 +74,14 @@ var _code = map[Code]string{
 	UploadServerBetter:    "server has a better asset",
 	UploadAlbumCreated:    "album created/updated",
 	UploadServerError:     "upload error",
+	UploadTrashed:         "moved to the trash",
 	Uploaded:              "uploaded",
 
 	Stacked:   "Stacked",
 	LivePhoto: "Live photo",
+	GeoTagged: "geotagged from a track log",
+	Tagged:    "tagged",
+	Ruled:     "matched by a rule",
 	Metadata:  "Metadata files",
 	INFO:      "Info",
 	Error:     "error",
@@ -88,6 +100,7 @@ type Recorder struct {
 	fileEvents map[string]map[Code]int
 	log        *slog.Logger
 	debug      bool
+	hooks      []func(code Code, file string)
 }
 
 func NewRecorder(l *slog.Logger, debug bool) *Recorder {
@@ -102,6 +115,9 @@ func NewRecorder(l *slog.Logger, debug bool) *Recorder {
 
 func (r *Recorder) Record(ctx context.Context, code Code, object any, file string, args ...any) {
 	atomic.AddInt64(&r.counts[code], 1)
+	for _, h := range r.hooks {
+		h(code, file)
+	}
 	if r.debug && file != "" {
 		r.lock.Lock()
 		events := r.fileEvents[file]
@@ -142,6 +158,12 @@ func (r *Recorder) SetLogger(l *slog.Logger) {
 	r.log = l
 }
 
+// AddHook registers a function called for each recorded event.
+// It must be called before recording events.
+func (r *Recorder) AddHook(fn func(code Code, file string)) {
+	r.hooks = append(r.hooks, fn)
+}
+
 func (r *Recorder) Report() {
 	sb := strings.Builder{}
 
@@ -154,6 +176,8 @@ func (r *Recorder) Report() {
 		DiscoveredSidecar,
 		DiscoveredDiscarded,
 		DiscoveredUnsupported,
+		DiscoveredUnchanged,
+		DiscoveredLost,
 		AnalysisLocalDuplicate,
 		AnalysisAssociatedMetadata,
 		AnalysisMissingAssociatedMetadata,
@@ -161,9 +185,26 @@ func (r *Recorder) Report() {
 		sb.WriteString(fmt.Sprintf("%-40s: %7d\n", c.String(), r.counts[c]))
 	}
 
+	r.writeUploads(&sb, "Uploading")
+
+	r.log.Info(sb.String())
+	fmt.Println(sb.String())
+}
+
+// ReportUploads reports only the upload counters under the given title
+func (r *Recorder) ReportUploads(title string) {
+	sb := strings.Builder{}
+	r.writeUploads(&sb, title)
+	if r.log != nil {
+		r.log.Info(sb.String())
+	}
+	fmt.Println(sb.String())
+}
+
+func (r *Recorder) writeUploads(sb *strings.Builder, title string) {
 	sb.WriteString("\n")
-	sb.WriteString("Uploading:\n")
-	sb.WriteString("----------\n")
+	sb.WriteString(title + ":\n")
+	sb.WriteString(strings.Repeat("-", len(title)+1) + "\n")
 	for _, c := range []Code{
 		Uploaded,
 		UploadServerError,
@@ -171,12 +212,10 @@ func (r *Recorder) Report() {
 		UploadUpgraded,
 		UploadServerDuplicate,
 		UploadServerBetter,
+		UploadTrashed,
 	} {
 		sb.WriteString(fmt.Sprintf("%-40s: %7d\n", c.String(), r.counts[c]))
 	}
-
-	r.log.Info(sb.String())
-	fmt.Println(sb.String())
 }
 
 func (r *Recorder) GetCounts() []int64 {
@@ -195,6 +234,7 @@ func (r *Recorder) WriteFileCounts(w io.Writer) error {
 		AnalysisAssociatedMetadata,
 		DiscoveredDiscarded,
 		DiscoveredUnsupported,
+		DiscoveredLost,
 		AnalysisLocalDuplicate,
 		UploadNotSelected,
 		UploadUpgraded,
@@ -252,6 +292,7 @@ func (r *Recorder) TotalProcessed(forcedMissingJSON bool) int64 {
 		atomic.LoadInt64(&r.counts[UploadServerDuplicate]) +
 		atomic.LoadInt64(&r.counts[UploadServerBetter]) +
 		atomic.LoadInt64(&r.counts[DiscoveredDiscarded]) +
+		atomic.LoadInt64(&r.counts[DiscoveredUnchanged]) +
 		atomic.LoadInt64(&r.counts[AnalysisLocalDuplicate])
 	if !forcedMissingJSON {
 		v += atomic.LoadInt64(&r.counts[AnalysisMissingAssociatedMetadata])
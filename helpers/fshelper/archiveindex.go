@@ -0,0 +1,369 @@
+package fshelper
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"hash/fnv"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// ArchiveIndexMemoryLimit is the number of files of an archive indexed in memory, the next ones are indexed in a temporary file
+var ArchiveIndexMemoryLimit = 100_000
+
+// archiveIndex lists the files and the folders of an archive read sequentially
+type archiveIndex struct {
+	entries map[string]*archiveEntry // the folders, and the files up to ArchiveIndexMemoryLimit
+	files   int                      // number of files in entries
+	spill   *indexSpill              // the files beyond ArchiveIndexMemoryLimit
+}
+
+type archiveEntry struct {
+	name    string
+	offset  int64 // position of the data in the archive
+	size    int64
+	csize   int64  // compressed size, zip only
+	method  uint16 // compression method, zip only
+	mode    fs.FileMode
+	modTime time.Time
+	files   []string // base names of the folder's entries kept in memory
+	spilled []int64  // positions of the folder's files in the temporary index
+}
+
+func newArchiveIndex() archiveIndex {
+	return archiveIndex{
+		entries: map[string]*archiveEntry{
+			".": {name: ".", mode: fs.ModeDir | 0o555},
+		},
+	}
+}
+
+// addEntry adds the entry and its parent folders, the archives don't always list the folders
+func (idx *archiveIndex) addEntry(e *archiveEntry) error {
+	if old, ok := idx.entries[e.name]; ok {
+		if old.mode.IsDir() && e.mode.IsDir() {
+			old.mode, old.modTime = e.mode, e.modTime
+			return nil
+		}
+		e.files, e.spilled = old.files, old.spilled
+		idx.entries[e.name] = e
+		return nil
+	}
+	pos := int64(-1)
+	if !e.mode.IsDir() {
+		if idx.files < ArchiveIndexMemoryLimit {
+			idx.files++
+		} else {
+			if idx.spill == nil {
+				s, err := newIndexSpill()
+				if err != nil {
+					return err
+				}
+				idx.spill = s
+			}
+			var err error
+			pos, err = idx.spill.add(e)
+			if err != nil {
+				return err
+			}
+		}
+	}
+	if pos < 0 {
+		idx.entries[e.name] = e
+	}
+	for name := e.name; name != "."; {
+		dir := path.Dir(name)
+		parent, ok := idx.entries[dir]
+		if !ok {
+			parent = &archiveEntry{name: dir, mode: fs.ModeDir | 0o555}
+			idx.entries[dir] = parent
+		}
+		if pos >= 0 {
+			parent.spilled = append(parent.spilled, pos)
+			pos = -1
+		} else {
+			parent.files = append(parent.files, path.Base(name))
+		}
+		if ok {
+			break
+		}
+		name = dir
+	}
+	return nil
+}
+
+// finish sorts the folders' entries and writes the temporary index once the index is complete
+func (idx *archiveIndex) finish() error {
+	for _, e := range idx.entries {
+		sort.Strings(e.files)
+	}
+	if idx.spill != nil {
+		return idx.spill.w.Flush()
+	}
+	return nil
+}
+
+// len gives the number of files and folders
+func (idx *archiveIndex) len() int {
+	n := len(idx.entries)
+	if idx.spill != nil {
+		n += idx.spill.count
+	}
+	return n
+}
+
+// closeIndex removes the temporary index
+func (idx *archiveIndex) closeIndex() error {
+	if idx.spill == nil {
+		return nil
+	}
+	err := idx.spill.close()
+	idx.spill = nil
+	return err
+}
+
+// cleanArchiveName gives the name of the entry as a valid path of the fs.FS
+func cleanArchiveName(name string) (string, bool) {
+	name = path.Clean(strings.TrimLeft(filepath.ToSlash(name), "/"))
+	if name == "." || !fs.ValidPath(name) {
+		return "", false
+	}
+	return name, true
+}
+
+func (idx *archiveIndex) lookup(op, name string) (*archiveEntry, error) {
+	if !fs.ValidPath(name) {
+		return nil, &fs.PathError{Op: op, Path: name, Err: fs.ErrInvalid}
+	}
+	e, ok := idx.entries[name]
+	if !ok && idx.spill != nil {
+		var err error
+		e, err = idx.spill.find(name)
+		if err != nil {
+			return nil, &fs.PathError{Op: op, Path: name, Err: err}
+		}
+		ok = e != nil
+	}
+	if !ok {
+		return nil, &fs.PathError{Op: op, Path: name, Err: fs.ErrNotExist}
+	}
+	return e, nil
+}
+
+func (idx *archiveIndex) Stat(name string) (fs.FileInfo, error) {
+	e, err := idx.lookup("stat", name)
+	if err != nil {
+		return nil, err
+	}
+	return e, nil
+}
+
+func (idx *archiveIndex) ReadDir(name string) ([]fs.DirEntry, error) {
+	e, err := idx.lookup("readdir", name)
+	if err != nil {
+		return nil, err
+	}
+	if !e.mode.IsDir() {
+		return nil, &fs.PathError{Op: "readdir", Path: name, Err: errors.New("not a directory")}
+	}
+	return idx.dirEntries(e)
+}
+
+func (idx *archiveIndex) dirEntries(e *archiveEntry) ([]fs.DirEntry, error) {
+	list := make([]fs.DirEntry, 0, len(e.files)+len(e.spilled))
+	for _, f := range e.files {
+		list = append(list, fs.FileInfoToDirEntry(idx.entries[path.Join(e.name, f)]))
+	}
+	if len(e.spilled) == 0 {
+		return list, nil
+	}
+	// the last entry of a name replaces the previous ones
+	latest := map[string]*archiveEntry{}
+	for _, pos := range e.spilled {
+		s, err := idx.spill.read(pos)
+		if err != nil {
+			return nil, &fs.PathError{Op: "readdir", Path: e.name, Err: err}
+		}
+		latest[s.name] = s
+	}
+	for _, s := range latest {
+		list = append(list, fs.FileInfoToDirEntry(s))
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].Name() < list[j].Name() })
+	return list, nil
+}
+
+// archiveEntry implements fs.FileInfo
+func (e *archiveEntry) Name() string       { return path.Base(e.name) }
+func (e *archiveEntry) Size() int64        { return e.size }
+func (e *archiveEntry) Mode() fs.FileMode  { return e.mode }
+func (e *archiveEntry) ModTime() time.Time { return e.modTime }
+func (e *archiveEntry) IsDir() bool        { return e.mode.IsDir() }
+func (e *archiveEntry) Sys() any           { return nil }
+
+// sectionFile is a file stored without compression
+type sectionFile struct {
+	*io.SectionReader
+	e *archiveEntry
+}
+
+func (f *sectionFile) Stat() (fs.FileInfo, error) { return f.e, nil }
+func (f *sectionFile) Close() error               { return nil }
+
+type archiveDir struct {
+	idx  *archiveIndex
+	e    *archiveEntry
+	list []fs.DirEntry // entries not yet given by ReadDir
+	read bool
+}
+
+func (d *archiveDir) Stat() (fs.FileInfo, error) { return d.e, nil }
+func (d *archiveDir) Close() error               { return nil }
+
+func (d *archiveDir) Read([]byte) (int, error) {
+	return 0, &fs.PathError{Op: "read", Path: d.e.name, Err: errors.New("is a directory")}
+}
+
+func (d *archiveDir) ReadDir(n int) ([]fs.DirEntry, error) {
+	if !d.read {
+		list, err := d.idx.dirEntries(d.e)
+		if err != nil {
+			return nil, err
+		}
+		d.list, d.read = list, true
+	}
+	if n <= 0 {
+		list := d.list
+		d.list = nil
+		return list, nil
+	}
+	if len(d.list) == 0 {
+		return nil, io.EOF
+	}
+	n = min(n, len(d.list))
+	list := d.list[:n]
+	d.list = d.list[n:]
+	return list, nil
+}
+
+// countingReader counts the bytes read
+type countingReader struct {
+	r io.Reader
+	n int64
+}
+
+func (c *countingReader) Read(b []byte) (int, error) {
+	n, err := c.r.Read(b)
+	c.n += int64(n)
+	return n, err
+}
+
+// indexSpill keeps the entries of the files in a temporary file.
+// Only the hashes of their names and their positions in the file are kept in memory.
+type indexSpill struct {
+	f      *os.File
+	w      *bufio.Writer
+	size   int64              // bytes written
+	count  int                // number of entries
+	byHash map[uint64][]int64 // positions of the entries by the hash of their name
+}
+
+// the record of an entry: name length, offset, size, compressed size, method, mode, modification time, then the name
+const indexRecordSize = 4 + 8 + 8 + 8 + 2 + 4 + 8
+
+func newIndexSpill() (*indexSpill, error) {
+	f, err := os.CreateTemp("", TempFilePattern)
+	if err != nil {
+		return nil, err
+	}
+	return &indexSpill{f: f, w: bufio.NewWriter(f), byHash: map[uint64][]int64{}}, nil
+}
+
+func nameHash(name string) uint64 {
+	h := fnv.New64a()
+	_, _ = h.Write([]byte(name))
+	return h.Sum64()
+}
+
+// add writes the entry and gives its position
+func (s *indexSpill) add(e *archiveEntry) (int64, error) {
+	var b [indexRecordSize]byte
+	binary.LittleEndian.PutUint32(b[0:], uint32(len(e.name)))
+	binary.LittleEndian.PutUint64(b[4:], uint64(e.offset))
+	binary.LittleEndian.PutUint64(b[12:], uint64(e.size))
+	binary.LittleEndian.PutUint64(b[20:], uint64(e.csize))
+	binary.LittleEndian.PutUint16(b[28:], e.method)
+	binary.LittleEndian.PutUint32(b[30:], uint32(e.mode))
+	if !e.modTime.IsZero() {
+		binary.LittleEndian.PutUint64(b[34:], uint64(e.modTime.UnixNano()))
+	}
+	if _, err := s.w.Write(b[:]); err != nil {
+		return 0, err
+	}
+	if _, err := s.w.WriteString(e.name); err != nil {
+		return 0, err
+	}
+	pos := s.size
+	s.size += int64(indexRecordSize + len(e.name))
+	s.count++
+	h := nameHash(e.name)
+	s.byHash[h] = append(s.byHash[h], pos)
+	return pos, nil
+}
+
+// read gives the entry written at the position
+func (s *indexSpill) read(pos int64) (*archiveEntry, error) {
+	if s.w.Buffered() > 0 {
+		// the entries are read while indexing, to resolve the links
+		if err := s.w.Flush(); err != nil {
+			return nil, err
+		}
+	}
+	var b [indexRecordSize]byte
+	if _, err := s.f.ReadAt(b[:], pos); err != nil {
+		return nil, err
+	}
+	name := make([]byte, binary.LittleEndian.Uint32(b[0:]))
+	if _, err := s.f.ReadAt(name, pos+indexRecordSize); err != nil {
+		return nil, err
+	}
+	e := &archiveEntry{
+		name:   string(name),
+		offset: int64(binary.LittleEndian.Uint64(b[4:])),
+		size:   int64(binary.LittleEndian.Uint64(b[12:])),
+		csize:  int64(binary.LittleEndian.Uint64(b[20:])),
+		method: binary.LittleEndian.Uint16(b[28:]),
+		mode:   fs.FileMode(binary.LittleEndian.Uint32(b[30:])),
+	}
+	if t := int64(binary.LittleEndian.Uint64(b[34:])); t != 0 {
+		e.modTime = time.Unix(0, t)
+	}
+	return e, nil
+}
+
+// find gives the last entry with the name, nil when none
+func (s *indexSpill) find(name string) (*archiveEntry, error) {
+	l := s.byHash[nameHash(name)]
+	for i := len(l) - 1; i >= 0; i-- {
+		e, err := s.read(l[i])
+		if err != nil {
+			return nil, err
+		}
+		if e.name == name {
+			return e, nil
+		}
+	}
+	return nil, nil
+}
+
+func (s *indexSpill) close() error {
+	n := s.f.Name()
+	return errors.Join(s.f.Close(), os.Remove(n))
+}
@@ -0,0 +1,8 @@
+package fshelper
+
+// FileID identifies a file on the disk, whatever its path.
+// Two paths with the same FileID are hard links or bind mounts of the same file.
+type FileID struct {
+	Dev uint64
+	Ino uint64
+}
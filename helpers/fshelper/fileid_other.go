@@ -0,0 +1,10 @@
+//go:build !unix
+
+package fshelper
+
+import "io/fs"
+
+// FileIDOf can't identify the files on this OS
+func FileIDOf(info fs.FileInfo) (FileID, bool) {
+	return FileID{}, false
+}
@@ -0,0 +1,18 @@
+//go:build unix
+
+package fshelper
+
+import (
+	"io/fs"
+	"syscall"
+)
+
+// FileIDOf gives the device and the inode of the file
+func FileIDOf(info fs.FileInfo) (FileID, bool) {
+	st, ok := info.Sys().(*syscall.Stat_t)
+	if !ok || st == nil {
+		return FileID{}, false
+	}
+	// the types of the fields depend on the OS
+	return FileID{Dev: uint64(st.Dev), Ino: uint64(st.Ino)}, true
+}
@@ -17,9 +17,17 @@ import (
 //
 
 type GlobWalkFS struct {
-	rootFS fs.FS
-	dir    string
-	parts  []string
+	rootFS         fs.FS
+	dir            string
+	parts          []string
+	followSymlinks bool // the symbolic links to folders are walked
+}
+
+// SetFollowSymlinks makes ReadDir give the symbolic links to folders as folders, to be walked.
+// A link to one of the folders being walked is ignored, it would loop.
+func (gw *GlobWalkFS) SetFollowSymlinks(follow bool) *GlobWalkFS {
+	gw.followSymlinks = follow
+	return gw
 }
 
 func NewGlobWalkFS(pattern string) (fs.FS, error) {
@@ -115,6 +123,13 @@ func (gw GlobWalkFS) ReadDir(name string) ([]fs.DirEntry, error) {
 	returned := []fs.DirEntry{}
 	for _, e := range entries {
 		p := path.Join(name, e.Name())
+		if gw.followSymlinks && e.Type()&fs.ModeSymlink != 0 {
+			var keep bool
+			e, keep = gw.followSymlink(p, e)
+			if !keep {
+				continue
+			}
+		}
 
 		// Always matches .XMP files...
 		if !e.IsDir() {
@@ -132,6 +147,38 @@ func (gw GlobWalkFS) ReadDir(name string) ([]fs.DirEntry, error) {
 	return returned, nil
 }
 
+// followSymlink gives the entry of the link's target when it's a folder.
+// The entry is dropped when the target is the folder of the link or one of its parents: walking it would loop.
+func (gw GlobWalkFS) followSymlink(name string, e fs.DirEntry) (fs.DirEntry, bool) {
+	target, err := gw.realPath(name)
+	if err != nil {
+		return e, true // broken link
+	}
+	// Stat follows the link, the info keeps the link's name
+	info, err := os.Stat(filepath.Join(gw.dir, filepath.FromSlash(name)))
+	if err != nil || !info.IsDir() {
+		return e, true
+	}
+	for dir := path.Dir(name); ; dir = path.Dir(dir) {
+		if p, err := gw.realPath(dir); err == nil && p == target {
+			return nil, false
+		}
+		if dir == "." {
+			break
+		}
+	}
+	return fs.FileInfoToDirEntry(info), true
+}
+
+// realPath gives the absolute path of the name without symbolic links
+func (gw GlobWalkFS) realPath(name string) (string, error) {
+	p, err := filepath.Abs(filepath.Join(gw.dir, filepath.FromSlash(name)))
+	if err != nil {
+		return "", err
+	}
+	return filepath.EvalSymlinks(p)
+}
+
 // FSName gives the folder name when argument was .
 func (gw GlobWalkFS) Name() string {
 	if fsys, ok := gw.rootFS.(NameFS); ok {
@@ -140,6 +187,18 @@ func (gw GlobWalkFS) Name() string {
 	return filepath.Base(gw.dir)
 }
 
+// Root gives the absolute path of the folder, followed by the pattern when any
+func (gw GlobWalkFS) Root() string {
+	dir, err := filepath.Abs(gw.dir)
+	if err != nil {
+		dir = gw.dir
+	}
+	if len(gw.parts) > 0 {
+		return filepath.ToSlash(dir) + "/" + strings.Join(gw.parts, "/")
+	}
+	return filepath.ToSlash(dir)
+}
+
 // FixedPathAndMagic split the path with the fixed part and the variable part
 func FixedPathAndMagic(name string) (string, string) {
 	if !HasMagic(name) {
@@ -204,3 +263,8 @@ func (f FSWithName) ReadFile(name string) ([]byte, error) {
 type NameFS interface {
 	Name() string
 }
+
+// RootFS is implemented by file systems reading a folder of the disk
+type RootFS interface {
+	Root() string
+}
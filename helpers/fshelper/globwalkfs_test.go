@@ -1,8 +1,11 @@
 package fshelper
 
 import (
+	"fmt"
 	"io/fs"
+	"os"
 	"path"
+	"path/filepath"
 	"reflect"
 	"testing"
 )
@@ -139,3 +142,56 @@ func TestFixedPathAndMagic(t *testing.T) {
 		})
 	}
 }
+
+func TestGlobWalkFSFollowSymlinks(t *testing.T) {
+	dir := t.TempDir()
+	for _, f := range []string{"A/1.jpg", "B/2.jpg"} {
+		if err := os.MkdirAll(filepath.Join(dir, filepath.Dir(f)), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(filepath.Join(dir, f), []byte("jpg"), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// A/B is a link to the folder B, A/loop is a link to the parent of A
+	if err := os.Symlink(filepath.Join(dir, "B"), filepath.Join(dir, "A", "B")); err != nil {
+		t.Skip("symbolic links not supported:", err)
+	}
+	if err := os.Symlink(dir, filepath.Join(dir, "A", "loop")); err != nil {
+		t.Fatal(err)
+	}
+
+	tc := []struct {
+		follow   bool
+		expected []string
+	}{
+		{follow: false, expected: []string{"A/1.jpg", "A/B", "A/loop", "B/2.jpg"}},
+		{follow: true, expected: []string{"A/1.jpg", "A/B/2.jpg", "B/2.jpg"}},
+	}
+	for _, c := range tc {
+		t.Run(fmt.Sprint("follow=", c.follow), func(t *testing.T) {
+			fsys, err := NewGlobWalkFS(dir)
+			if err != nil {
+				t.Fatal(err)
+			}
+			fsys.(*GlobWalkFS).SetFollowSymlinks(c.follow)
+
+			files := []string{}
+			err = fs.WalkDir(fsys, ".", func(p string, d fs.DirEntry, err error) error {
+				if err != nil {
+					return err
+				}
+				if !d.IsDir() {
+					files = append(files, p)
+				}
+				return nil
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(c.expected, files) {
+				t.Errorf("expected %v, got %v", c.expected, files)
+			}
+		})
+	}
+}
@@ -3,7 +3,6 @@ package fshelper
 import (
 	"archive/zip"
 	"errors"
-	"fmt"
 	"io/fs"
 	"path/filepath"
 	"strings"
@@ -11,10 +10,8 @@ import (
 
 // ParsePath return a list of FS bases on args
 //
-// Zip files are opened and returned as FS
+// Zip and tar files are opened and returned as FS, the damaged zip files are recovered
 // Manage wildcards in path
-//
-// TODO: Implement a tgz reader for non google-photos archives
 
 func ParsePath(args []string) ([]fs.FS, error) {
 	var errs error
@@ -30,12 +27,17 @@ func ParsePath(args []string) ([]fs.FS, error) {
 		for _, f := range files {
 			lowF := strings.ToLower(f)
 			switch {
-			case strings.HasSuffix(lowF, ".tgz") || strings.HasSuffix(lowF, ".tar.gz"):
-				errs = errors.Join(fmt.Errorf("immich-go cant use tgz archives: %s", filepath.Base(a)))
+			case IsTarArchive(lowF):
+				fsys, err := OpenTar(f)
+				if err != nil {
+					errs = errors.Join(errs, err)
+					continue
+				}
+				fsyss = append(fsyss, fsys)
 			case strings.HasSuffix(lowF, ".zip"):
-				fsys, err := zip.OpenReader(f)
+				fsys, err := OpenZip(f)
 				if err != nil {
-					errs = errors.Join(errs, fmt.Errorf("%s: %w", a, err))
+					errs = errors.Join(errs, err)
 					continue
 				}
 				fsyss = append(fsyss, fsys)
@@ -55,6 +57,32 @@ func ParsePath(args []string) ([]fs.FS, error) {
 	return fsyss, nil
 }
 
+// ArchiveFS is implemented by file systems opened from an archive file
+type ArchiveFS interface {
+	ArchiveName() string
+}
+
+// zipFS remembers the name of the zip file
+type zipFS struct {
+	*zip.ReadCloser
+	name string
+}
+
+func (z *zipFS) ArchiveName() string {
+	return z.name
+}
+
+// SourceName gives the name of the archive or the folder of a file system
+func SourceName(fsys fs.FS) string {
+	switch fsys := fsys.(type) {
+	case ArchiveFS:
+		return fsys.ArchiveName()
+	case NameFS:
+		return fsys.Name()
+	}
+	return ""
+}
+
 func expandNames(name string) ([]string, error) {
 	if HasMagic(name) {
 		return filepath.Glob(name)
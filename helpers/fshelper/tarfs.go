@@ -0,0 +1,271 @@
+package fshelper
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+)
+
+/*
+	TarFS serves the files of a tar archive, compressed or not.
+
+	The archive is indexed in one pass, the index is written in a temporary file when the archive has many files.
+	The files of a tar archive are then read at their offset.
+
+	A compressed archive can't be read at a given offset: it's decompressed again from its beginning
+	up to the file. The streams are kept after the files are closed, to read the next files without
+	starting again. The files are read the fastest in the order of the archive.
+*/
+
+// TempFilePattern names the temporary files of immich-go
+const TempFilePattern = "immich-go_*.tmp"
+
+// maxParkedStreams is the number of decompression streams kept for the next files
+const maxParkedStreams = 4
+
+type TarFS struct {
+	archiveIndex
+	name       string   // archive's name
+	path       string   // archive's path, to decompress it again
+	file       *os.File // the archive
+	compressed bool
+
+	mu      sync.Mutex
+	streams []*tarStream // idle decompression streams
+	closed  bool
+}
+
+// IsTarArchive tells if the name is one of a tar archive
+func IsTarArchive(name string) bool {
+	name = strings.ToLower(name)
+	return strings.HasSuffix(name, ".tar") || strings.HasSuffix(name, ".tgz") || strings.HasSuffix(name, ".tar.gz")
+}
+
+// OpenTar indexes the tar archive, it's decompressed when its name ends with .tgz or .tar.gz
+func OpenTar(name string) (*TarFS, error) {
+	f, err := os.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	low := strings.ToLower(name)
+	t := &TarFS{
+		archiveIndex: newArchiveIndex(),
+		name:         filepath.Base(name),
+		path:         name,
+		file:         f,
+		compressed:   strings.HasSuffix(low, ".tgz") || strings.HasSuffix(low, ".gz"),
+	}
+	err = t.index()
+	if err != nil {
+		_ = t.Close()
+		return nil, fmt.Errorf("%s: %w", name, err)
+	}
+	return t, nil
+}
+
+// index reads the headers of the archive
+func (t *TarFS) index() error {
+	var r io.Reader = t.file
+	if t.compressed {
+		gz, err := gzip.NewReader(t.file)
+		if err != nil {
+			return err
+		}
+		defer gz.Close()
+		r = gz
+	}
+	cr := &countingReader{r: r}
+	tr := tar.NewReader(cr)
+
+	links := map[string]string{} // hard links to their target
+	for {
+		h, err := tr.Next()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return err
+		}
+		name, ok := cleanArchiveName(h.Name)
+		if !ok {
+			continue
+		}
+		switch h.Typeflag {
+		case tar.TypeReg:
+			err = t.addEntry(&archiveEntry{name: name, offset: cr.n, size: h.Size, mode: h.FileInfo().Mode().Perm(), modTime: h.ModTime})
+		case tar.TypeDir:
+			err = t.addEntry(&archiveEntry{name: name, mode: fs.ModeDir | h.FileInfo().Mode().Perm(), modTime: h.ModTime})
+		case tar.TypeLink:
+			if target, ok := cleanArchiveName(h.Linkname); ok {
+				links[name] = target
+			}
+		}
+		if err != nil {
+			return err
+		}
+	}
+	for name, target := range links {
+		e, err := t.lookup("link", target)
+		if err != nil || e.mode.IsDir() {
+			continue
+		}
+		l := *e
+		l.name = name
+		l.files, l.spilled = nil, nil
+		if err = t.addEntry(&l); err != nil {
+			return err
+		}
+	}
+	return t.finish()
+}
+
+func (t *TarFS) Open(name string) (fs.File, error) {
+	e, err := t.lookup("open", name)
+	if err != nil {
+		return nil, err
+	}
+	if e.mode.IsDir() {
+		return &archiveDir{idx: &t.archiveIndex, e: e}, nil
+	}
+	if t.compressed {
+		return &tarStreamFile{t: t, e: e}, nil
+	}
+	return &sectionFile{SectionReader: io.NewSectionReader(t.file, e.offset, e.size), e: e}, nil
+}
+
+// ArchiveName gives the name of the archive file
+func (t *TarFS) ArchiveName() string {
+	return t.name
+}
+
+// Close closes the archive, its streams and removes the temporary index
+func (t *TarFS) Close() error {
+	t.mu.Lock()
+	streams := t.streams
+	t.streams, t.closed = nil, true
+	t.mu.Unlock()
+
+	err := t.closeIndex()
+	for _, s := range streams {
+		err = errors.Join(err, s.close())
+	}
+	if t.file != nil {
+		err = errors.Join(err, t.file.Close())
+		t.file = nil
+	}
+	return err
+}
+
+// tarStream decompresses the archive from its beginning
+type tarStream struct {
+	f   *os.File
+	gz  *gzip.Reader
+	pos int64 // position in the uncompressed archive
+}
+
+func (s *tarStream) close() error {
+	return errors.Join(s.gz.Close(), s.f.Close())
+}
+
+// stream gives a stream positioned at the offset, the idle stream the closest before the offset is reused
+func (t *TarFS) stream(offset int64) (*tarStream, error) {
+	var s *tarStream
+	t.mu.Lock()
+	best := -1
+	for i, p := range t.streams {
+		if p.pos <= offset && (best < 0 || p.pos > t.streams[best].pos) {
+			best = i
+		}
+	}
+	if best >= 0 {
+		s = t.streams[best]
+		t.streams = append(t.streams[:best], t.streams[best+1:]...)
+	}
+	t.mu.Unlock()
+
+	if s == nil {
+		f, err := os.Open(t.path)
+		if err != nil {
+			return nil, err
+		}
+		gz, err := gzip.NewReader(f)
+		if err != nil {
+			_ = f.Close()
+			return nil, err
+		}
+		s = &tarStream{f: f, gz: gz}
+	}
+	n, err := io.CopyN(io.Discard, s.gz, offset-s.pos)
+	s.pos += n
+	if err != nil {
+		_ = s.close()
+		return nil, err
+	}
+	return s, nil
+}
+
+// park keeps the stream for the next files
+func (t *TarFS) park(s *tarStream) error {
+	t.mu.Lock()
+	if !t.closed && len(t.streams) < maxParkedStreams {
+		t.streams = append(t.streams, s)
+		s = nil
+	}
+	t.mu.Unlock()
+	if s != nil {
+		return s.close()
+	}
+	return nil
+}
+
+// tarStreamFile is a file of a compressed archive, its stream is opened on the first read
+type tarStreamFile struct {
+	t    *TarFS
+	e    *archiveEntry
+	s    *tarStream
+	read int64
+}
+
+func (f *tarStreamFile) Stat() (fs.FileInfo, error) { return f.e, nil }
+
+func (f *tarStreamFile) Read(b []byte) (int, error) {
+	if f.read >= f.e.size {
+		return 0, io.EOF
+	}
+	if f.s == nil {
+		s, err := f.t.stream(f.e.offset + f.read)
+		if err != nil {
+			return 0, err
+		}
+		f.s = s
+	}
+	b = b[:min(int64(len(b)), f.e.size-f.read)]
+	n, err := f.s.gz.Read(b)
+	f.s.pos += int64(n)
+	f.read += int64(n)
+	if err != nil {
+		// the stream can't be used for the next files
+		_ = f.s.close()
+		f.s = nil
+		if errors.Is(err, io.EOF) && f.read < f.e.size {
+			err = io.ErrUnexpectedEOF
+		}
+	}
+	return n, err
+}
+
+func (f *tarStreamFile) Close() error {
+	if f.s == nil {
+		return nil
+	}
+	s := f.s
+	f.s = nil
+	return f.t.park(s)
+}
@@ -0,0 +1,181 @@
+package fshelper
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"testing/fstest"
+	"time"
+)
+
+type tarItem struct {
+	name     string
+	content  string
+	typeflag byte
+	link     string
+}
+
+// writeTar writes the archive, compressed when the name ends with .tgz
+func writeTar(t *testing.T, name string, items []tarItem) {
+	f, err := os.Create(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	var w io.Writer = f
+	if strings.HasSuffix(name, ".tgz") {
+		gz := gzip.NewWriter(f)
+		defer gz.Close()
+		w = gz
+	}
+	tw := tar.NewWriter(w)
+	defer tw.Close()
+	date := time.Date(2023, 8, 1, 12, 0, 0, 0, time.UTC)
+	for _, it := range items {
+		h := &tar.Header{Name: it.name, Typeflag: it.typeflag, Linkname: it.link, Mode: 0o644, ModTime: date}
+		if it.typeflag == tar.TypeReg {
+			h.Size = int64(len(it.content))
+		}
+		if it.typeflag == tar.TypeDir {
+			h.Mode = 0o755
+		}
+		if err := tw.WriteHeader(h); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := tw.Write([]byte(it.content)); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestTarFS(t *testing.T) {
+	items := []tarItem{
+		{name: "Takeout/", typeflag: tar.TypeDir},
+		{name: "Takeout/Google Photos/Photos from 2023/IMG_0001.jpg", content: "first photo", typeflag: tar.TypeReg},
+		{name: "Takeout/Google Photos/Photos from 2023/IMG_0001.jpg.json", content: `{"title":"IMG_0001.jpg"}`, typeflag: tar.TypeReg},
+		{name: "./Takeout/Google Photos/Album/IMG_0001.jpg", typeflag: tar.TypeLink, link: "Takeout/Google Photos/Photos from 2023/IMG_0001.jpg"},
+		{name: "Takeout/Google Photos/Album/IMG_0002.jpg", content: strings.Repeat("second photo ", 1000), typeflag: tar.TypeReg},
+		{name: "Takeout/archive_browser.html", content: "<html></html>", typeflag: tar.TypeReg},
+	}
+	tc := []struct {
+		name  string
+		limit int
+		spill bool
+	}{
+		{name: "takeout.tar", limit: ArchiveIndexMemoryLimit},
+		{name: "takeout.tgz", limit: ArchiveIndexMemoryLimit},
+		{name: "takeout-001.tgz", limit: 1, spill: true},
+		{name: "takeout-001.tar", limit: 1, spill: true},
+	}
+	for _, c := range tc {
+		t.Run(c.name, func(t *testing.T) {
+			defer func(limit int) { ArchiveIndexMemoryLimit = limit }(ArchiveIndexMemoryLimit)
+			ArchiveIndexMemoryLimit = c.limit
+
+			name := filepath.Join(t.TempDir(), c.name)
+			writeTar(t, name, items)
+			fsys, err := OpenTar(name)
+			if err != nil {
+				t.Fatal(err)
+			}
+			err = fstest.TestFS(fsys,
+				"Takeout/Google Photos/Photos from 2023/IMG_0001.jpg",
+				"Takeout/Google Photos/Photos from 2023/IMG_0001.jpg.json",
+				"Takeout/Google Photos/Album/IMG_0001.jpg",
+				"Takeout/Google Photos/Album/IMG_0002.jpg",
+				"Takeout/archive_browser.html")
+			if err != nil {
+				t.Error(err)
+			}
+			b, err := fs.ReadFile(fsys, "Takeout/Google Photos/Album/IMG_0001.jpg")
+			if err != nil || string(b) != "first photo" {
+				t.Errorf("expecting the content of the linked file, got %q, %v", b, err)
+			}
+			if (fsys.spill != nil) != c.spill {
+				t.Errorf("unexpected temporary index %v", fsys.spill)
+			}
+			var spill string
+			if fsys.spill != nil {
+				spill = fsys.spill.f.Name()
+			}
+			if err = fsys.Close(); err != nil {
+				t.Error(err)
+			}
+			if spill != "" {
+				if _, err := os.Stat(spill); !os.IsNotExist(err) {
+					t.Errorf("the temporary index %s is left", spill)
+				}
+			}
+		})
+	}
+}
+
+func TestParsePathTar(t *testing.T) {
+	dir := t.TempDir()
+	for _, name := range []string{"takeout-001.tgz", "takeout-002.tgz"} {
+		writeTar(t, filepath.Join(dir, name), []tarItem{{name: "Takeout/Google Photos/" + name + ".jpg", content: name, typeflag: tar.TypeReg}})
+	}
+	fsyss, err := ParsePath([]string{filepath.Join(dir, "takeout-*.tgz")})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = CloseFSs(fsyss) }()
+	if len(fsyss) != 2 {
+		t.Fatalf("expecting 2 file systems, got %d", len(fsyss))
+	}
+	for i, fsys := range fsyss {
+		if SourceName(fsys) != []string{"takeout-001.tgz", "takeout-002.tgz"}[i] {
+			t.Errorf("unexpected source name %q", SourceName(fsys))
+		}
+	}
+}
+
+func TestTarStreams(t *testing.T) {
+	items := []tarItem{}
+	for i := range 10 {
+		items = append(items, tarItem{name: fmt.Sprintf("photos/IMG_%04d.jpg", i), content: strings.Repeat(fmt.Sprintf("photo %d ", i), 1000), typeflag: tar.TypeReg})
+	}
+	name := filepath.Join(t.TempDir(), "photos.tgz")
+	writeTar(t, name, items)
+	fsys, err := OpenTar(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer fsys.Close()
+
+	// the files are read backward, then several at once
+	for i := len(items) - 1; i >= 0; i-- {
+		b, err := fs.ReadFile(fsys, items[i].name)
+		if err != nil || string(b) != items[i].content {
+			t.Fatalf("unexpected content of %s: %v", items[i].name, err)
+		}
+	}
+	files := []fs.File{}
+	for _, it := range items {
+		f, err := fsys.Open(it.name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		files = append(files, f)
+	}
+	for i, f := range files {
+		b := make([]byte, 10)
+		if _, err = io.ReadFull(f, b); err != nil || string(b) != items[i].content[:10] {
+			t.Errorf("unexpected start of %s: %q, %v", items[i].name, b, err)
+		}
+	}
+	for _, f := range files {
+		if err = f.Close(); err != nil {
+			t.Error(err)
+		}
+	}
+	if len(fsys.streams) > maxParkedStreams {
+		t.Errorf("expecting at most %d idle streams, got %d", maxParkedStreams, len(fsys.streams))
+	}
+}
@@ -0,0 +1,452 @@
+package fshelper
+
+import (
+	"archive/zip"
+	"bufio"
+	"bytes"
+	"compress/flate"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+/*
+	RecoveredZipFS serves the complete files of a damaged zip archive.
+
+	A truncated download loses the central directory at the end of the zip file, and zip.OpenReader rejects it.
+	The local headers preceding the data of each file are scanned in sequence instead. Each file is decompressed
+	and its checksum verified: the complete files are served, the others are reported as lost.
+*/
+
+const (
+	zipLocalHeaderSig   = 0x04034b50
+	zipCentralHeaderSig = 0x02014b50
+	zipEndSig           = 0x06054b50
+	zipDescriptorSig    = 0x08074b50
+	zipLocalHeaderLen   = 30
+	zipFlagEncrypted    = 0x1
+	zipFlagDescriptor   = 0x8
+)
+
+// LostEntry is a file of a damaged archive that can't be read
+type LostEntry struct {
+	Name   string
+	Reason string
+}
+
+// DamagedFS is implemented by the file systems recovered from a damaged archive
+type DamagedFS interface {
+	Lost() []LostEntry
+}
+
+type RecoveredZipFS struct {
+	archiveIndex
+	name string   // archive's name
+	file *os.File // the archive
+	size int64    // size of the archive file
+	lost []LostEntry
+}
+
+// OpenZip opens the zip archive, the files of a damaged archive are recovered
+func OpenZip(name string) (fs.FS, error) {
+	z, err := zip.OpenReader(name)
+	if err == nil {
+		return &zipFS{ReadCloser: z, name: filepath.Base(name)}, nil
+	}
+	if !errors.Is(err, zip.ErrFormat) {
+		return nil, fmt.Errorf("%s: %w", name, err)
+	}
+	r, rErr := RecoverZip(name)
+	if rErr != nil {
+		return nil, fmt.Errorf("%s: %w", name, errors.Join(err, rErr))
+	}
+	return r, nil
+}
+
+// RecoverZip indexes the files of the zip archive by reading their local headers
+func RecoverZip(name string) (*RecoveredZipFS, error) {
+	f, err := os.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	s, err := f.Stat()
+	if err != nil {
+		_ = f.Close()
+		return nil, err
+	}
+	z := &RecoveredZipFS{
+		archiveIndex: newArchiveIndex(),
+		name:         filepath.Base(name),
+		file:         f,
+		size:         s.Size(),
+	}
+	err = z.scan()
+	if err != nil {
+		_ = z.Close()
+		return nil, err
+	}
+	if z.len() == 1 && len(z.lost) == 0 {
+		_ = z.Close()
+		return nil, errors.New("no file found in the archive")
+	}
+	err = z.finish()
+	if err != nil {
+		_ = z.Close()
+		return nil, err
+	}
+	return z, nil
+}
+
+// scan reads the local headers one after the other
+func (z *RecoveredZipFS) scan() error {
+	off := int64(0)
+	for off < z.size {
+		var sig [4]byte
+		n, err := z.file.ReadAt(sig[:], off)
+		if n < len(sig) {
+			if err != nil && !errors.Is(err, io.EOF) {
+				return err
+			}
+			z.addLost(fmt.Sprintf("entry at offset %d", off), "truncated header")
+			return nil
+		}
+		switch binary.LittleEndian.Uint32(sig[:]) {
+		case zipLocalHeaderSig:
+		case zipCentralHeaderSig, zipEndSig:
+			return nil // the end of the archive is reached
+		default:
+			next, ok, err := z.nextSignature(off+1, zipLocalHeaderSig)
+			if err != nil || !ok {
+				return err
+			}
+			off = next
+			continue
+		}
+		next, err := z.readEntry(off)
+		if err != nil {
+			return err
+		}
+		if next < 0 {
+			return nil
+		}
+		off = next
+	}
+	return nil
+}
+
+// readEntry checks the entry at the given offset, and gives the offset of the next one.
+// It returns -1 when the rest of the archive can't be read.
+func (z *RecoveredZipFS) readEntry(off int64) (int64, error) {
+	var h [zipLocalHeaderLen]byte
+	if n, err := z.file.ReadAt(h[:], off); n < len(h) {
+		if err != nil && !errors.Is(err, io.EOF) {
+			return 0, err
+		}
+		z.addLost(fmt.Sprintf("entry at offset %d", off), "truncated header")
+		return -1, nil
+	}
+	flags := binary.LittleEndian.Uint16(h[6:])
+	method := binary.LittleEndian.Uint16(h[8:])
+	modTime := msDosTime(binary.LittleEndian.Uint16(h[12:]), binary.LittleEndian.Uint16(h[10:]))
+	crc := binary.LittleEndian.Uint32(h[14:])
+	csize := int64(binary.LittleEndian.Uint32(h[18:]))
+	size := int64(binary.LittleEndian.Uint32(h[22:]))
+	nameLen := int(binary.LittleEndian.Uint16(h[26:]))
+	extraLen := int(binary.LittleEndian.Uint16(h[28:]))
+
+	b := make([]byte, nameLen+extraLen)
+	if n, err := z.file.ReadAt(b, off+zipLocalHeaderLen); n < len(b) {
+		if err != nil && !errors.Is(err, io.EOF) {
+			return 0, err
+		}
+		z.addLost(fmt.Sprintf("entry at offset %d", off), "truncated header")
+		return -1, nil
+	}
+	fullName := string(b[:nameLen])
+	zip64 := false
+	for extra := b[nameLen:]; len(extra) >= 4; {
+		id := binary.LittleEndian.Uint16(extra)
+		l := int(binary.LittleEndian.Uint16(extra[2:]))
+		extra = extra[4:]
+		if l > len(extra) {
+			break
+		}
+		if id == 0x0001 {
+			zip64 = true
+			field := extra[:l]
+			if size == 0xffffffff && len(field) >= 8 {
+				size = int64(binary.LittleEndian.Uint64(field))
+				field = field[8:]
+			}
+			if csize == 0xffffffff && len(field) >= 8 {
+				csize = int64(binary.LittleEndian.Uint64(field))
+			}
+		}
+		extra = extra[l:]
+	}
+	start := off + zipLocalHeaderLen + int64(len(b))
+	withDescriptor := flags&zipFlagDescriptor != 0
+
+	// next gives the offset of the following entry when the data can't be read
+	next := func() (int64, error) {
+		if !withDescriptor && start+csize <= z.size {
+			return start + csize, nil
+		}
+		o, ok, err := z.nextSignature(start, zipLocalHeaderSig)
+		if err != nil || !ok {
+			return -1, err
+		}
+		return o, nil
+	}
+
+	name, ok := cleanArchiveName(fullName)
+	if !ok {
+		return next()
+	}
+	if strings.HasSuffix(fullName, "/") {
+		if err := z.addEntry(&archiveEntry{name: name, mode: fs.ModeDir | 0o755, modTime: modTime}); err != nil {
+			return 0, err
+		}
+		return next()
+	}
+	switch {
+	case flags&zipFlagEncrypted != 0:
+		z.addLost(name, "encrypted file")
+		return next()
+	case method != zip.Store && method != zip.Deflate:
+		z.addLost(name, fmt.Sprintf("unsupported compression method %d", method))
+		return next()
+	case method == zip.Store && withDescriptor:
+		l, ok, err := z.storedSize(start)
+		if err != nil {
+			return 0, err
+		}
+		if !ok {
+			z.addLost(name, "truncated file")
+			return -1, nil
+		}
+		csize = l
+	}
+
+	// decompress the data to check them, the compressed size is given by the deflate stream
+	cr := &countingByteReader{r: bufio.NewReader(io.NewSectionReader(z.file, start, z.size-start))}
+	var r io.Reader
+	if method == zip.Store {
+		r = io.LimitReader(cr, csize)
+	} else {
+		fr := flate.NewReader(cr)
+		defer fr.Close()
+		r = fr
+	}
+	hash := crc32.NewIEEE()
+	n, err := io.Copy(hash, r)
+	switch {
+	case errors.Is(err, io.ErrUnexpectedEOF) || (err == nil && method == zip.Store && n < csize):
+		z.addLost(name, "truncated file")
+		return -1, nil
+	case err != nil:
+		z.addLost(name, "corrupted data: "+err.Error())
+		return next()
+	}
+	end := start + csize
+	if withDescriptor {
+		csize = cr.n
+		d, err := z.readDescriptor(start+csize, zip64)
+		if err != nil {
+			return 0, err
+		}
+		if d == nil {
+			z.addLost(name, "truncated file")
+			return -1, nil
+		}
+		crc, size = d.crc, n
+		end = start + csize + d.len
+	} else if method == zip.Deflate && cr.n != csize {
+		z.addLost(name, "corrupted data: unexpected compressed size")
+		return end, nil
+	}
+	if hash.Sum32() != crc || n != size {
+		z.addLost(name, "checksum error")
+		return end, nil
+	}
+	if err := z.addEntry(&archiveEntry{name: name, offset: start, size: n, csize: csize, method: method, mode: 0o644, modTime: modTime}); err != nil {
+		return 0, err
+	}
+	return end, nil
+}
+
+type zipDescriptor struct {
+	crc uint32
+	len int64 // length of the descriptor in the archive
+}
+
+// readDescriptor reads the data descriptor following the data, nil when it's truncated.
+// The zip64 descriptors have 8 bytes sizes, they are recognized by the signature that follows them.
+func (z *RecoveredZipFS) readDescriptor(off int64, zip64 bool) (*zipDescriptor, error) {
+	b := make([]byte, 4+20+4)
+	n, err := z.file.ReadAt(b, off)
+	if err != nil && !errors.Is(err, io.EOF) {
+		return nil, err
+	}
+	b = b[:n]
+	skip := 0
+	if len(b) >= 4 && binary.LittleEndian.Uint32(b) == zipDescriptorSig {
+		skip = 4
+	}
+	lengths := []int{12, 20}
+	if zip64 {
+		lengths = []int{20, 12}
+	}
+	var d *zipDescriptor
+	for _, l := range lengths {
+		end := skip + l
+		if end > len(b) {
+			continue
+		}
+		if d == nil {
+			d = &zipDescriptor{crc: binary.LittleEndian.Uint32(b[skip:]), len: int64(end)}
+		}
+		if off+int64(end) == z.size || len(b) >= end+4 && isZipSignature(b[end:]) {
+			d.len = int64(end)
+			return d, nil
+		}
+	}
+	return d, nil
+}
+
+func isZipSignature(b []byte) bool {
+	switch binary.LittleEndian.Uint32(b) {
+	case zipLocalHeaderSig, zipCentralHeaderSig, zipEndSig:
+		return true
+	}
+	return false
+}
+
+// storedSize searches the data descriptor of a file stored without compression to get its size
+func (z *RecoveredZipFS) storedSize(start int64) (int64, bool, error) {
+	for off := start; ; off++ {
+		p, ok, err := z.nextSignature(off, zipDescriptorSig)
+		if err != nil || !ok {
+			return 0, false, err
+		}
+		var b [20]byte
+		n, err := z.file.ReadAt(b[:], p+4)
+		if err != nil && !errors.Is(err, io.EOF) {
+			return 0, false, err
+		}
+		l := p - start
+		if n >= 8 && int64(binary.LittleEndian.Uint32(b[4:])) == l&0xffffffff ||
+			n >= 12 && int64(binary.LittleEndian.Uint64(b[4:])) == l {
+			return l, true, nil
+		}
+		off = p
+	}
+}
+
+// nextSignature searches the signature from the given offset
+func (z *RecoveredZipFS) nextSignature(off int64, signature uint32) (int64, bool, error) {
+	sig := binary.LittleEndian.AppendUint32(nil, signature)
+	buf := make([]byte, 64*1024)
+	for off < z.size {
+		n, err := z.file.ReadAt(buf, off)
+		if err != nil && !errors.Is(err, io.EOF) {
+			return 0, false, err
+		}
+		if i := bytes.Index(buf[:n], sig); i >= 0 {
+			return off + int64(i), true, nil
+		}
+		if n < len(sig) {
+			break
+		}
+		off += int64(n - len(sig) + 1)
+	}
+	return 0, false, nil
+}
+
+func (z *RecoveredZipFS) addLost(name, reason string) {
+	z.lost = append(z.lost, LostEntry{Name: name, Reason: reason})
+}
+
+// Lost gives the files that can't be recovered
+func (z *RecoveredZipFS) Lost() []LostEntry {
+	return z.lost
+}
+
+func (z *RecoveredZipFS) Open(name string) (fs.File, error) {
+	e, err := z.lookup("open", name)
+	if err != nil {
+		return nil, err
+	}
+	if e.mode.IsDir() {
+		return &archiveDir{idx: &z.archiveIndex, e: e}, nil
+	}
+	data := io.NewSectionReader(z.file, e.offset, e.csize)
+	if e.method == zip.Store {
+		return &sectionFile{SectionReader: data, e: e}, nil
+	}
+	return &deflateFile{ReadCloser: flate.NewReader(data), e: e}, nil
+}
+
+// ArchiveName gives the name of the archive file
+func (z *RecoveredZipFS) ArchiveName() string {
+	return z.name
+}
+
+// Close closes the archive and removes the temporary index
+func (z *RecoveredZipFS) Close() error {
+	err := z.closeIndex()
+	if z.file == nil {
+		return err
+	}
+	err = errors.Join(err, z.file.Close())
+	z.file = nil
+	return err
+}
+
+type deflateFile struct {
+	io.ReadCloser
+	e *archiveEntry
+}
+
+func (f *deflateFile) Stat() (fs.FileInfo, error) { return f.e, nil }
+
+// countingByteReader counts the bytes read, it's an io.ByteReader to prevent flate from reading ahead
+type countingByteReader struct {
+	r *bufio.Reader
+	n int64
+}
+
+func (c *countingByteReader) Read(b []byte) (int, error) {
+	n, err := c.r.Read(b)
+	c.n += int64(n)
+	return n, err
+}
+
+func (c *countingByteReader) ReadByte() (byte, error) {
+	b, err := c.r.ReadByte()
+	if err == nil {
+		c.n++
+	}
+	return b, err
+}
+
+// msDosTime converts the MS-DOS date and time of the zip headers
+func msDosTime(date, t uint16) time.Time {
+	return time.Date(
+		1980+int(date>>9),
+		time.Month(date>>5&0xf),
+		int(date&0x1f),
+		int(t>>11),
+		int(t>>5&0x3f),
+		int(t&0x1f*2),
+		0,
+		time.UTC,
+	)
+}
@@ -0,0 +1,153 @@
+package fshelper
+
+import (
+	"archive/zip"
+	"bytes"
+	"io/fs"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"testing"
+	"testing/fstest"
+	"time"
+)
+
+type zipItem struct {
+	name    string
+	content []byte
+	method  uint16
+}
+
+// writeZip writes the archive, and gives the offset of the header of each entry
+func writeZip(t *testing.T, items []zipItem) ([]byte, []int64) {
+	var b bytes.Buffer
+	w := zip.NewWriter(&b)
+	for _, it := range items {
+		f, err := w.CreateHeader(&zip.FileHeader{Name: it.name, Method: it.method, Modified: time.Date(2023, 8, 1, 12, 0, 0, 0, time.UTC)})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := f.Write(it.content); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	data := b.Bytes()
+	offsets := []int64{}
+	for _, it := range items {
+		offsets = append(offsets, int64(bytes.Index(data, []byte(it.name))-zipLocalHeaderLen))
+	}
+	return data, offsets
+}
+
+func TestRecoverZip(t *testing.T) {
+	noise := make([]byte, 20000)
+	rand.New(rand.NewSource(1)).Read(noise)
+	items := []zipItem{
+		{name: "Takeout/Google Photos/Photos from 2023/IMG_0001.jpg", content: noise[:5000], method: zip.Store},
+		{name: "Takeout/Google Photos/Photos from 2023/IMG_0001.jpg.json", content: []byte(`{"title":"IMG_0001.jpg"}`), method: zip.Deflate},
+		{name: "Takeout/Google Photos/Album/", method: zip.Store},
+		{name: "Takeout/Google Photos/Album/IMG_0002.jpg", content: bytes.Repeat([]byte("second photo "), 1000), method: zip.Deflate},
+		{name: "Takeout/Google Photos/Album/IMG_0003.jpg", content: noise, method: zip.Deflate},
+	}
+	data, offsets := writeZip(t, items)
+
+	tc := []struct {
+		name     string
+		data     func() []byte
+		expected []string
+		lost     []LostEntry
+	}{
+		{
+			name:     "truncated in the last file",
+			data:     func() []byte { return data[:offsets[4]+1000] },
+			expected: []string{items[0].name, items[1].name, items[3].name},
+			lost:     []LostEntry{{Name: items[4].name, Reason: "truncated file"}},
+		},
+		{
+			name:     "truncated in a header",
+			data:     func() []byte { return data[:offsets[4]+10] },
+			expected: []string{items[0].name, items[1].name, items[3].name},
+			lost:     []LostEntry{{Name: "entry at offset " + strconv.FormatInt(offsets[4], 10), Reason: "truncated header"}},
+		},
+		{
+			name:     "truncated in the central directory",
+			data:     func() []byte { return data[:len(data)-10] },
+			expected: []string{items[0].name, items[1].name, items[3].name, items[4].name},
+		},
+		{
+			name: "corrupted file",
+			data: func() []byte {
+				d := bytes.Clone(data[:offsets[4]+1000])
+				d[offsets[0]+200] ^= 0xff
+				return d
+			},
+			expected: []string{items[1].name, items[3].name},
+			lost: []LostEntry{
+				{Name: items[0].name, Reason: "checksum error"},
+				{Name: items[4].name, Reason: "truncated file"},
+			},
+		},
+	}
+
+	for _, c := range tc {
+		t.Run(c.name, func(t *testing.T) {
+			name := filepath.Join(t.TempDir(), "takeout-001.zip")
+			if err := os.WriteFile(name, c.data(), 0o644); err != nil {
+				t.Fatal(err)
+			}
+			fsys, err := OpenZip(name)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer func() { _ = CloseFSs([]fs.FS{fsys}) }()
+			z, ok := fsys.(*RecoveredZipFS)
+			if !ok {
+				t.Fatalf("expecting a recovered archive, got %T", fsys)
+			}
+			if SourceName(z) != "takeout-001.zip" {
+				t.Errorf("unexpected source name %q", SourceName(z))
+			}
+			if err := fstest.TestFS(z, c.expected...); err != nil {
+				t.Error(err)
+			}
+			for _, it := range items {
+				b, err := fs.ReadFile(z, it.name)
+				if err == nil && !bytes.Equal(b, it.content) {
+					t.Errorf("unexpected content for %s", it.name)
+				}
+			}
+			if !slices.Equal(z.Lost(), c.lost) {
+				t.Errorf("expecting lost files %v, got %v", c.lost, z.Lost())
+			}
+		})
+	}
+}
+
+func TestOpenZip(t *testing.T) {
+	data, _ := writeZip(t, []zipItem{{name: "photo.jpg", content: []byte("photo"), method: zip.Deflate}})
+	name := filepath.Join(t.TempDir(), "takeout.zip")
+	if err := os.WriteFile(name, data, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	fsys, err := OpenZip(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = CloseFSs([]fs.FS{fsys}) }()
+	if _, ok := fsys.(*zipFS); !ok {
+		t.Errorf("expecting a zip file system, got %T", fsys)
+	}
+
+	name = filepath.Join(t.TempDir(), "empty.zip")
+	if err := os.WriteFile(name, []byte("not a zip file"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = OpenZip(name); err == nil {
+		t.Error("expecting an error")
+	}
+}
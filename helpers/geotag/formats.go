@@ -0,0 +1,225 @@
+package geotag
+
+import (
+	"encoding/json"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ReadGPX reads track points of a GPX file
+func ReadGPX(r io.Reader) ([]Point, error) {
+	type gpxPoint struct {
+		Lat  float64 `xml:"lat,attr"`
+		Lon  float64 `xml:"lon,attr"`
+		Ele  float64 `xml:"ele"`
+		Time string  `xml:"time"`
+	}
+	var doc struct {
+		Tracks []struct {
+			Segments []struct {
+				Points []gpxPoint `xml:"trkpt"`
+			} `xml:"trkseg"`
+		} `xml:"trk"`
+	}
+
+	err := xml.NewDecoder(r).Decode(&doc)
+	if err != nil {
+		return nil, fmt.Errorf("can't decode the GPX file: %w", err)
+	}
+	var points []Point
+	for _, trk := range doc.Tracks {
+		for _, seg := range trk.Segments {
+			for _, p := range seg.Points {
+				t, err := parseTime(p.Time)
+				if err != nil {
+					continue
+				}
+				points = append(points, Point{Time: t, Latitude: p.Lat, Longitude: p.Lon, Altitude: p.Ele})
+			}
+		}
+	}
+	return points, nil
+}
+
+// ReadKML reads the gx:Track elements of a KML file.
+// Each <when> element is paired with the <gx:coord> element of the same rank.
+func ReadKML(r io.Reader) ([]Point, error) {
+	var points []Point
+	var whens []time.Time
+	var coords []Point
+	inTrack := false
+
+	dec := xml.NewDecoder(r)
+	for {
+		tok, err := dec.Token()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("can't decode the KML file: %w", err)
+		}
+		switch e := tok.(type) {
+		case xml.StartElement:
+			switch e.Name.Local {
+			case "Track":
+				inTrack = true
+				whens, coords = nil, nil
+			case "when":
+				if !inTrack {
+					continue
+				}
+				var s string
+				if err := dec.DecodeElement(&s, &e); err != nil {
+					return nil, fmt.Errorf("can't decode the KML file: %w", err)
+				}
+				t, _ := parseTime(s)
+				whens = append(whens, t)
+			case "coord":
+				if !inTrack {
+					continue
+				}
+				var s string
+				if err := dec.DecodeElement(&s, &e); err != nil {
+					return nil, fmt.Errorf("can't decode the KML file: %w", err)
+				}
+				p, _ := parseKMLCoord(s)
+				coords = append(coords, p)
+			}
+		case xml.EndElement:
+			if e.Name.Local == "Track" && inTrack {
+				inTrack = false
+				for i := 0; i < min(len(whens), len(coords)); i++ {
+					if whens[i].IsZero() {
+						continue
+					}
+					p := coords[i]
+					p.Time = whens[i]
+					points = append(points, p)
+				}
+			}
+		}
+	}
+	return points, nil
+}
+
+// parseKMLCoord parses "lon lat alt"
+func parseKMLCoord(s string) (Point, error) {
+	f := strings.Fields(s)
+	if len(f) < 2 {
+		return Point{}, fmt.Errorf("invalid coordinates: %q", s)
+	}
+	var p Point
+	var err error
+	p.Longitude, err = strconv.ParseFloat(f[0], 64)
+	if err != nil {
+		return Point{}, err
+	}
+	p.Latitude, err = strconv.ParseFloat(f[1], 64)
+	if err != nil {
+		return Point{}, err
+	}
+	if len(f) > 2 {
+		p.Altitude, _ = strconv.ParseFloat(f[2], 64)
+	}
+	return p, nil
+}
+
+// ReadGeoJSON reads LineString and MultiLineString features having
+// a coordTimes (or times) property, and Point features having a time property.
+func ReadGeoJSON(r io.Reader) ([]Point, error) {
+	type feature struct {
+		Geometry struct {
+			Type        string          `json:"type"`
+			Coordinates json.RawMessage `json:"coordinates"`
+		} `json:"geometry"`
+		Properties map[string]json.RawMessage `json:"properties"`
+	}
+	var doc struct {
+		Type     string    `json:"type"`
+		Features []feature `json:"features"`
+	}
+	b, err := io.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	err = json.Unmarshal(b, &doc)
+	if err != nil {
+		return nil, fmt.Errorf("can't decode the GeoJSON file: %w", err)
+	}
+	if doc.Type == "Feature" {
+		var f feature
+		if err = json.Unmarshal(b, &f); err != nil {
+			return nil, fmt.Errorf("can't decode the GeoJSON file: %w", err)
+		}
+		doc.Features = append(doc.Features, f)
+	}
+
+	var points []Point
+	for _, f := range doc.Features {
+		times := f.Properties["coordTimes"]
+		if times == nil {
+			times = f.Properties["times"]
+		}
+		switch f.Geometry.Type {
+		case "Point":
+			var c []float64
+			var s string
+			if json.Unmarshal(f.Geometry.Coordinates, &c) != nil || json.Unmarshal(f.Properties["time"], &s) != nil {
+				continue
+			}
+			t, err := parseTime(s)
+			if err != nil || len(c) < 2 {
+				continue
+			}
+			points = append(points, geoJSONPoint(c, t))
+		case "LineString":
+			var cs [][]float64
+			var ts []string
+			if json.Unmarshal(f.Geometry.Coordinates, &cs) != nil || json.Unmarshal(times, &ts) != nil {
+				continue
+			}
+			points = append(points, geoJSONLine(cs, ts)...)
+		case "MultiLineString":
+			var cs [][][]float64
+			var ts [][]string
+			if json.Unmarshal(f.Geometry.Coordinates, &cs) != nil || json.Unmarshal(times, &ts) != nil {
+				continue
+			}
+			for i := 0; i < min(len(cs), len(ts)); i++ {
+				points = append(points, geoJSONLine(cs[i], ts[i])...)
+			}
+		}
+	}
+	return points, nil
+}
+
+func geoJSONLine(cs [][]float64, ts []string) []Point {
+	var points []Point
+	for i := 0; i < min(len(cs), len(ts)); i++ {
+		t, err := parseTime(ts[i])
+		if err != nil || len(cs[i]) < 2 {
+			continue
+		}
+		points = append(points, geoJSONPoint(cs[i], t))
+	}
+	return points
+}
+
+// geoJSONPoint converts [lon, lat, alt] coordinates
+func geoJSONPoint(c []float64, t time.Time) Point {
+	p := Point{Time: t, Longitude: c[0], Latitude: c[1]}
+	if len(c) > 2 {
+		p.Altitude = c[2]
+	}
+	return p
+}
+
+func parseTime(s string) (time.Time, error) {
+	s = strings.TrimSpace(s)
+	return time.Parse(time.RFC3339Nano, s)
+}
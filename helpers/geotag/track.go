@@ -0,0 +1,135 @@
+/*
+Package geotag reads GPS track logs and finds the position of a device at a given time.
+
+Supported formats are GPX, KML (gx:Track) and GeoJSON (LineString with coordTimes).
+*/
+package geotag
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Point is a position recorded at a given time
+type Point struct {
+	Time      time.Time
+	Latitude  float64
+	Longitude float64
+	Altitude  float64
+}
+
+// Track is a list of points sorted by time
+type Track struct {
+	points []Point
+}
+
+// Len returns the number of points in the track
+func (t *Track) Len() int {
+	return len(t.points)
+}
+
+// Add points to the track and keep them sorted
+func (t *Track) Add(points ...Point) {
+	for _, p := range points {
+		if p.Time.IsZero() {
+			continue
+		}
+		t.points = append(t.points, p)
+	}
+	sort.SliceStable(t.points, func(i, j int) bool {
+		return t.points[i].Time.Before(t.points[j].Time)
+	})
+}
+
+// Locate gives the position at the given time.
+//
+// When the time falls between two points separated by less than maxGap,
+// the position is linearly interpolated. Otherwise, the nearest point is used
+// when it is recorded within maxGap of the given time.
+func (t *Track) Locate(when time.Time, maxGap time.Duration) (Point, bool) {
+	if len(t.points) == 0 || when.IsZero() {
+		return Point{}, false
+	}
+	i := sort.Search(len(t.points), func(i int) bool {
+		return !t.points[i].Time.Before(when)
+	})
+
+	switch {
+	case i < len(t.points) && t.points[i].Time.Equal(when):
+		return t.points[i], true
+	case i == 0:
+		return nearest(t.points[0], when, maxGap)
+	case i == len(t.points):
+		return nearest(t.points[i-1], when, maxGap)
+	}
+
+	p0, p1 := t.points[i-1], t.points[i]
+	span := p1.Time.Sub(p0.Time)
+	if span > maxGap {
+		if when.Sub(p0.Time) <= p1.Time.Sub(when) {
+			return nearest(p0, when, maxGap)
+		}
+		return nearest(p1, when, maxGap)
+	}
+	r := float64(when.Sub(p0.Time)) / float64(span)
+	return Point{
+		Time:      when,
+		Latitude:  p0.Latitude + r*(p1.Latitude-p0.Latitude),
+		Longitude: p0.Longitude + r*(p1.Longitude-p0.Longitude),
+		Altitude:  p0.Altitude + r*(p1.Altitude-p0.Altitude),
+	}, true
+}
+
+func nearest(p Point, when time.Time, maxGap time.Duration) (Point, bool) {
+	d := p.Time.Sub(when)
+	if d < 0 {
+		d = -d
+	}
+	if d > maxGap {
+		return Point{}, false
+	}
+	return p, true
+}
+
+// Read decodes the track log using the parser matching the file extension
+func Read(r io.Reader, ext string) ([]Point, error) {
+	switch strings.ToLower(ext) {
+	case ".gpx":
+		return ReadGPX(r)
+	case ".kml":
+		return ReadKML(r)
+	case ".geojson", ".json":
+		return ReadGeoJSON(r)
+	}
+	return nil, fmt.Errorf("unsupported track log format: %s", ext)
+}
+
+// LoadFiles reads all given track logs into one track
+func LoadFiles(names ...string) (*Track, error) {
+	var errs error
+	t := &Track{}
+	for _, name := range names {
+		points, err := loadFile(name)
+		if err != nil {
+			errs = errors.Join(errs, fmt.Errorf("%s: %w", name, err))
+			continue
+		}
+		t.Add(points...)
+	}
+	return t, errs
+}
+
+func loadFile(name string) ([]Point, error) {
+	f, err := os.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return Read(f, filepath.Ext(name))
+}
@@ -0,0 +1,88 @@
+package geotag
+
+import (
+	"math"
+	"strings"
+	"testing"
+	"time"
+)
+
+const sampleGPX = `<?xml version="1.0" encoding="UTF-8"?>
+<gpx version="1.1" creator="test" xmlns="http://www.topografix.com/GPX/1/1">
+ <trk><trkseg>
+  <trkpt lat="48.0" lon="2.0"><ele>100</ele><time>2023-10-06T06:30:00Z</time></trkpt>
+  <trkpt lat="48.1" lon="2.1"><ele>200</ele><time>2023-10-06T06:31:00Z</time></trkpt>
+  <trkpt lat="49.0" lon="3.0"><ele>300</ele><time>2023-10-06T08:00:00Z</time></trkpt>
+ </trkseg></trk>
+</gpx>`
+
+const sampleKML = `<?xml version="1.0" encoding="UTF-8"?>
+<kml xmlns="http://www.opengis.net/kml/2.2" xmlns:gx="http://www.google.com/kml/ext/2.2">
+<Document><Placemark><gx:Track>
+ <when>2023-10-06T06:30:00Z</when>
+ <when>2023-10-06T06:31:00Z</when>
+ <gx:coord>2.0 48.0 100</gx:coord>
+ <gx:coord>2.1 48.1 200</gx:coord>
+</gx:Track></Placemark></Document>
+</kml>`
+
+const sampleGeoJSON = `{"type":"FeatureCollection","features":[
+ {"type":"Feature","geometry":{"type":"LineString","coordinates":[[2.0,48.0,100],[2.1,48.1,200]]},
+  "properties":{"coordTimes":["2023-10-06T06:30:00Z","2023-10-06T06:31:00Z"]}}
+]}`
+
+func TestLocate(t *testing.T) {
+	for _, tc := range []struct {
+		format string
+		data   string
+	}{
+		{".gpx", sampleGPX},
+		{".kml", sampleKML},
+		{".geojson", sampleGeoJSON},
+	} {
+		t.Run(tc.format, func(t *testing.T) {
+			points, err := Read(strings.NewReader(tc.data), tc.format)
+			if err != nil {
+				t.Fatal(err)
+			}
+			tr := &Track{}
+			tr.Add(points...)
+
+			p, ok := tr.Locate(time.Date(2023, 10, 6, 6, 30, 30, 0, time.UTC), 2*time.Minute)
+			if !ok {
+				t.Fatal("expected a position")
+			}
+			if math.Abs(p.Latitude-48.05) > 1e-9 || math.Abs(p.Longitude-2.05) > 1e-9 || math.Abs(p.Altitude-150) > 1e-9 {
+				t.Errorf("unexpected interpolation: %+v", p)
+			}
+
+			_, ok = tr.Locate(time.Date(2023, 10, 6, 6, 40, 0, 0, time.UTC), 2*time.Minute)
+			if ok {
+				t.Errorf("expected no position far from the track points")
+			}
+		})
+	}
+}
+
+func TestLocateGap(t *testing.T) {
+	points, err := ReadGPX(strings.NewReader(sampleGPX))
+	if err != nil {
+		t.Fatal(err)
+	}
+	tr := &Track{}
+	tr.Add(points...)
+
+	// between 06:31 and 08:00 the gap is too large
+	if _, ok := tr.Locate(time.Date(2023, 10, 6, 7, 0, 0, 0, time.UTC), 5*time.Minute); ok {
+		t.Error("expected no position in a gap")
+	}
+	// close enough to the last point before the gap
+	p, ok := tr.Locate(time.Date(2023, 10, 6, 6, 32, 0, 0, time.UTC), 5*time.Minute)
+	if !ok || p.Latitude != 48.1 {
+		t.Errorf("expected the nearest point, got %+v, %v", p, ok)
+	}
+	// before the track start
+	if _, ok := tr.Locate(time.Date(2023, 10, 6, 6, 0, 0, 0, time.UTC), 5*time.Minute); ok {
+		t.Error("expected no position before the track")
+	}
+}
@@ -0,0 +1,180 @@
+// Package hook runs the external commands configured for the events of an upload.
+//
+// The command receives the facts of the asset as a JSON object on its standard
+// input. It may answer with a JSON object on its standard output to veto the
+// asset, or to change its albums, its tags, its favorite flag or its description.
+// An empty output leaves the asset unchanged.
+package hook
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+	"time"
+)
+
+// Event names the moment a hook is called
+type Event string
+
+const (
+	BeforeUpload Event = "before-upload" // before sending the asset, the hook can veto or change it
+	AfterUpload  Event = "after-upload"  // the asset has been uploaded
+	OnSkip       Event = "on-skip"       // the asset isn't uploaded
+	OnError      Event = "on-error"      // the asset can't be uploaded
+	EndOfRun     Event = "end-of-run"    // the upload is completed
+)
+
+var events = []Event{BeforeUpload, AfterUpload, OnSkip, OnError, EndOfRun}
+
+// DefaultTimeout is the maximum duration of a hook's execution
+const DefaultTimeout = time.Minute
+
+// Input is the JSON object given to the hook
+type Input struct {
+	Event       Event            `json:"event"`
+	Server      string           `json:"server,omitempty"`
+	File        string           `json:"file,omitempty"`
+	Source      string           `json:"source,omitempty"`
+	Title       string           `json:"title,omitempty"`
+	Size        int              `json:"size,omitempty"`
+	DateTaken   *time.Time       `json:"dateTaken,omitempty"`
+	Description string           `json:"description,omitempty"`
+	Latitude    float64          `json:"latitude,omitempty"`
+	Longitude   float64          `json:"longitude,omitempty"`
+	Albums      []string         `json:"albums,omitempty"`
+	Favorite    bool             `json:"favorite,omitempty"`
+	Archived    bool             `json:"archived,omitempty"`
+	Trashed     bool             `json:"trashed,omitempty"`
+	LivePhoto   string           `json:"livePhoto,omitempty"`
+	SideCar     string           `json:"sidecar,omitempty"`
+	Decision    string           `json:"decision,omitempty"`
+	Reason      string           `json:"reason,omitempty"`
+	ServerID    string           `json:"serverId,omitempty"`
+	Error       string           `json:"error,omitempty"`
+	Counts      map[string]int64 `json:"counts,omitempty"`
+}
+
+// Output is the JSON object returned by the hook. Omitted fields are left unchanged.
+type Output struct {
+	Veto        bool      `json:"veto,omitempty"`
+	Reason      string    `json:"reason,omitempty"`
+	Albums      *[]string `json:"albums,omitempty"`
+	Tags        []string  `json:"tags,omitempty"`
+	Favorite    *bool     `json:"favorite,omitempty"`
+	Description *string   `json:"description,omitempty"`
+}
+
+// Commands lists the commands by event.
+// It implements the flag.Value interface, the value is EVENT=COMMAND.
+type Commands map[Event][]string
+
+func (c Commands) String() string {
+	s := []string{}
+	for _, e := range events {
+		for _, cmd := range c[e] {
+			s = append(s, string(e)+"="+cmd)
+		}
+	}
+	return strings.Join(s, ",")
+}
+
+func (c Commands) Set(s string) error {
+	e, cmd, ok := strings.Cut(s, "=")
+	if !ok || cmd == "" {
+		return fmt.Errorf("a hook is given as EVENT=COMMAND: %q", s)
+	}
+	e = strings.ToLower(strings.TrimSpace(e))
+	for _, known := range events {
+		if Event(e) == known {
+			c[known] = append(c[known], cmd)
+			return nil
+		}
+	}
+	return fmt.Errorf("unknown hook event %q, expecting one of %s", e, eventList())
+}
+
+func eventList() string {
+	s := []string{}
+	for _, e := range events {
+		s = append(s, string(e))
+	}
+	return strings.Join(s, ", ")
+}
+
+// Has tells if some commands are configured for the event
+func (c Commands) Has(e Event) bool {
+	return len(c[e]) > 0
+}
+
+// Run calls the commands of the event in sequence.
+// The outputs are merged, the last command wins. A veto stops the sequence.
+func (c Commands) Run(ctx context.Context, in Input) (Output, error) {
+	out := Output{}
+	for _, cmd := range c[in.Event] {
+		o, err := run(ctx, cmd, in)
+		if err != nil {
+			return out, err
+		}
+		if o.Veto {
+			return o, nil
+		}
+		if o.Albums != nil {
+			out.Albums = o.Albums
+			in.Albums = *o.Albums
+		}
+		if o.Tags != nil {
+			out.Tags = o.Tags
+		}
+		if o.Favorite != nil {
+			out.Favorite = o.Favorite
+			in.Favorite = *o.Favorite
+		}
+		if o.Description != nil {
+			out.Description = o.Description
+			in.Description = *o.Description
+		}
+	}
+	return out, nil
+}
+
+func run(ctx context.Context, command string, in Input) (Output, error) {
+	ctx, cancel := context.WithTimeout(ctx, DefaultTimeout)
+	defer cancel()
+
+	b, err := json.Marshal(in)
+	if err != nil {
+		return Output{}, err
+	}
+	stdout := bytes.Buffer{}
+	stderr := bytes.Buffer{}
+	cmd := exec.CommandContext(ctx, command)
+	cmd.Stdin = bytes.NewReader(b)
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	cmd.Env = append(os.Environ(), "IMMICH_GO_EVENT="+string(in.Event))
+	err = cmd.Run()
+	if err != nil {
+		msg := strings.TrimSpace(stderr.String())
+		if msg != "" {
+			err = fmt.Errorf("%w: %s", err, msg)
+		}
+		return Output{}, fmt.Errorf("hook %s %s: %w", in.Event, command, err)
+	}
+
+	out := Output{}
+	if len(bytes.TrimSpace(stdout.Bytes())) == 0 {
+		return out, nil
+	}
+	err = json.Unmarshal(stdout.Bytes(), &out)
+	if err != nil {
+		return out, fmt.Errorf("hook %s %s: can't decode the output: %w", in.Event, command, err)
+	}
+	if out.Veto && out.Reason == "" {
+		out.Reason = "vetoed by " + command
+	}
+	return out, nil
+}
@@ -0,0 +1,86 @@
+package hook
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+)
+
+// script writes an executable shell script
+func script(t *testing.T, body string) string {
+	t.Helper()
+	if runtime.GOOS == "windows" {
+		t.Skip("shell scripts aren't available")
+	}
+	name := filepath.Join(t.TempDir(), "hook.sh")
+	err := os.WriteFile(name, []byte("#!/bin/sh\n"+body), 0o755)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return name
+}
+
+func TestCommandsSet(t *testing.T) {
+	c := Commands{}
+	for _, s := range []string{"before-upload=/bin/a", "ON-SKIP=/bin/b", "before-upload=/bin/c"} {
+		if err := c.Set(s); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if got := c.String(); got != "before-upload=/bin/a,before-upload=/bin/c,on-skip=/bin/b" {
+		t.Errorf("unexpected commands: %s", got)
+	}
+	for _, s := range []string{"before-upload", "after=/bin/a", "on-error="} {
+		if err := c.Set(s); err == nil {
+			t.Errorf("%q should be rejected", s)
+		}
+	}
+}
+
+func TestRun(t *testing.T) {
+	input := filepath.Join(t.TempDir(), "input.json")
+	first := script(t, `cat > `+input+`
+echo '{"albums":["Holidays"],"favorite":true}'
+`)
+	second := script(t, `case "$(cat)" in
+*'"albums":["Holidays"]'*) echo '{"tags":["Places/Paris"],"description":"Eiffel tower"}';;
+*) echo "the first hook's albums are missing" >&2; exit 1;;
+esac
+`)
+	c := Commands{BeforeUpload: {first, second}}
+	out, err := c.Run(context.Background(), Input{Event: BeforeUpload, File: "Photos/IMG_001.jpg", Albums: []string{"Photos"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if out.Veto || out.Albums == nil || (*out.Albums)[0] != "Holidays" || out.Favorite == nil || !*out.Favorite ||
+		out.Description == nil || *out.Description != "Eiffel tower" || len(out.Tags) != 1 || out.Tags[0] != "Places/Paris" {
+		t.Errorf("unexpected output: %+v", out)
+	}
+	b, err := os.ReadFile(input)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(b), `"file":"Photos/IMG_001.jpg"`) {
+		t.Errorf("unexpected input: %s", b)
+	}
+}
+
+func TestRunVetoAndError(t *testing.T) {
+	veto := script(t, `echo '{"veto":true}'`)
+	out, err := Commands{OnSkip: {veto}}.Run(context.Background(), Input{Event: OnSkip})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !out.Veto || out.Reason == "" {
+		t.Errorf("expecting a veto with a reason, got %+v", out)
+	}
+
+	failing := script(t, `echo "DAM unavailable" >&2; exit 2`)
+	_, err = Commands{OnSkip: {failing}}.Run(context.Background(), Input{Event: OnSkip})
+	if err == nil || !strings.Contains(err.Error(), "DAM unavailable") {
+		t.Errorf("expecting the hook's error message, got %v", err)
+	}
+}
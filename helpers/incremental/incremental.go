@@ -0,0 +1,183 @@
+// Package incremental remembers the files handled by the previous runs, to skip
+// the unchanged ones.
+//
+// A state is kept for each source folder and server. It holds the watermark,
+// the start time of the last successful run, and the fingerprint of each file
+// handled by that run: its path, its size and its modification time.
+//
+// A file is unchanged when its fingerprint is the same as the recorded one,
+// and when its modification time is before the watermark.
+package incremental
+
+import (
+	"bufio"
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const header = "immich-go incremental 1"
+
+// Fingerprint identifies a version of a file
+type Fingerprint struct {
+	Size    int64
+	ModTime time.Time
+}
+
+// State is the incremental state of a source folder for a server
+type State struct {
+	file      string
+	root      string
+	server    string
+	watermark time.Time              // start of the last successful run
+	previous  map[string]Fingerprint // files handled by the previous runs
+
+	lock    sync.Mutex
+	started time.Time              // start of this run
+	current map[string]Fingerprint // files handled by this run
+}
+
+// Load reads the state of the root folder for the server from the directory.
+// An empty state is returned when the folder hasn't been uploaded yet.
+func Load(dir string, server string, root string) (*State, error) {
+	h := sha256.Sum256([]byte(server + "\n" + root))
+	s := State{
+		file:     filepath.Join(dir, hex.EncodeToString(h[:12])+".gz"),
+		root:     root,
+		server:   server,
+		previous: map[string]Fingerprint{},
+		started:  time.Now(),
+		current:  map[string]Fingerprint{},
+	}
+
+	f, err := os.Open(s.file)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return &s, nil
+		}
+		return nil, err
+	}
+	defer f.Close()
+	err = s.read(f)
+	if err != nil {
+		return nil, fmt.Errorf("can't read the incremental state %s: %w", s.file, err)
+	}
+	return &s, nil
+}
+
+func (s *State) read(r io.Reader) error {
+	gz, err := gzip.NewReader(r)
+	if err != nil {
+		return err
+	}
+	defer gz.Close()
+
+	sc := bufio.NewScanner(gz)
+	sc.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+	if !sc.Scan() {
+		return errors.New("empty file")
+	}
+	// immich-go incremental 1 \t server \t root \t watermark
+	fields := strings.Split(sc.Text(), "\t")
+	if len(fields) != 4 || fields[0] != header {
+		return errors.New("unknown format")
+	}
+	if fields[1] != s.server || fields[2] != s.root {
+		// hash collision or renamed state file, ignore it
+		return nil
+	}
+	s.watermark, err = time.Parse(time.RFC3339Nano, fields[3])
+	if err != nil {
+		return err
+	}
+
+	// size \t modtime \t path
+	for sc.Scan() {
+		fields := strings.SplitN(sc.Text(), "\t", 3)
+		if len(fields) != 3 {
+			return errors.New("malformed line")
+		}
+		size, err := strconv.ParseInt(fields[0], 10, 64)
+		if err != nil {
+			return err
+		}
+		mt, err := strconv.ParseInt(fields[1], 10, 64)
+		if err != nil {
+			return err
+		}
+		s.previous[fields[2]] = Fingerprint{Size: size, ModTime: time.Unix(0, mt)}
+	}
+	return sc.Err()
+}
+
+// Watermark gives the start time of the last successful run
+func (s *State) Watermark() time.Time {
+	return s.watermark
+}
+
+// Len gives the number of files known by the state
+func (s *State) Len() int {
+	return len(s.previous)
+}
+
+// Unchanged tells if the file hasn't changed since the last successful run.
+// The file is registered as handled by this run, until it is forgotten.
+func (s *State) Unchanged(name string, size int64, modTime time.Time) bool {
+	fp := Fingerprint{Size: size, ModTime: modTime}
+	s.lock.Lock()
+	s.current[name] = fp
+	s.lock.Unlock()
+
+	prev, ok := s.previous[name]
+	if !ok || s.watermark.IsZero() {
+		return false
+	}
+	return prev.Size == fp.Size && prev.ModTime.Equal(fp.ModTime) && !fp.ModTime.After(s.watermark)
+}
+
+// Forget removes the file from the files handled by this run.
+// It will be processed again by the next run.
+func (s *State) Forget(name string) {
+	s.lock.Lock()
+	delete(s.current, name)
+	s.lock.Unlock()
+}
+
+// Save writes the files handled by this run, with the start time of the run as watermark.
+// The state file is replaced atomically.
+func (s *State) Save() error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	err := os.MkdirAll(filepath.Dir(s.file), 0o700)
+	if err != nil {
+		return err
+	}
+	f, err := os.CreateTemp(filepath.Dir(s.file), "state-*.tmp")
+	if err != nil {
+		return err
+	}
+	tmp := f.Name()
+	defer os.Remove(tmp)
+
+	gz := gzip.NewWriter(f)
+	w := bufio.NewWriter(gz)
+	fmt.Fprintf(w, "%s\t%s\t%s\t%s\n", header, s.server, s.root, s.started.Format(time.RFC3339Nano))
+	for name, fp := range s.current {
+		fmt.Fprintf(w, "%d\t%d\t%s\n", fp.Size, fp.ModTime.UnixNano(), name)
+	}
+	err = errors.Join(w.Flush(), gz.Close(), f.Close())
+	if err != nil {
+		return err
+	}
+	return os.Rename(tmp, s.file)
+}
@@ -0,0 +1,79 @@
+package incremental
+
+import (
+	"testing"
+	"time"
+)
+
+func TestState(t *testing.T) {
+	dir := t.TempDir()
+	old := time.Date(2023, 10, 6, 6, 30, 0, 0, time.UTC)
+
+	s, err := Load(dir, "http://immich:2283", "/photos")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s.Unchanged("a.jpg", 100, old) {
+		t.Error("a.jpg is unknown, it can't be unchanged")
+	}
+	s.Unchanged("b.jpg", 200, old)
+	s.Unchanged("c.jpg", 300, old)
+	s.Forget("c.jpg")
+	err = s.Save()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	s, err = Load(dir, "http://immich:2283", "/photos")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s.Len() != 2 {
+		t.Errorf("expecting 2 files, got %d", s.Len())
+	}
+	for _, c := range []struct {
+		name      string
+		size      int64
+		modTime   time.Time
+		unchanged bool
+	}{
+		{"a.jpg", 100, old, true},
+		{"b.jpg", 201, old, false},
+		{"c.jpg", 300, old, false},
+		{"a.jpg", 100, old.Add(time.Second), false},
+		{"d.jpg", 100, old, false},
+	} {
+		if got := s.Unchanged(c.name, c.size, c.modTime); got != c.unchanged {
+			t.Errorf("%s %d %s: expecting unchanged=%v", c.name, c.size, c.modTime, c.unchanged)
+		}
+	}
+
+	other, err := Load(dir, "http://other:2283", "/photos")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if other.Len() != 0 {
+		t.Error("the state of another server should be empty")
+	}
+}
+
+func TestModifiedAfterWatermark(t *testing.T) {
+	dir := t.TempDir()
+	s, err := Load(dir, "server", "/photos")
+	if err != nil {
+		t.Fatal(err)
+	}
+	future := time.Now().Add(time.Hour)
+	s.Unchanged("a.jpg", 100, future)
+	err = s.Save()
+	if err != nil {
+		t.Fatal(err)
+	}
+	s, err = Load(dir, "server", "/photos")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s.Unchanged("a.jpg", 100, future) {
+		t.Error("a file modified after the watermark must be processed again")
+	}
+}
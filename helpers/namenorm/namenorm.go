@@ -0,0 +1,32 @@
+// Package namenorm gives the keys used to compare the file names.
+//
+// macOS gives the names in the decomposed Unicode form (NFD), where the Google Photos JSON files and
+// the immich server use the composed form (NFC). An accented name has then two different encodings.
+package namenorm
+
+import (
+	"golang.org/x/text/cases"
+	"golang.org/x/text/unicode/norm"
+)
+
+// Normalizer gives the comparison key of a name.
+// The zero value normalizes the names in the NFC form.
+type Normalizer struct {
+	FoldCase bool // ignore the case of the names
+}
+
+// Key gives the normalized form of the name.
+// The key is only used to compare names, the original name is kept for the files and the titles.
+func (n Normalizer) Key(name string) string {
+	name = norm.NFC.String(name)
+	if n.FoldCase {
+		// a Caser isn't safe for concurrent use
+		name = cases.Fold().String(name)
+	}
+	return name
+}
+
+// Equal tells if the names are the same once normalized
+func (n Normalizer) Equal(a, b string) bool {
+	return n.Key(a) == n.Key(b)
+}
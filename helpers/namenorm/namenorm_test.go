@@ -0,0 +1,33 @@
+package namenorm
+
+import "testing"
+
+func TestKey(t *testing.T) {
+	const (
+		nfc = "Crème brûlée.jpg"                   // as given by Google Photos and immich
+		nfd = "Cre\u0300me bru\u0302le\u0301e.jpg" // as given by macOS
+	)
+	tests := []struct {
+		name string
+		n    Normalizer
+		a, b string
+		want bool
+	}{
+		{name: "NFC and NFD", a: nfc, b: nfd, want: true},
+		{name: "same name", a: "IMG_0001.JPG", b: "IMG_0001.JPG", want: true},
+		{name: "case", a: "IMG_0001.JPG", b: "img_0001.jpg", want: false},
+		{name: "folded case", n: Normalizer{FoldCase: true}, a: "IMG_0001.JPG", b: "img_0001.jpg", want: true},
+		{name: "folded case and NFD", n: Normalizer{FoldCase: true}, a: "CRÈME.JPG", b: "cre\u0300me.jpg", want: true},
+		{name: "different names", n: Normalizer{FoldCase: true}, a: "IMG_0001.JPG", b: "IMG_0002.JPG", want: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.n.Equal(tt.a, tt.b); got != tt.want {
+				t.Errorf("Equal(%q, %q) = %v, want %v", tt.a, tt.b, got, tt.want)
+			}
+		})
+	}
+	if got := (Normalizer{}).Key(nfd); got != nfc {
+		t.Errorf("Key(%q) = %q, want %q", nfd, got, nfc)
+	}
+}
@@ -0,0 +1,209 @@
+// Package notify sends a summary of the run to a webhook when a command ends.
+//
+// The summary is posted as a generic JSON document, or formatted for
+// ntfy, Gotify or Apprise.
+package notify
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Run status
+const (
+	StatusSuccess   = "success"
+	StatusError     = "error"
+	StatusCancelled = "cancelled"
+)
+
+// Summary of a run
+type Summary struct {
+	Command   string           `json:"command"`
+	Status    string           `json:"status"`          // success, error or cancelled
+	Error     string           `json:"error,omitempty"` // the error that ended the run
+	Errors    int64            `json:"errors"`          // number of errors recorded during the run
+	Started   time.Time        `json:"started"`
+	Ended     time.Time        `json:"ended"`
+	Duration  float64          `json:"duration"` // in seconds
+	Counts    map[string]int64 `json:"counts,omitempty"`
+	Report    string           `json:"report,omitempty"` // path to the log file
+	Server    string           `json:"server,omitempty"`
+	Hostname  string           `json:"hostname,omitempty"`
+	APITraces string           `json:"apiTraces,omitempty"` // path to the API trace file
+}
+
+// Title gives a one line description of the run
+func (s Summary) Title() string {
+	switch s.Status {
+	case StatusSuccess:
+		return fmt.Sprintf("immich-go %s completed", s.Command)
+	case StatusCancelled:
+		return fmt.Sprintf("immich-go %s cancelled", s.Command)
+	}
+	return fmt.Sprintf("immich-go %s failed", s.Command)
+}
+
+// Message gives a human readable description of the run
+func (s Summary) Message() string {
+	b := strings.Builder{}
+	if s.Hostname != "" {
+		fmt.Fprintf(&b, "Host: %s\n", s.Hostname)
+	}
+	if s.Server != "" {
+		fmt.Fprintf(&b, "Server: %s\n", s.Server)
+	}
+	fmt.Fprintf(&b, "Duration: %s\n", (time.Duration(s.Duration * float64(time.Second))).Round(time.Second))
+	if s.Error != "" {
+		fmt.Fprintf(&b, "Error: %s\n", s.Error)
+	}
+	if s.Errors > 0 {
+		fmt.Fprintf(&b, "Errors during the run: %d\n", s.Errors)
+	}
+	keys := make([]string, 0, len(s.Counts))
+	for k := range s.Counts {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		fmt.Fprintf(&b, "%s: %d\n", k, s.Counts[k])
+	}
+	if s.Report != "" {
+		fmt.Fprintf(&b, "Report: %s\n", s.Report)
+	}
+	return strings.TrimSuffix(b.String(), "\n")
+}
+
+// Format of the webhook's payload
+type Format string
+
+const (
+	FormatJSON    Format = "json"    // the summary as it is
+	FormatNtfy    Format = "ntfy"    // ntfy topic URL, ex: https://ntfy.sh/my-topic
+	FormatGotify  Format = "gotify"  // Gotify message URL, ex: https://gotify.example.com/message?token=xxx
+	FormatApprise Format = "apprise" // Apprise API notify URL, ex: http://apprise:8000/notify/my-key
+)
+
+// Set implements flag.Value
+func (f *Format) Set(s string) error {
+	switch v := Format(strings.ToLower(s)); v {
+	case FormatJSON, FormatNtfy, FormatGotify, FormatApprise:
+		*f = v
+		return nil
+	}
+	return fmt.Errorf("unknown notification format %q, expecting json, ntfy, gotify or apprise", s)
+}
+
+func (f Format) String() string {
+	if f == "" {
+		return string(FormatJSON)
+	}
+	return string(f)
+}
+
+// Notifier posts the summary to a webhook
+type Notifier struct {
+	URL    string
+	Format Format
+	Client *http.Client
+}
+
+// New creates a notifier for the URL and the format
+func New(url string, format Format) *Notifier {
+	return &Notifier{
+		URL:    url,
+		Format: format,
+		Client: &http.Client{Timeout: 30 * time.Second},
+	}
+}
+
+// Send posts the summary
+func (n *Notifier) Send(ctx context.Context, s Summary) error {
+	req, err := n.request(ctx, s)
+	if err != nil {
+		return err
+	}
+	resp, err := n.Client.Do(req)
+	if err != nil {
+		return fmt.Errorf("can't send the notification: %w", err)
+	}
+	defer resp.Body.Close()
+	_, _ = io.Copy(io.Discard, resp.Body)
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("can't send the notification: %s", resp.Status)
+	}
+	return nil
+}
+
+func (n *Notifier) request(ctx context.Context, s Summary) (*http.Request, error) {
+	var body []byte
+	var err error
+	contentType := "application/json"
+	header := http.Header{}
+
+	switch n.Format {
+	case FormatNtfy:
+		body = []byte(s.Message())
+		contentType = "text/plain; charset=utf-8"
+		header.Set("Title", s.Title())
+		if s.Status == StatusSuccess && s.Errors == 0 {
+			header.Set("Tags", "white_check_mark")
+		} else {
+			header.Set("Tags", "warning")
+			header.Set("Priority", "high")
+		}
+	case FormatGotify:
+		priority := 5
+		if s.Status != StatusSuccess || s.Errors > 0 {
+			priority = 8
+		}
+		body, err = json.Marshal(struct {
+			Title    string         `json:"title"`
+			Message  string         `json:"message"`
+			Priority int            `json:"priority"`
+			Extras   map[string]any `json:"extras,omitempty"`
+		}{
+			Title:    s.Title(),
+			Message:  s.Message(),
+			Priority: priority,
+			Extras:   map[string]any{"immich-go::summary": s},
+		})
+	case FormatApprise:
+		typ := "success"
+		switch {
+		case s.Status != StatusSuccess:
+			typ = "failure"
+		case s.Errors > 0:
+			typ = "warning"
+		}
+		body, err = json.Marshal(struct {
+			Title string `json:"title"`
+			Body  string `json:"body"`
+			Type  string `json:"type"`
+		}{
+			Title: s.Title(),
+			Body:  s.Message(),
+			Type:  typ,
+		})
+	default:
+		body, err = json.Marshal(s)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, n.URL, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	req.Header = header
+	req.Header.Set("Content-Type", contentType)
+	req.Header.Set("User-Agent", "immich-go")
+	return req, nil
+}
@@ -0,0 +1,144 @@
+package notify
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func sampleSummary() Summary {
+	started := time.Date(2024, 7, 1, 2, 0, 0, 0, time.UTC)
+	return Summary{
+		Command:  "upload",
+		Status:   StatusError,
+		Error:    "can't reach the server",
+		Errors:   2,
+		Started:  started,
+		Ended:    started.Add(90 * time.Second),
+		Duration: 90,
+		Counts:   map[string]int64{"uploaded": 12, "upload error": 2},
+		Report:   "/tmp/immich-go.log",
+	}
+}
+
+type received struct {
+	header http.Header
+	body   []byte
+}
+
+func standIn(t *testing.T, status int) (*httptest.Server, chan received) {
+	c := make(chan received, 1)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			t.Errorf("unexpected method: %s", r.Method)
+		}
+		b, _ := io.ReadAll(r.Body)
+		c <- received{header: r.Header, body: b}
+		w.WriteHeader(status)
+	}))
+	t.Cleanup(srv.Close)
+	return srv, c
+}
+
+func TestSend(t *testing.T) {
+	testCases := []struct {
+		format Format
+		check  func(t *testing.T, r received)
+	}{
+		{
+			format: FormatJSON,
+			check: func(t *testing.T, r received) {
+				var s Summary
+				if err := json.Unmarshal(r.body, &s); err != nil {
+					t.Fatal(err)
+				}
+				if s.Status != StatusError || s.Counts["uploaded"] != 12 || s.Report != "/tmp/immich-go.log" || s.Duration != 90 {
+					t.Errorf("unexpected summary: %+v", s)
+				}
+			},
+		},
+		{
+			format: FormatNtfy,
+			check: func(t *testing.T, r received) {
+				if r.header.Get("Title") != "immich-go upload failed" {
+					t.Errorf("unexpected title: %q", r.header.Get("Title"))
+				}
+				if r.header.Get("Priority") != "high" {
+					t.Errorf("unexpected priority: %q", r.header.Get("Priority"))
+				}
+				if !strings.Contains(string(r.body), "uploaded: 12") {
+					t.Errorf("unexpected message: %s", r.body)
+				}
+			},
+		},
+		{
+			format: FormatGotify,
+			check: func(t *testing.T, r received) {
+				var m struct {
+					Title    string `json:"title"`
+					Message  string `json:"message"`
+					Priority int    `json:"priority"`
+				}
+				if err := json.Unmarshal(r.body, &m); err != nil {
+					t.Fatal(err)
+				}
+				if m.Title != "immich-go upload failed" || m.Priority != 8 || !strings.Contains(m.Message, "Error: can't reach the server") {
+					t.Errorf("unexpected message: %+v", m)
+				}
+			},
+		},
+		{
+			format: FormatApprise,
+			check: func(t *testing.T, r received) {
+				var m struct {
+					Title string `json:"title"`
+					Body  string `json:"body"`
+					Type  string `json:"type"`
+				}
+				if err := json.Unmarshal(r.body, &m); err != nil {
+					t.Fatal(err)
+				}
+				if m.Type != "failure" || !strings.Contains(m.Body, "Report: /tmp/immich-go.log") {
+					t.Errorf("unexpected message: %+v", m)
+				}
+			},
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(string(tc.format), func(t *testing.T) {
+			srv, c := standIn(t, http.StatusOK)
+			err := New(srv.URL, tc.format).Send(context.Background(), sampleSummary())
+			if err != nil {
+				t.Fatal(err)
+			}
+			tc.check(t, <-c)
+		})
+	}
+}
+
+func TestSendError(t *testing.T) {
+	srv, c := standIn(t, http.StatusUnauthorized)
+	err := New(srv.URL, FormatJSON).Send(context.Background(), sampleSummary())
+	<-c
+	if err == nil {
+		t.Error("expecting an error")
+	}
+}
+
+func TestFormat(t *testing.T) {
+	var f Format
+	if f.String() != "json" {
+		t.Errorf("unexpected default format: %s", f)
+	}
+	if err := f.Set("NTFY"); err != nil || f != FormatNtfy {
+		t.Errorf("unexpected result: %s, %v", f, err)
+	}
+	if err := f.Set("slack"); err == nil {
+		t.Error("expecting an error")
+	}
+}
@@ -0,0 +1,143 @@
+// Package quarantine keeps a copy of the files that can't be imported, for a manual review.
+//
+// Files are copied into the quarantine folder, under the name of their source
+// (archive or folder) and with their relative path. Each file is followed by a
+// .reason.txt file explaining why it has been quarantined. The JSON and the
+// sidecar files are copied beside.
+package quarantine
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/simulot/immich-go/helpers/fshelper"
+	"github.com/simulot/immich-go/immich/metadata"
+)
+
+type Quarantine struct {
+	dir    string
+	lock   sync.Mutex
+	copied map[string]bool // destination files already copied
+}
+
+// New prepares the quarantine folder
+func New(dir string) (*Quarantine, error) {
+	err := os.MkdirAll(dir, 0o755)
+	if err != nil {
+		return nil, fmt.Errorf("can't create the quarantine folder: %w", err)
+	}
+	return &Quarantine{
+		dir:    dir,
+		copied: map[string]bool{},
+	}, nil
+}
+
+// Put copies the file and its companions into the quarantine folder,
+// and adds the reason to the file's .reason.txt
+func (q *Quarantine) Put(ctx context.Context, fsys fs.FS, name string, reason string, companions ...metadata.SideCarFile) error {
+	q.lock.Lock()
+	defer q.lock.Unlock()
+
+	dest, err := q.copy(ctx, fsys, name)
+	if err != nil {
+		return err
+	}
+	for _, c := range companions {
+		if !c.IsSet() {
+			continue
+		}
+		_, err = q.copy(ctx, c.FSys, c.FileName)
+		if err != nil {
+			return err
+		}
+	}
+
+	f, err := os.OpenFile(dest+".reason.txt", os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0o644)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	fmt.Fprintf(f, "File:    %s\n", name)
+	if source := fshelper.SourceName(fsys); source != "" {
+		fmt.Fprintf(f, "Source:  %s\n", source)
+	}
+	for _, c := range companions {
+		if c.IsSet() {
+			fmt.Fprintf(f, "With:    %s\n", c.FileName)
+		}
+	}
+	fmt.Fprintf(f, "Reason:  %s\n", reason)
+	fmt.Fprintf(f, "Date:    %s\n\n", time.Now().Format(time.RFC3339))
+	return nil
+}
+
+// sourceFolder gives the folder of the source's files, the source name can't be a path
+func sourceFolder(source string) string {
+	source = strings.Map(func(r rune) rune {
+		switch r {
+		case '/', '\\', ':':
+			return '_'
+		}
+		return r
+	}, source)
+	if strings.Trim(source, ".") == "" {
+		return "unknown source"
+	}
+	return source
+}
+
+// destination gives the path of the copy of the file, always inside the quarantine folder
+func (q *Quarantine) destination(fsys fs.FS, name string) (string, error) {
+	name = strings.TrimPrefix(path.Clean("/"+name), "/")
+	dest := filepath.Join(q.dir, sourceFolder(fshelper.SourceName(fsys)), filepath.FromSlash(name))
+	rel, err := filepath.Rel(q.dir, dest)
+	if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return "", fmt.Errorf("can't quarantine the file %s outside of the folder %s", name, q.dir)
+	}
+	return dest, nil
+}
+
+func (q *Quarantine) copy(ctx context.Context, fsys fs.FS, name string) (string, error) {
+	dest, err := q.destination(fsys, name)
+	if err != nil {
+		return "", err
+	}
+	if q.copied[dest] {
+		return dest, nil
+	}
+	if err := ctx.Err(); err != nil {
+		return dest, err
+	}
+	err = os.MkdirAll(filepath.Dir(dest), 0o755)
+	if err != nil {
+		return dest, err
+	}
+	src, err := fsys.Open(name)
+	if err != nil {
+		return dest, err
+	}
+	defer src.Close()
+	dst, err := os.Create(dest)
+	if err != nil {
+		return dest, err
+	}
+	_, err = io.Copy(dst, src)
+	if err != nil {
+		dst.Close()
+		return dest, err
+	}
+	err = dst.Close()
+	if err != nil {
+		return dest, err
+	}
+	q.copied[dest] = true
+	return dest, nil
+}
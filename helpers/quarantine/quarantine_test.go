@@ -0,0 +1,93 @@
+package quarantine
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"testing/fstest"
+
+	"github.com/simulot/immich-go/helpers/fshelper"
+	"github.com/simulot/immich-go/immich/metadata"
+)
+
+func TestPut(t *testing.T) {
+	dir := t.TempDir()
+	q, err := New(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	fsys := fshelper.NewFSWithName(fstest.MapFS{
+		"Google Photos/Trip/IMG_001.jpg":      {Data: []byte("image")},
+		"Google Photos/Trip/IMG_001.jpg.json": {Data: []byte("{}")},
+	}, "takeout-001.zip")
+
+	ctx := context.Background()
+	json := metadata.SideCarFile{FSys: fsys, FileName: "Google Photos/Trip/IMG_001.jpg.json"}
+	err = q.Put(ctx, fsys, "Google Photos/Trip/IMG_001.jpg", "upload error", json, metadata.SideCarFile{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = q.Put(ctx, fsys, "Google Photos/Trip/IMG_001.jpg", "upload error on the replica", json)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	base := filepath.Join(dir, "takeout-001.zip", "Google Photos", "Trip")
+	for f, expected := range map[string]string{
+		"IMG_001.jpg":      "image",
+		"IMG_001.jpg.json": "{}",
+	} {
+		b, err := os.ReadFile(filepath.Join(base, f))
+		if err != nil {
+			t.Error(err)
+			continue
+		}
+		if string(b) != expected {
+			t.Errorf("%s: unexpected content %q", f, b)
+		}
+	}
+	b, err := os.ReadFile(filepath.Join(base, "IMG_001.jpg.reason.txt"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, s := range []string{"Source:  takeout-001.zip", "Reason:  upload error\n", "Reason:  upload error on the replica", "With:    Google Photos/Trip/IMG_001.jpg.json"} {
+		if !strings.Contains(string(b), s) {
+			t.Errorf("the reason file should contain %q\n%s", s, b)
+		}
+	}
+}
+
+func TestDestination(t *testing.T) {
+	dir := t.TempDir()
+	q, err := New(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tc := []struct {
+		source string
+		name   string
+		want   string
+	}{
+		{source: "takeout-001.zip", name: "Trip/IMG_001.jpg", want: filepath.Join("takeout-001.zip", "Trip", "IMG_001.jpg")},
+		{source: "", name: "IMG_001.jpg", want: filepath.Join("unknown source", "IMG_001.jpg")},
+		{source: ".", name: "IMG_001.jpg", want: filepath.Join("unknown source", "IMG_001.jpg")},
+		{source: "..", name: "IMG_001.jpg", want: filepath.Join("unknown source", "IMG_001.jpg")},
+		{source: "/", name: "IMG_001.jpg", want: filepath.Join("_", "IMG_001.jpg")},
+		{source: "../../etc", name: "IMG_001.jpg", want: filepath.Join(".._.._etc", "IMG_001.jpg")},
+		{source: `C:\photos`, name: "IMG_001.jpg", want: filepath.Join("C__photos", "IMG_001.jpg")},
+		{source: "photos", name: "../../IMG_001.jpg", want: filepath.Join("photos", "IMG_001.jpg")},
+	}
+	for _, c := range tc {
+		t.Run(c.source+"|"+c.name, func(t *testing.T) {
+			got, err := q.destination(fshelper.NewFSWithName(fstest.MapFS{}, c.source), c.name)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if want := filepath.Join(dir, c.want); got != want {
+				t.Errorf("expecting %s, got %s", want, got)
+			}
+		})
+	}
+}
@@ -0,0 +1,426 @@
+// Package rules routes the assets with a declarative rules file.
+//
+// The rules file is a JSON or a YAML document listing rules. Each rule has conditions
+// and actions. All the conditions of a rule must be met to apply its actions.
+// All the matching rules are applied in the order of the file, until a rule
+// with "stop" is matched.
+//
+//	{
+//	  "rules": [
+//	    {
+//	      "name": "screenshots",
+//	      "if": { "name": "Screenshot*", "gps": false },
+//	      "then": { "archive": true, "add-tag": "screenshot" }
+//	    },
+//	    {
+//	      "name": "whatsapp",
+//	      "if": { "path": "WhatsApp" },
+//	      "then": { "add-album": "WhatsApp" },
+//	      "stop": true
+//	    }
+//	  ]
+//	}
+//
+// The same rules in YAML, in a file named .yaml or .yml:
+//
+//	rules:
+//	  - name: screenshots
+//	    if: { name: "Screenshot*", gps: false }
+//	    then: { archive: true, add-tag: screenshot }
+//	  - name: whatsapp
+//	    if: { path: WhatsApp }
+//	    then: { add-album: WhatsApp }
+//	    stop: true
+package rules
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/simulot/immich-go/helpers/namematcher"
+	"gopkg.in/yaml.v3"
+)
+
+// Set is the list of rules read from a rules file
+type Set struct {
+	Rules []*Rule `json:"rules" yaml:"rules"`
+}
+
+// Rule applies its actions to the assets matching all its conditions
+type Rule struct {
+	Name string    `json:"name" yaml:"name"`
+	If   Condition `json:"if" yaml:"if"`
+	Then Actions   `json:"then" yaml:"then"`
+	Stop bool      `json:"stop" yaml:"stop"` // don't evaluate the next rules when this one is matched
+}
+
+// Condition lists the criteria of a rule. Omitted criteria are ignored.
+type Condition struct {
+	Name     List   `json:"name" yaml:"name"`         // glob patterns on the file name
+	Path     List   `json:"path" yaml:"path"`         // glob patterns on the file path
+	Regex    string `json:"regex" yaml:"regex"`       // regular expression on the file path
+	Ext      List   `json:"ext" yaml:"ext"`           // file extensions
+	After    Date   `json:"after" yaml:"after"`       // captured at or after this date
+	Before   Date   `json:"before" yaml:"before"`     // captured before this date
+	Camera   List   `json:"camera" yaml:"camera"`     // glob patterns on the camera's make and model
+	GPS      *bool  `json:"gps" yaml:"gps"`           // the asset has a GPS position
+	Favorite *bool  `json:"favorite" yaml:"favorite"` // Google Photos flags
+	Archived *bool  `json:"archived" yaml:"archived"`
+	Trashed  *bool  `json:"trashed" yaml:"trashed"`
+	Partner  *bool  `json:"partner" yaml:"partner"`
+	MinSize  Size   `json:"min-size" yaml:"min-size"` // file size, as 1500000 or "1.5MB"
+	MaxSize  Size   `json:"max-size" yaml:"max-size"`
+
+	name   namematcher.List
+	path   namematcher.List
+	re     *regexp.Regexp
+	camera namematcher.List
+}
+
+// Actions lists what to do with the matching assets
+type Actions struct {
+	Skip        bool    `json:"skip" yaml:"skip"`
+	Archive     bool    `json:"archive" yaml:"archive"`
+	Favorite    bool    `json:"favorite" yaml:"favorite"`
+	Albums      List    `json:"add-album" yaml:"add-album"`
+	Tags        List    `json:"add-tag" yaml:"add-tag"`
+	Description *string `json:"set-description" yaml:"set-description"`
+	StackWith   string  `json:"stack-with" yaml:"stack-with"` // assets with the same expanded value are stacked together
+}
+
+// Facts describes the asset evaluated by the rules.
+// The camera and the GPS position are read only when a rule needs them.
+type Facts struct {
+	Name     string // file path
+	Size     int64
+	Date     time.Time // date of capture
+	Favorite bool
+	Archived bool
+	Trashed  bool
+	Partner  bool
+	Camera   func() string // camera's make and model
+	GPS      func() bool
+}
+
+// Result is the merge of the actions of the matched rules
+type Result struct {
+	Matched     []string // names of the matched rules
+	Skip        bool
+	Archive     bool
+	Favorite    bool
+	Albums      []string
+	Tags        []string
+	Description *string
+	StackWith   string
+}
+
+// Load reads and checks the rules file
+func Load(name string) (*Set, error) {
+	b, err := os.ReadFile(name)
+	if err != nil {
+		return nil, err
+	}
+	var s *Set
+	switch strings.ToLower(filepath.Ext(name)) {
+	case ".yaml", ".yml":
+		s, err = ParseYAML(b)
+	default:
+		s, err = Parse(b)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("rules file %s: %w", name, err)
+	}
+	return s, nil
+}
+
+// Parse decodes and checks the JSON rules
+func Parse(b []byte) (*Set, error) {
+	s := Set{}
+	dec := json.NewDecoder(bytes.NewReader(b))
+	dec.DisallowUnknownFields()
+	err := dec.Decode(&s)
+	if err != nil {
+		return nil, err
+	}
+	return s.check()
+}
+
+// ParseYAML decodes and checks the YAML rules
+func ParseYAML(b []byte) (*Set, error) {
+	s := Set{}
+	dec := yaml.NewDecoder(bytes.NewReader(b))
+	dec.KnownFields(true)
+	err := dec.Decode(&s)
+	if err != nil {
+		return nil, err
+	}
+	return s.check()
+}
+
+// check names the anonymous rules and compiles their conditions
+func (s *Set) check() (*Set, error) {
+	var err error
+	for i, r := range s.Rules {
+		if r.Name == "" {
+			r.Name = "#" + strconv.Itoa(i+1)
+		}
+		err = r.If.compile()
+		if err != nil {
+			return nil, fmt.Errorf("rule %s: %w", r.Name, err)
+		}
+	}
+	return s, nil
+}
+
+func (c *Condition) compile() error {
+	var err error
+	if c.name, err = namematcher.New(c.Name...); err != nil {
+		return err
+	}
+	if c.path, err = namematcher.New(c.Path...); err != nil {
+		return err
+	}
+	if c.camera, err = namematcher.New(c.Camera...); err != nil {
+		return err
+	}
+	if c.Regex != "" {
+		if c.re, err = regexp.Compile(c.Regex); err != nil {
+			return err
+		}
+	}
+	for i, e := range c.Ext {
+		e = strings.ToLower(e)
+		if !strings.HasPrefix(e, ".") {
+			e = "." + e
+		}
+		c.Ext[i] = e
+	}
+	return nil
+}
+
+// Evaluate applies the rules to the asset
+func (s *Set) Evaluate(f Facts) Result {
+	res := Result{}
+	for _, r := range s.Rules {
+		if !r.If.match(f) {
+			continue
+		}
+		res.Matched = append(res.Matched, r.Name)
+		res.Skip = res.Skip || r.Then.Skip
+		res.Archive = res.Archive || r.Then.Archive
+		res.Favorite = res.Favorite || r.Then.Favorite
+		res.Albums = appendNew(res.Albums, r.Then.Albums...)
+		res.Tags = appendNew(res.Tags, r.Then.Tags...)
+		if r.Then.Description != nil {
+			res.Description = r.Then.Description
+		}
+		if r.Then.StackWith != "" {
+			res.StackWith = expand(r.Then.StackWith, f)
+		}
+		if r.Stop {
+			break
+		}
+	}
+	return res
+}
+
+func (c *Condition) match(f Facts) bool {
+	if len(c.Name) > 0 && !c.name.Match(path.Base(f.Name)) {
+		return false
+	}
+	if len(c.Path) > 0 && !c.path.Match(f.Name) {
+		return false
+	}
+	if c.re != nil && !c.re.MatchString(f.Name) {
+		return false
+	}
+	if len(c.Ext) > 0 && !contains(c.Ext, strings.ToLower(path.Ext(f.Name))) {
+		return false
+	}
+	if !c.After.IsZero() && (f.Date.IsZero() || f.Date.Before(c.After.Time)) {
+		return false
+	}
+	if !c.Before.IsZero() && (f.Date.IsZero() || !f.Date.Before(c.Before.Time)) {
+		return false
+	}
+	if c.MinSize > 0 && f.Size < int64(c.MinSize) {
+		return false
+	}
+	if c.MaxSize > 0 && f.Size > int64(c.MaxSize) {
+		return false
+	}
+	if !matchFlag(c.Favorite, f.Favorite) || !matchFlag(c.Archived, f.Archived) ||
+		!matchFlag(c.Trashed, f.Trashed) || !matchFlag(c.Partner, f.Partner) {
+		return false
+	}
+	// The costly conditions are evaluated last
+	if c.GPS != nil && (f.GPS == nil || f.GPS() != *c.GPS) {
+		return false
+	}
+	if len(c.Camera) > 0 && (f.Camera == nil || !c.camera.Match(f.Camera())) {
+		return false
+	}
+	return true
+}
+
+func matchFlag(want *bool, got bool) bool {
+	return want == nil || *want == got
+}
+
+// expand replaces the placeholders {dir}, {name}, {ext} and {date} of a stack-with value
+func expand(s string, f Facts) string {
+	base := path.Base(f.Name)
+	ext := path.Ext(base)
+	date := ""
+	if !f.Date.IsZero() {
+		date = f.Date.Format("2006-01-02")
+	}
+	return strings.NewReplacer(
+		"{dir}", path.Dir(f.Name),
+		"{name}", strings.TrimSuffix(base, ext),
+		"{ext}", ext,
+		"{date}", date,
+	).Replace(s)
+}
+
+func contains(l []string, s string) bool {
+	for _, e := range l {
+		if e == s {
+			return true
+		}
+	}
+	return false
+}
+
+func appendNew(l []string, values ...string) []string {
+	for _, v := range values {
+		if !contains(l, v) {
+			l = append(l, v)
+		}
+	}
+	return l
+}
+
+// List is a list of strings, given as a string or a list of strings
+type List []string
+
+func (l *List) UnmarshalJSON(b []byte) error {
+	var s string
+	if err := json.Unmarshal(b, &s); err == nil {
+		*l = List{s}
+		return nil
+	}
+	var a []string
+	if err := json.Unmarshal(b, &a); err != nil {
+		return errors.New("expecting a string or a list of strings")
+	}
+	*l = a
+	return nil
+}
+
+func (l *List) UnmarshalYAML(n *yaml.Node) error {
+	switch n.Kind {
+	case yaml.ScalarNode:
+		*l = List{n.Value}
+		return nil
+	case yaml.SequenceNode:
+		var a []string
+		if err := n.Decode(&a); err == nil {
+			*l = a
+			return nil
+		}
+	}
+	return errors.New("expecting a string or a list of strings")
+}
+
+// Date is given as 2006-01-02, 2006-01-02T15:04:05 or RFC3339. Dates without time zone are in local time.
+type Date struct {
+	time.Time
+}
+
+func (d *Date) UnmarshalJSON(b []byte) error {
+	var s string
+	if err := json.Unmarshal(b, &s); err != nil {
+		return err
+	}
+	return d.parse(s)
+}
+
+func (d *Date) UnmarshalYAML(n *yaml.Node) error {
+	if n.Kind != yaml.ScalarNode {
+		return errors.New("expecting a date")
+	}
+	return d.parse(n.Value)
+}
+
+func (d *Date) parse(s string) error {
+	for _, layout := range []string{time.RFC3339, "2006-01-02T15:04:05", "2006-01-02"} {
+		t, err := time.ParseInLocation(layout, s, time.Local)
+		if err == nil {
+			d.Time = t
+			return nil
+		}
+	}
+	return fmt.Errorf("invalid date %q, expecting YYYY-MM-DD", s)
+}
+
+// Size is a number of bytes, given as a number or a string with a unit as "500KB", "1.5MB" or "2GB"
+type Size int64
+
+var sizeUnits = []struct {
+	suffix string
+	factor float64
+}{
+	{"KB", 1e3}, {"MB", 1e6}, {"GB", 1e9}, {"TB", 1e12}, {"B", 1},
+}
+
+func (z *Size) UnmarshalJSON(b []byte) error {
+	var n int64
+	if err := json.Unmarshal(b, &n); err == nil {
+		*z = Size(n)
+		return nil
+	}
+	var s string
+	if err := json.Unmarshal(b, &s); err != nil {
+		return err
+	}
+	v, err := ParseSize(s)
+	*z = v
+	return err
+}
+
+func (z *Size) UnmarshalYAML(n *yaml.Node) error {
+	if n.Kind != yaml.ScalarNode {
+		return errors.New("expecting a size")
+	}
+	v, err := ParseSize(n.Value)
+	*z = v
+	return err
+}
+
+// ParseSize decodes a size as "1500000", "500KB", "1.5MB" or "2GB"
+func ParseSize(s string) (Size, error) {
+	t := strings.ToUpper(strings.TrimSpace(s))
+	factor := 1.0
+	for _, u := range sizeUnits {
+		if strings.HasSuffix(t, u.suffix) {
+			t = strings.TrimSpace(strings.TrimSuffix(t, u.suffix))
+			factor = u.factor
+			break
+		}
+	}
+	f, err := strconv.ParseFloat(t, 64)
+	if err != nil || f < 0 {
+		return 0, fmt.Errorf("invalid size %q", s)
+	}
+	return Size(f * factor), nil
+}
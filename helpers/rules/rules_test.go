@@ -0,0 +1,169 @@
+package rules
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+const testRules = `{
+  "rules": [
+    {
+      "name": "screenshots",
+      "if": { "name": "Screenshot*", "gps": false },
+      "then": { "archive": true, "add-tag": "screenshot" }
+    },
+    {
+      "name": "whatsapp",
+      "if": { "path": "WhatsApp/", "ext": ["jpg", ".MP4"] },
+      "then": { "add-album": ["WhatsApp"], "set-description": "from WhatsApp" },
+      "stop": true
+    },
+    {
+      "name": "2023",
+      "if": { "after": "2023-01-01", "before": "2024-01-01", "max-size": "2MB" },
+      "then": { "add-album": "2023", "stack-with": "{dir}/{date}" }
+    },
+    {
+      "name": "pixel",
+      "if": { "camera": "Google Pixel*" },
+      "then": { "favorite": true }
+    },
+    {
+      "if": { "favorite": true, "min-size": 1000 },
+      "then": { "skip": true }
+    }
+  ]
+}`
+
+const testRulesYAML = `
+rules:
+  - name: screenshots
+    if: { name: "Screenshot*", gps: false }
+    then: { archive: true, add-tag: screenshot }
+  - name: whatsapp
+    if:
+      path: WhatsApp/
+      ext: [jpg, .MP4]
+    then:
+      add-album: [WhatsApp]
+      set-description: from WhatsApp
+    stop: true
+  - name: "2023"
+    if: { after: 2023-01-01, before: 2024-01-01, max-size: 2MB }
+    then: { add-album: "2023", stack-with: "{dir}/{date}" }
+  - name: pixel
+    if: { camera: Google Pixel* }
+    then: { favorite: true }
+  - if: { favorite: true, min-size: 1000 }
+    then: { skip: true }
+`
+
+func TestEvaluate(t *testing.T) {
+	dir := t.TempDir()
+	for _, f := range []struct {
+		name    string
+		content string
+	}{
+		{"rules.json", testRules},
+		{"rules.yaml", testRulesYAML},
+		{"rules.yml", testRulesYAML},
+	} {
+		name := filepath.Join(dir, f.name)
+		err := os.WriteFile(name, []byte(f.content), 0o644)
+		if err != nil {
+			t.Fatal(err)
+		}
+		s, err := Load(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		t.Run(f.name, func(t *testing.T) {
+			testEvaluate(t, s)
+		})
+	}
+}
+
+func testEvaluate(t *testing.T, s *Set) {
+	noGPS := func() bool { return false }
+	pixel := func() string { return "Google Pixel 5" }
+	desc := "from WhatsApp"
+
+	tc := []struct {
+		name  string
+		facts Facts
+		want  Result
+	}{
+		{
+			name:  "screenshot",
+			facts: Facts{Name: "phone/Screenshot_20230315.png", Size: 3e6, Date: time.Date(2023, 3, 15, 0, 0, 0, 0, time.Local), GPS: noGPS},
+			want:  Result{Matched: []string{"screenshots"}, Archive: true, Tags: []string{"screenshot"}},
+		},
+		{
+			name:  "whatsapp stops",
+			facts: Facts{Name: "WhatsApp/Media/IMG-20230101.jpg", Size: 1e5, Date: time.Date(2023, 1, 1, 0, 0, 0, 0, time.Local), GPS: noGPS},
+			want:  Result{Matched: []string{"whatsapp"}, Albums: []string{"WhatsApp"}, Description: &desc},
+		},
+		{
+			name:  "whatsapp wrong extension",
+			facts: Facts{Name: "WhatsApp/Media/voice.opus", Size: 1e5, Date: time.Date(2022, 1, 1, 0, 0, 0, 0, time.Local)},
+			want:  Result{},
+		},
+		{
+			name:  "2023 pixel",
+			facts: Facts{Name: "phone/PXL_20230315.jpg", Size: 1e6, Date: time.Date(2023, 3, 15, 10, 0, 0, 0, time.Local), Camera: pixel},
+			want:  Result{Matched: []string{"2023", "pixel"}, Favorite: true, Albums: []string{"2023"}, StackWith: "phone/2023-03-15"},
+		},
+		{
+			name:  "favorite skipped",
+			facts: Facts{Name: "takeout/photo.jpg", Size: 5e6, Favorite: true},
+			want:  Result{Matched: []string{"#5"}, Skip: true},
+		},
+	}
+
+	for _, c := range tc {
+		t.Run(c.name, func(t *testing.T) {
+			got := s.Evaluate(c.facts)
+			if !reflect.DeepEqual(got, c.want) {
+				t.Errorf("got %+v, want %+v", got, c.want)
+			}
+		})
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+	for _, s := range []string{
+		`{"rules":[{"if":{"regex":"("}}]}`,
+		`{"rules":[{"if":{"after":"yesterday"}}]}`,
+		`{"rules":[{"if":{"min-size":"big"}}]}`,
+		`{"rules":[{"if":{"color":"red"}}]}`,
+	} {
+		_, err := Parse([]byte(s))
+		if err == nil {
+			t.Errorf("expecting an error for %s", s)
+		}
+	}
+	for _, s := range []string{
+		"rules:\n  - if: { regex: \"(\" }",
+		"rules:\n  - if: { after: yesterday }",
+		"rules:\n  - if: { min-size: big }",
+		"rules:\n  - if: { color: red }",
+		"rules:\n  - if: { name: { glob: \"*\" } }",
+	} {
+		_, err := ParseYAML([]byte(s))
+		if err == nil {
+			t.Errorf("expecting an error for %s", s)
+		}
+	}
+}
+
+func TestParseSize(t *testing.T) {
+	for s, want := range map[string]Size{"1500": 1500, "500KB": 5e5, "1.5mb": 1.5e6, "2 GB": 2e9, "10B": 10} {
+		got, err := ParseSize(s)
+		if err != nil || got != want {
+			t.Errorf("ParseSize(%q) = %d, %v, want %d", s, got, err, want)
+		}
+	}
+}
@@ -9,6 +9,7 @@ import (
 	"time"
 
 	"github.com/simulot/immich-go/helpers/gen"
+	"github.com/simulot/immich-go/helpers/namenorm"
 	"github.com/simulot/immich-go/immich"
 )
 
@@ -30,24 +31,34 @@ type StackType int
 const (
 	StackRawJpg StackType = iota
 	StackBurst
+	StackAppleEdit
 )
 
 type StackBuilder struct {
 	dateRange      immich.DateRange // Set capture date range
 	stacks         map[Key]Stack
+	editCovers     map[Key]bool // stacks covered by an Apple's edit
 	supportedMedia immich.SupportedMedia
+	names          namenorm.Normalizer // compares the base names of the stacks
 }
 
 func NewStackBuilder(supportedMedia immich.SupportedMedia) *StackBuilder {
 	sb := StackBuilder{
 		supportedMedia: supportedMedia,
 		stacks:         map[Key]Stack{},
+		editCovers:     map[Key]bool{},
 	}
 	_ = sb.dateRange.Set("1850-01-04,2030-01-01")
 
 	return &sb
 }
 
+// SetNameNormalizer sets how the base names of the stacks are compared
+func (sb *StackBuilder) SetNameNormalizer(n namenorm.Normalizer) *StackBuilder {
+	sb.names = n
+	return sb
+}
+
 func (sb *StackBuilder) ProcessAsset(id string, fileName string, captureDate time.Time) {
 	if !sb.dateRange.InRange(captureDate) {
 		return
@@ -76,9 +87,18 @@ func (sb *StackBuilder) ProcessAsset(id string, fileName string, captureDate tim
 		}
 	}
 
+	// Apple's edit IMG_E1234.JPG of IMG_1234.HEIC
+	appleEdit := false
+	if !burst {
+		if parts := AppleEditRE.FindStringSubmatch(base); len(parts) > 0 {
+			base = parts[1] + parts[2]
+			appleEdit = true
+		}
+	}
+
 	k := Key{
 		date:     captureDate.Round(time.Minute),
-		baseName: base,
+		baseName: sb.names.Key(base),
 	}
 	s, ok := sb.stacks[k]
 	if !ok {
@@ -90,14 +110,22 @@ func (sb *StackBuilder) ProcessAsset(id string, fileName string, captureDate tim
 	if burst {
 		s.StackType = StackBurst
 	}
-	if cover {
+	switch {
+	case appleEdit:
+		s.StackType = StackAppleEdit
 		s.CoverID = id
-	} else if !burst && slices.Contains([]string{".jpeg", ".jpg", ".jpe"}, ext) {
+		sb.editCovers[k] = true
+	case cover:
+		s.CoverID = id
+	case !burst && !sb.editCovers[k] && slices.Contains([]string{".jpeg", ".jpg", ".jpe"}, ext):
 		s.CoverID = id
 	}
 	sb.stacks[k] = s
 }
 
+// AppleEditRE matches the name without extension of an Apple's edit: IMG_E1234
+var AppleEditRE = regexp.MustCompile(`(?i)^(IMG_)E(\d+)$`)
+
 // stackMatcher analyze the name and return
 // bool -> true when name is a part of burst
 // string -> base name of the burst
@@ -100,6 +100,31 @@ func Test_Stack(t *testing.T) {
 				},
 			},
 		},
+		{
+			name: "stack Apple edit",
+			input: []asset{
+				{ID: "1", FileName: "IMG_E1234.JPG", DateTaken: metadata.TakeTimeFromName("2023-10-01 10.15.00")},
+				{ID: "2", FileName: "IMG_1234.JPG", DateTaken: metadata.TakeTimeFromName("2023-10-01 10.15.00")},
+				{ID: "3", FileName: "IMG_1235.HEIC", DateTaken: metadata.TakeTimeFromName("2023-10-01 10.16.00")},
+				{ID: "4", FileName: "IMG_E1235.jpg", DateTaken: metadata.TakeTimeFromName("2023-10-01 10.16.00")},
+			},
+			want: []Stack{
+				{
+					CoverID:   "1",
+					IDs:       []string{"2"},
+					Date:      metadata.TakeTimeFromName("2023-10-01 10.15.00"),
+					Names:     []string{"IMG_E1234.JPG", "IMG_1234.JPG"},
+					StackType: StackAppleEdit,
+				},
+				{
+					CoverID:   "4",
+					IDs:       []string{"3"},
+					Date:      metadata.TakeTimeFromName("2023-10-01 10.16.00"),
+					Names:     []string{"IMG_1235.HEIC", "IMG_E1235.jpg"},
+					StackType: StackAppleEdit,
+				},
+			},
+		},
 		{
 			name: "issue #12 example1",
 			input: []asset{
@@ -139,6 +139,18 @@ func (ic *ImmichClient) GetAssetAlbums(ctx context.Context, id string) ([]AlbumS
 	return r, err
 }
 
+// AlbumInfoUpdate gives the album's properties to change, the empty ones are left unchanged
+type AlbumInfoUpdate struct {
+	AlbumThumbnailAssetID string `json:"albumThumbnailAssetId,omitempty"`
+	Order                 string `json:"order,omitempty"` // asc or desc
+}
+
+// UpdateAlbumInfo changes the cover or the sort order of the album
+func (ic *ImmichClient) UpdateAlbumInfo(ctx context.Context, id string, update AlbumInfoUpdate) error {
+	return ic.newServerCall(ctx, EndPointUpdateAlbumInfo).do(
+		patchRequest("/albums/"+id, setAcceptJSON(), setJSONBody(update)))
+}
+
 func (ic *ImmichClient) DeleteAlbum(ctx context.Context, id string) error {
 	return ic.newServerCall(ctx, EndPointDeleteAlbum).do(deleteRequest("/albums/" + id))
 }
@@ -38,9 +38,9 @@ func formatDuration(duration time.Duration) string {
 	seconds := duration / time.Second
 	duration -= seconds * time.Second
 
-	milliseconds := duration / time.Millisecond
+	microseconds := duration / time.Microsecond
 
-	return fmt.Sprintf("%02d:%02d:%02d.%06d", hours, minutes, seconds, milliseconds)
+	return fmt.Sprintf("%02d:%02d:%02d.%06d", hours, minutes, seconds, microseconds)
 }
 
 func (ic *ImmichClient) AssetUpload(ctx context.Context, la *browser.LocalAssetFile) (AssetResponse, error) {
@@ -80,11 +80,19 @@ func (ic *ImmichClient) AssetUpload(ctx context.Context, la *browser.LocalAssetF
 			return
 		}
 
-		err = m.WriteField("deviceAssetId", fmt.Sprintf("%s-%d", path.Base(la.Title), s.Size()))
+		deviceAssetID := fmt.Sprintf("%s-%d", path.Base(la.Title), s.Size())
+		if la.Checksum != "" {
+			deviceAssetID = la.DeviceAssetID()
+		}
+		err = m.WriteField("deviceAssetId", deviceAssetID)
 		if err != nil {
 			return
 		}
-		err = m.WriteField("deviceId", ic.DeviceUUID)
+		deviceID := ic.DeviceUUID
+		if la.DeviceID != "" {
+			deviceID = la.DeviceID
+		}
+		err = m.WriteField("deviceId", deviceID)
 		if err != nil {
 			return
 		}
@@ -108,7 +116,7 @@ func (ic *ImmichClient) AssetUpload(ctx context.Context, la *browser.LocalAssetF
 		if err != nil {
 			return
 		}
-		err = m.WriteField("duration", formatDuration(0))
+		err = m.WriteField("duration", formatDuration(la.Metadata.Duration))
 		if err != nil {
 			return
 		}
@@ -0,0 +1,22 @@
+package immich
+
+import (
+	"testing"
+	"time"
+)
+
+func TestFormatDuration(t *testing.T) {
+	tests := []struct {
+		d    time.Duration
+		want string
+	}{
+		{0, "00:00:00.000000"},
+		{1500 * time.Millisecond, "00:00:01.500000"},
+		{time.Hour + 2*time.Minute + 3*time.Second + 4*time.Microsecond, "01:02:03.000004"},
+	}
+	for _, tt := range tests {
+		if got := formatDuration(tt.d); got != tt.want {
+			t.Errorf("formatDuration(%s) = %q, want %q", tt.d, got, tt.want)
+		}
+	}
+}
@@ -23,12 +23,15 @@ const (
 	EndPointCreateAlbum            = "CreateAlbum"
 	EndPointGetAssetAlbums         = "GetAssetAlbums"
 	EndPointDeleteAlbum            = "DeleteAlbum"
+	EndPointUpdateAlbumInfo        = "UpdateAlbumInfo"
 	EndPointPingServer             = "PingServer"
 	EndPointValidateConnection     = "ValidateConnection"
 	EndPointGetServerStatistics    = "GetServerStatistics"
 	EndPointGetAssetStatistics     = "GetAssetStatistics"
 	EndPointGetSupportedMediaTypes = "GetSupportedMediaTypes"
 	EndPointGetAllAssets           = "GetAllAssets"
+	EndPointUpsertTags             = "UpsertTags"
+	EndPointTagAssets              = "TagAssets"
 )
 
 type TooManyInternalError struct {
@@ -181,6 +184,15 @@ func deleteRequest(url string, opts ...serverRequestOption) requestFunction {
 	}
 }
 
+func patchRequest(url string, opts ...serverRequestOption) requestFunction {
+	return func(sc *serverCall) *http.Request {
+		if sc.err != nil {
+			return nil
+		}
+		return sc.request(http.MethodPatch, sc.ic.endPoint+url, opts...)
+	}
+}
+
 func putRequest(url string, opts ...serverRequestOption) requestFunction {
 	return func(sc *serverCall) *http.Request {
 		if sc.err != nil {
@@ -0,0 +1,337 @@
+package immich
+
+import (
+	"context"
+	"path"
+	"sync"
+
+	"github.com/google/uuid"
+	"github.com/simulot/immich-go/browser"
+)
+
+// DryRunClient simulates the changes on the server.
+//
+// The reads are forwarded to the wrapped client, the changes are kept in memory:
+// the uploaded assets get an ID, the created albums can be listed and
+// receive assets, the deleted assets and albums disappear from the lists.
+// The server isn't changed.
+type DryRunClient struct {
+	ImmichInterface // the actual client
+
+	lock          sync.Mutex
+	assets        map[string]*Asset          // simulated uploads, by ID
+	albums        map[string]AlbumSimplified // simulated albums, by ID
+	albumAssets   map[string][]string        // assets added to the albums, by album's ID
+	deletedAssets map[string]bool
+	deletedAlbums map[string]bool
+	tags          map[string]TagSimplified // simulated tags, by value
+	stacks        map[string][]string      // simulated stacks, by cover's ID
+}
+
+var _ ImmichInterface = (*DryRunClient)(nil)
+
+// NewDryRunClient wraps the client to simulate the changes
+func NewDryRunClient(ic ImmichInterface) *DryRunClient {
+	if d, ok := ic.(*DryRunClient); ok {
+		return d
+	}
+	return &DryRunClient{
+		ImmichInterface: ic,
+		assets:          map[string]*Asset{},
+		albums:          map[string]AlbumSimplified{},
+		albumAssets:     map[string][]string{},
+		deletedAssets:   map[string]bool{},
+		deletedAlbums:   map[string]bool{},
+		tags:            map[string]TagSimplified{},
+		stacks:          map[string][]string{},
+	}
+}
+
+// AssetUpload simulates the upload of the asset, and gives it a new ID
+func (d *DryRunClient) AssetUpload(ctx context.Context, la *browser.LocalAssetFile) (AssetResponse, error) {
+	if err := ctx.Err(); err != nil {
+		return AssetResponse{}, err
+	}
+	d.lock.Lock()
+	defer d.lock.Unlock()
+
+	a := &Asset{
+		ID:               uuid.NewString(),
+		DeviceAssetID:    la.DeviceAssetID(),
+		DeviceID:         la.DeviceID,
+		Checksum:         la.Checksum,
+		OriginalFileName: path.Base(la.Title),
+		FileCreatedAt:    ImmichTime{la.Metadata.DateTaken},
+		FileModifiedAt:   ImmichTime{la.ModTime()},
+		IsFavorite:       la.Favorite,
+		IsArchived:       la.Archived,
+		LivePhotoVideoID: la.LivePhotoID,
+		Duration:         formatDuration(la.Metadata.Duration),
+		JustUploaded:     true,
+	}
+	a.ExifInfo.FileSizeInByte = la.FileSize
+	a.ExifInfo.Description = la.Metadata.Description
+	d.assets[a.ID] = a
+	return AssetResponse{ID: a.ID, Status: UploadCreated}, nil
+}
+
+// GetAllAssets gives the server's assets, with the simulated changes
+func (d *DryRunClient) GetAllAssets(ctx context.Context) ([]*Asset, error) {
+	list := []*Asset{}
+	err := d.GetAllAssetsWithFilter(ctx, func(a *Asset) error {
+		list = append(list, a)
+		return nil
+	})
+	return list, err
+}
+
+// GetAllAssetsWithFilter gives the server's assets, with the simulated changes
+func (d *DryRunClient) GetAllAssetsWithFilter(ctx context.Context, filter func(*Asset) error) error {
+	err := d.ImmichInterface.GetAllAssetsWithFilter(ctx, func(a *Asset) error {
+		if d.isDeletedAsset(a.ID) {
+			return nil
+		}
+		return filter(a)
+	})
+	if err != nil {
+		return err
+	}
+	for _, a := range d.uploadedAssets() {
+		if err = filter(a); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (d *DryRunClient) isDeletedAsset(id string) bool {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+	return d.deletedAssets[id]
+}
+
+func (d *DryRunClient) uploadedAssets() []*Asset {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+	list := []*Asset{}
+	for id, a := range d.assets {
+		if !d.deletedAssets[id] {
+			list = append(list, a)
+		}
+	}
+	return list
+}
+
+// UpdateAsset simulates the update of the asset's metadata
+func (d *DryRunClient) UpdateAsset(ctx context.Context, id string, la *browser.LocalAssetFile) (*Asset, error) {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+	a, ok := d.assets[id]
+	if !ok {
+		a = &Asset{ID: id}
+	}
+	a.IsFavorite = la.Favorite
+	a.IsArchived = la.Archived
+	a.ExifInfo.Description = la.Metadata.Description
+	return a, nil
+}
+
+// UpdateAssets simulates the update of the assets
+func (d *DryRunClient) UpdateAssets(ctx context.Context, ids []string, isArchived bool, isFavorite bool, latitude float64, longitude float64, removeParent bool, stackParentID string) error {
+	return nil
+}
+
+// DeleteAssets simulates the deletion of the assets
+func (d *DryRunClient) DeleteAssets(ctx context.Context, ids []string, force bool) error {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+	for _, id := range ids {
+		d.deletedAssets[id] = true
+	}
+	return nil
+}
+
+// GetAllAlbums gives the server's albums, with the simulated changes
+func (d *DryRunClient) GetAllAlbums(ctx context.Context) ([]AlbumSimplified, error) {
+	albums, err := d.ImmichInterface.GetAllAlbums(ctx)
+	if err != nil {
+		return nil, err
+	}
+	d.lock.Lock()
+	defer d.lock.Unlock()
+	list := []AlbumSimplified{}
+	for _, al := range albums {
+		if !d.deletedAlbums[al.ID] {
+			list = append(list, al)
+		}
+	}
+	for id, al := range d.albums {
+		if !d.deletedAlbums[id] {
+			list = append(list, al)
+		}
+	}
+	return list, nil
+}
+
+// GetAlbumInfo gives the album, with the simulated changes
+func (d *DryRunClient) GetAlbumInfo(ctx context.Context, id string, withoutAssets bool) (AlbumContent, error) {
+	d.lock.Lock()
+	al, simulated := d.albums[id]
+	added := append([]string{}, d.albumAssets[id]...)
+	d.lock.Unlock()
+
+	var content AlbumContent
+	if simulated {
+		content = AlbumContent{ID: al.ID, AlbumName: al.AlbumName, Description: al.Description}
+	} else {
+		var err error
+		content, err = d.ImmichInterface.GetAlbumInfo(ctx, id, withoutAssets)
+		if err != nil {
+			return content, err
+		}
+	}
+	if !withoutAssets {
+		for _, a := range added {
+			content.Assets = append(content.Assets, AssetSimplified{ID: a})
+		}
+	}
+	return content, nil
+}
+
+// CreateAlbum simulates the creation of the album
+func (d *DryRunClient) CreateAlbum(ctx context.Context, title string, description string, ids []string) (AlbumSimplified, error) {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+	al := AlbumSimplified{
+		ID:          uuid.NewString(),
+		AlbumName:   title,
+		Description: description,
+	}
+	d.albums[al.ID] = al
+	d.albumAssets[al.ID] = append([]string{}, ids...)
+	return al, nil
+}
+
+// AddAssetToAlbum simulates the addition of the assets to the album
+func (d *DryRunClient) AddAssetToAlbum(ctx context.Context, albumID string, ids []string) ([]UpdateAlbumResult, error) {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+	results := []UpdateAlbumResult{}
+	for _, id := range ids {
+		d.albumAssets[albumID] = append(d.albumAssets[albumID], id)
+		results = append(results, UpdateAlbumResult{ID: id, Success: true})
+	}
+	return results, nil
+}
+
+// GetAssetAlbums gives the albums of the asset, with the simulated changes
+func (d *DryRunClient) GetAssetAlbums(ctx context.Context, id string) ([]AlbumSimplified, error) {
+	d.lock.Lock()
+	_, simulated := d.assets[id]
+	d.lock.Unlock()
+
+	list := []AlbumSimplified{}
+	if !simulated {
+		albums, err := d.ImmichInterface.GetAssetAlbums(ctx, id)
+		if err != nil {
+			return nil, err
+		}
+		list = append(list, albums...)
+	}
+
+	d.lock.Lock()
+	defer d.lock.Unlock()
+	list = filterAlbums(list, d.deletedAlbums)
+	for albumID, ids := range d.albumAssets {
+		if d.deletedAlbums[albumID] {
+			continue
+		}
+		for _, a := range ids {
+			if a != id {
+				continue
+			}
+			if al, ok := d.albums[albumID]; ok {
+				list = append(list, al)
+			} else {
+				list = append(list, AlbumSimplified{ID: albumID})
+			}
+			break
+		}
+	}
+	return list, nil
+}
+
+func filterAlbums(albums []AlbumSimplified, deleted map[string]bool) []AlbumSimplified {
+	list := albums[:0]
+	for _, al := range albums {
+		if !deleted[al.ID] {
+			list = append(list, al)
+		}
+	}
+	return list
+}
+
+// DeleteAlbum simulates the deletion of the album
+func (d *DryRunClient) DeleteAlbum(ctx context.Context, id string) error {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+	d.deletedAlbums[id] = true
+	return nil
+}
+
+// UpdateAlbumInfo simulates the change of the album's cover or order
+func (d *DryRunClient) UpdateAlbumInfo(ctx context.Context, id string, update AlbumInfoUpdate) error {
+	return nil
+}
+
+// StackAssets simulates the stack
+func (d *DryRunClient) StackAssets(ctx context.Context, cover string, ids []string) error {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+	d.stacks[cover] = append([]string{}, ids...)
+	for _, id := range ids {
+		if a, ok := d.assets[id]; ok && id != cover {
+			a.StackParentID = cover
+		}
+	}
+	return nil
+}
+
+// UpsertTags simulates the creation of the tags
+func (d *DryRunClient) UpsertTags(ctx context.Context, tags []string) ([]TagSimplified, error) {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+	list := []TagSimplified{}
+	for _, value := range tags {
+		t, ok := d.tags[value]
+		if !ok {
+			t = TagSimplified{ID: uuid.NewString(), Name: path.Base(value), Value: value}
+			d.tags[value] = t
+		}
+		list = append(list, t)
+	}
+	return list, nil
+}
+
+// TagAssets simulates the tagging of the assets
+func (d *DryRunClient) TagAssets(ctx context.Context, tagIDs []string, assetIDs []string) error {
+	return nil
+}
+
+// Stacks gives the simulated stacks, by cover's ID
+func (d *DryRunClient) Stacks() map[string][]string {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+	stacks := map[string][]string{}
+	for k, v := range d.stacks {
+		stacks[k] = append([]string{}, v...)
+	}
+	return stacks
+}
+
+// Uploaded gives the number of simulated uploads
+func (d *DryRunClient) Uploaded() int {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+	return len(d.assets)
+}
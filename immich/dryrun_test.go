@@ -0,0 +1,79 @@
+package immich_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/simulot/immich-go/browser"
+	"github.com/simulot/immich-go/immich"
+	fakeimmich "github.com/simulot/immich-go/internal/fakeImmich"
+)
+
+func TestDryRunClient(t *testing.T) {
+	ctx := context.Background()
+	d := immich.NewDryRunClient(&fakeimmich.MockedCLient{})
+	if immich.NewDryRunClient(d) != d {
+		t.Error("the dry-run client shouldn't be wrapped twice")
+	}
+
+	resp, err := d.AssetUpload(ctx, &browser.LocalAssetFile{FileName: "photo.jpg", Title: "photo.jpg", FileSize: 100})
+	if err != nil || resp.ID == "" {
+		t.Fatalf("the upload should be simulated: %v", err)
+	}
+	assets, err := d.GetAllAssets(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(assets) != 1 || assets[0].ID != resp.ID || assets[0].OriginalFileName != "photo.jpg" {
+		t.Errorf("the uploaded asset should be listed, got %v", assets)
+	}
+
+	al, err := d.CreateAlbum(ctx, "Holidays", "", []string{resp.ID})
+	if err != nil || al.ID == "" {
+		t.Fatalf("the album creation should be simulated: %v", err)
+	}
+	albums, err := d.GetAllAlbums(ctx)
+	if err != nil || len(albums) != 1 || albums[0].AlbumName != "Holidays" {
+		t.Errorf("the album should be listed, got %v, %v", albums, err)
+	}
+	albums, err = d.GetAssetAlbums(ctx, resp.ID)
+	if err != nil || len(albums) != 1 || albums[0].ID != al.ID {
+		t.Errorf("the asset should be in the album, got %v, %v", albums, err)
+	}
+	content, err := d.GetAlbumInfo(ctx, al.ID, false)
+	if err != nil || len(content.Assets) != 1 || content.Assets[0].ID != resp.ID {
+		t.Errorf("the album should contain the asset, got %v, %v", content, err)
+	}
+
+	second, _ := d.AssetUpload(ctx, &browser.LocalAssetFile{FileName: "photo.cr3", Title: "photo.cr3"})
+	err = d.StackAssets(ctx, resp.ID, []string{resp.ID, second.ID})
+	if err != nil || len(d.Stacks()[resp.ID]) != 2 {
+		t.Errorf("the stack should be simulated, got %v, %v", d.Stacks(), err)
+	}
+
+	tags, err := d.UpsertTags(ctx, []string{"Places/Paris"})
+	if err != nil || len(tags) != 1 || tags[0].Name != "Paris" {
+		t.Errorf("the tags should be simulated, got %v, %v", tags, err)
+	}
+	again, _ := d.UpsertTags(ctx, []string{"Places/Paris"})
+	if again[0].ID != tags[0].ID {
+		t.Error("a tag should keep its ID")
+	}
+
+	err = d.DeleteAssets(ctx, []string{resp.ID}, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = d.DeleteAlbum(ctx, al.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assets, _ = d.GetAllAssets(ctx)
+	if len(assets) != 1 || assets[0].ID != second.ID {
+		t.Errorf("the deleted asset shouldn't be listed, got %v", assets)
+	}
+	albums, _ = d.GetAllAlbums(ctx)
+	if len(albums) != 0 {
+		t.Errorf("the deleted album shouldn't be listed, got %v", albums)
+	}
+}
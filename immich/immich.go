@@ -36,9 +36,13 @@ type ImmichInterface interface {
 	CreateAlbum(ctx context.Context, tilte string, description string, ids []string) (AlbumSimplified, error)
 	GetAssetAlbums(ctx context.Context, ID string) ([]AlbumSimplified, error)
 	DeleteAlbum(ctx context.Context, id string) error
+	UpdateAlbumInfo(ctx context.Context, id string, update AlbumInfoUpdate) error
 
 	StackAssets(ctx context.Context, cover string, IDs []string) error
 
+	UpsertTags(ctx context.Context, tags []string) ([]TagSimplified, error)
+	TagAssets(ctx context.Context, tagIDs []string, assetIDs []string) error
+
 	SupportedMedia() SupportedMedia
 	GetJobs(ctx context.Context) (map[string]Job, error)
 }
@@ -74,6 +78,8 @@ type User struct {
 	DeletedAt            time.Time `json:"deletedAt"`
 	UpdatedAt            time.Time `json:"updatedAt"`
 	OauthID              string    `json:"oauthId"`
+	QuotaSizeInBytes     *int64    `json:"quotaSizeInBytes"`  // nil when the user has no quota
+	QuotaUsageInBytes    int64     `json:"quotaUsageInBytes"` // storage used by the user
 }
 
 type List[T comparable] struct {
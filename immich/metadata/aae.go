@@ -0,0 +1,122 @@
+package metadata
+
+import (
+	"bytes"
+	"compress/flate"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"slices"
+	"strings"
+	"time"
+)
+
+/*
+	The AAE files are written by the iPhone next to an edited photo.
+	They are property lists giving the editor and the adjustments applied to the original:
+
+	<plist version="1.0">
+	<dict>
+		<key>adjustmentData</key>
+		<data>...</data>
+		<key>adjustmentEditorBundleID</key>
+		<string>com.apple.mobileslideshow</string>
+		<key>adjustmentFormatIdentifier</key>
+		<string>com.apple.photo</string>
+		...
+	</dict>
+	</plist>
+
+	The adjustment data are a deflated JSON document listing the operations.
+*/
+
+// AppleAdjustments are the edits described by an AAE file
+type AppleAdjustments struct {
+	FormatIdentifier string
+	FormatVersion    string
+	Editor           string    // bundle ID of the editing application
+	Timestamp        time.Time // date of the edit
+	Operations       []string  // adjustments applied to the original, when they can be decoded
+}
+
+// ReadAAE reads the AAE file
+func ReadAAE(r io.Reader) (AppleAdjustments, error) {
+	var plist struct {
+		Dict struct {
+			Items []struct {
+				XMLName xml.Name
+				Value   string `xml:",chardata"`
+			} `xml:",any"`
+		} `xml:"dict"`
+	}
+	err := xml.NewDecoder(r).Decode(&plist)
+	if err != nil {
+		return AppleAdjustments{}, fmt.Errorf("can't read the AAE file: %w", err)
+	}
+
+	adj := AppleAdjustments{}
+	key := ""
+	for _, item := range plist.Dict.Items {
+		if item.XMLName.Local == "key" {
+			key = item.Value
+			continue
+		}
+		value := strings.TrimSpace(item.Value)
+		switch key {
+		case "adjustmentFormatIdentifier":
+			adj.FormatIdentifier = value
+		case "adjustmentFormatVersion":
+			adj.FormatVersion = value
+		case "adjustmentEditorBundleID":
+			adj.Editor = value
+		case "adjustmentTimestamp":
+			adj.Timestamp, _ = time.Parse(time.RFC3339, value)
+		case "adjustmentData":
+			// the data are opaque for some editors
+			adj.Operations, _ = decodeAdjustmentData(value)
+		}
+		key = ""
+	}
+	if adj.FormatIdentifier == "" {
+		return AppleAdjustments{}, fmt.Errorf("can't read the AAE file: no adjustment format")
+	}
+	return adj, nil
+}
+
+// decodeAdjustmentData gives the identifiers of the operations
+func decodeAdjustmentData(data string) ([]string, error) {
+	b, err := base64.StdEncoding.DecodeString(strings.Join(strings.Fields(data), ""))
+	if err != nil {
+		return nil, err
+	}
+	b, err = io.ReadAll(flate.NewReader(bytes.NewReader(b)))
+	if err != nil {
+		return nil, err
+	}
+	var doc struct {
+		Adjustments []struct {
+			Identifier string `json:"identifier"`
+		} `json:"adjustments"`
+	}
+	err = json.Unmarshal(b, &doc)
+	if err != nil {
+		return nil, err
+	}
+	ops := []string{}
+	for _, a := range doc.Adjustments {
+		if a.Identifier != "" && !slices.Contains(ops, a.Identifier) {
+			ops = append(ops, a.Identifier)
+		}
+	}
+	return ops, nil
+}
+
+// Description summarizes the adjustments for the asset's description
+func (adj AppleAdjustments) Description() string {
+	if len(adj.Operations) > 0 {
+		return "Apple edits: " + strings.Join(adj.Operations, ", ")
+	}
+	return strings.TrimSpace("Apple edits: " + adj.FormatIdentifier + " " + adj.FormatVersion)
+}
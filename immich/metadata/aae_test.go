@@ -0,0 +1,93 @@
+package metadata
+
+import (
+	"bytes"
+	"compress/flate"
+	"encoding/base64"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func aaeFile(data string) string {
+	return `<?xml version="1.0" encoding="UTF-8"?>
+<!DOCTYPE plist PUBLIC "-//Apple//DTD PLIST 1.0//EN" "http://www.apple.com/DTDs/PropertyList-1.0.dtd">
+<plist version="1.0">
+<dict>
+	<key>adjustmentBaseVersion</key>
+	<integer>0</integer>
+	<key>adjustmentData</key>
+	<data>
+	` + data + `
+	</data>
+	<key>adjustmentEditorBundleID</key>
+	<string>com.apple.mobileslideshow</string>
+	<key>adjustmentFormatIdentifier</key>
+	<string>com.apple.photo</string>
+	<key>adjustmentFormatVersion</key>
+	<string>1.4</string>
+	<key>adjustmentTimestamp</key>
+	<date>2023-08-01T12:30:00Z</date>
+</dict>
+</plist>
+`
+}
+
+func deflated(t *testing.T, s string) string {
+	var b bytes.Buffer
+	w, err := flate.NewWriter(&b, flate.BestCompression)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, _ = w.Write([]byte(s))
+	_ = w.Close()
+	return base64.StdEncoding.EncodeToString(b.Bytes())
+}
+
+func TestReadAAE(t *testing.T) {
+	ops := deflated(t, `{"metadata":{"orientation":1},"adjustments":[{"identifier":"Crop","settings":{}},{"identifier":"SmartTone","settings":{}},{"identifier":"Crop","settings":{}}],"formatVersion":1}`)
+	tc := []struct {
+		name        string
+		aae         string
+		operations  []string
+		description string
+	}{
+		{
+			name:        "operations",
+			aae:         aaeFile(ops),
+			operations:  []string{"Crop", "SmartTone"},
+			description: "Apple edits: Crop, SmartTone",
+		},
+		{
+			name:        "opaque data",
+			aae:         aaeFile("YnBsaXN0MDA="),
+			description: "Apple edits: com.apple.photo 1.4",
+		},
+	}
+	for _, c := range tc {
+		t.Run(c.name, func(t *testing.T) {
+			adj, err := ReadAAE(strings.NewReader(c.aae))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if adj.Editor != "com.apple.mobileslideshow" || adj.FormatIdentifier != "com.apple.photo" || adj.FormatVersion != "1.4" {
+				t.Errorf("unexpected adjustments %+v", adj)
+			}
+			if !adj.Timestamp.Equal(time.Date(2023, 8, 1, 12, 30, 0, 0, time.UTC)) {
+				t.Errorf("expecting the edit's date, got %s", adj.Timestamp)
+			}
+			if !reflect.DeepEqual(adj.Operations, c.operations) {
+				t.Errorf("expecting the operations %v, got %v", c.operations, adj.Operations)
+			}
+			if d := adj.Description(); d != c.description {
+				t.Errorf("expecting the description %q, got %q", c.description, d)
+			}
+		})
+	}
+
+	_, err := ReadAAE(strings.NewReader("<plist><dict></dict></plist>"))
+	if err == nil {
+		t.Error("expecting an error for a file without adjustments")
+	}
+}
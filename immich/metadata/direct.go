@@ -6,7 +6,6 @@ import (
 	"io/fs"
 	"path"
 	"strings"
-	"time"
 )
 
 func GetFileMetaData(fsys fs.FS, name string) (Metadata, error) {
@@ -30,78 +29,96 @@ func GetFromReader(rd io.Reader, ext string) (Metadata, error) {
 	r := newSliceReader(rd)
 	meta := Metadata{}
 	var err error
-	var dateTaken time.Time
 	switch strings.ToLower(ext) {
 	case ".heic", ".heif":
-		dateTaken, err = readHEIFDateTaken(r)
+		meta, err = readHEIFMetadata(r)
 	case ".jpg", ".jpeg", ".dng", ".cr2":
-		dateTaken, err = readExifDateTaken(r)
-	case ".mp4", ".mov":
-		dateTaken, err = readMP4DateTaken(r)
+		meta, err = getExifFromReader(r)
+	case ".mp4", ".mov", ".3gp", ".m4v":
+		meta, err = readMP4Metadata(r)
 	case ".cr3":
-		dateTaken, err = readCR3DateTaken(r)
+		meta, err = readCR3Metadata(r)
 	default:
 		err = fmt.Errorf("can't determine the taken date from metadata (%s)", ext)
 	}
-	meta.DateTaken = dateTaken
 	return meta, err
 }
 
-// readExifDateTaken pase the file for Exif DateTaken
-func readExifDateTaken(r io.Reader) (time.Time, error) {
-	md, err := getExifFromReader(r)
-	return md.DateTaken, err
-}
-
-const searchBufferSize = 32 * 1024
+const (
+	searchBufferSize = 32 * 1024
+	trackSearchLimit = 1024 * 1024
+)
 
-// readHEIFDateTaken locate the Exif part and return the date of capture
-func readHEIFDateTaken(r *sliceReader) (time.Time, error) {
+// readHEIFMetadata locate the Exif part and return the date of capture and the GPS position
+func readHEIFMetadata(r *sliceReader) (Metadata, error) {
 	b := make([]byte, searchBufferSize)
 	r, err := searchPattern(r, []byte{0x45, 0x78, 0x69, 0x66, 0, 0, 0x4d, 0x4d}, b)
 	if err != nil {
-		return time.Time{}, err
+		return Metadata{}, err
 	}
 
 	filler := make([]byte, 6)
 	_, err = r.Read(filler)
 	if err != nil {
-		return time.Time{}, err
+		return Metadata{}, err
 	}
 
-	md, err := getExifFromReader(r)
-	return md.DateTaken, err
+	return getExifFromReader(r)
 }
 
-// readMP4DateTaken locate the mvhd atom and decode the date of capture
-func readMP4DateTaken(r *sliceReader) (time.Time, error) {
+// readMP4Metadata locate the mvhd atom to get the date of capture and the duration,
+// then the tkhd atom of the video track to get its rotation
+func readMP4Metadata(r *sliceReader) (Metadata, error) {
 	b := make([]byte, searchBufferSize)
 
 	r, err := searchPattern(r, []byte{'m', 'v', 'h', 'd'}, b)
 	if err != nil {
-		return time.Time{}, err
+		return Metadata{}, err
 	}
 	atom, err := decodeMvhdAtom(r)
 	if err != nil {
-		return time.Time{}, err
+		return Metadata{}, err
+	}
+	meta := Metadata{
+		DateTaken: atom.CreationTime,
+		Duration:  atom.MovieDuration(),
+	}
+
+	// The tracks follow the mvhd atom, the audio tracks have no dimensions.
+	// The search is limited to avoid reading the whole media when the track isn't found.
+	tracks := newSliceReader(io.LimitReader(r, trackSearchLimit))
+	for {
+		r, err = searchPattern(tracks, []byte{'t', 'k', 'h', 'd'}, make([]byte, searchBufferSize))
+		if err != nil {
+			break
+		}
+		track, err := decodeTkhdAtom(r)
+		if err != nil {
+			break
+		}
+		if track.Width > 0 && track.Height > 0 {
+			meta.Width, meta.Height = int(track.Width), int(track.Height)
+			meta.Rotation = track.Rotation
+			break
+		}
+		tracks = r
 	}
-	return atom.CreationTime, nil
+	return meta, nil
 }
 
-func readCR3DateTaken(r *sliceReader) (time.Time, error) {
+func readCR3Metadata(r *sliceReader) (Metadata, error) {
 	b := make([]byte, searchBufferSize)
 
 	r, err := searchPattern(r, []byte("CMT1"), b)
 	if err != nil {
-		return time.Time{}, err
+		return Metadata{}, err
 	}
 
 	filler := make([]byte, 4)
 	_, err = r.Read(filler)
 	if err != nil {
-		return time.Time{}, err
+		return Metadata{}, err
 	}
 
-	md, err := getExifFromReader(r)
-	return md.DateTaken, err
+	return getExifFromReader(r)
 }
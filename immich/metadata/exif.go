@@ -38,9 +38,36 @@ func getExifFromReader(r io.Reader) (Metadata, error) {
 		}
 	}
 
+	if lat, lon, e := x.LatLong(); e == nil {
+		md.Latitude, md.Longitude = lat, lon
+	}
+	md.Width = getTagInt(x, exif.PixelXDimension, exif.ImageWidth)
+	md.Height = getTagInt(x, exif.PixelYDimension, exif.ImageLength)
+	if tag, e := getTagSting(x, exif.Make); e == nil {
+		md.Make = strings.TrimSpace(tag)
+	}
+	if tag, e := getTagSting(x, exif.Model); e == nil {
+		md.Model = strings.TrimSpace(tag)
+	}
+
 	return md, err
 }
 
+// getTagInt gives the first integer value of the first available tag, or 0
+func getTagInt(x *exif.Exif, tagNames ...exif.FieldName) int {
+	for _, n := range tagNames {
+		t, err := x.Get(n)
+		if err != nil || t.Count == 0 {
+			continue
+		}
+		v, err := t.Int(0)
+		if err == nil && v > 0 {
+			return v
+		}
+	}
+	return 0
+}
+
 func getTagSting(x *exif.Exif, tagName exif.FieldName) (string, error) {
 	t, err := x.Get(tagName)
 	if err != nil {
@@ -14,6 +14,12 @@ type Metadata struct {
 	Latitude    float64
 	Longitude   float64
 	Altitude    float64
+	Make        string // camera's maker, read from the EXIF
+	Model       string // camera's model, read from the EXIF
+	Width       int    // image's dimensions, read from the EXIF
+	Height      int
+	Duration    time.Duration // video's duration, read from the mvhd atom
+	Rotation    int           // video's clockwise rotation in degrees, read from the tkhd atom
 }
 
 func (m Metadata) IsSet() bool {
@@ -61,6 +67,17 @@ func (m Metadata) Write(w io.Writer) error {
 			if err != nil {
 				return err
 			}
+			if m.Altitude != 0 {
+				ref := 0
+				alt := m.Altitude
+				if alt < 0 {
+					ref, alt = 1, -alt
+				}
+				_, err = fmt.Fprintf(w, exifGPSAltitude, alt, ref)
+				if err != nil {
+					return err
+				}
+			}
 		}
 		_, err = io.WriteString(w, exifFooter)
 		if err != nil {
@@ -100,7 +117,8 @@ const (
 
 	exifDateTimeOriginal = `  <exif:DateTimeOriginal>%s</exif:DateTimeOriginal>
 `
-	exifGPSAltitude = `  <exif:GPSAltitude>0</exif:GPSAltitude>
+	exifGPSAltitude = `  <exif:GPSAltitude>%f</exif:GPSAltitude>
+  <exif:GPSAltitudeRef>%d</exif:GPSAltitudeRef>
 `
 	exifGPSLatitude = `  <exif:GPSLatitude>%f</exif:GPSLatitude>
 `
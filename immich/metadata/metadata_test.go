@@ -11,6 +11,7 @@ func TestMetadata_String(t *testing.T) {
 		DateTaken   time.Time
 		Latitude    float64
 		Longitude   float64
+		Altitude    float64
 	}
 	tests := []struct {
 		name   string
@@ -71,6 +72,28 @@ func TestMetadata_String(t *testing.T) {
  </rdf:Description>
 </rdf:RDF>
 </x:xmpmeta>
+<?xpacket end='w'?>`,
+		},
+		{
+			name: "GPSWithAltitude",
+			fields: fields{
+				Latitude:  71.1652089,
+				Longitude: 25.7909877,
+				Altitude:  -12.5,
+			},
+			want: `<?xpacket begin='?' id='W5M0MpCehiHzreSzNTczkc9d'?>
+<x:xmpmeta xmlns:x='adobe:ns:meta/' x:xmptk='Image::ExifTool 12.40'>
+<rdf:RDF xmlns:rdf='http://www.w3.org/1999/02/22-rdf-syntax-ns#'>
+ <rdf:Description rdf:about=''
+  xmlns:exif='http://ns.adobe.com/exif/1.0/'>
+  <exif:ExifVersion>0220</exif:ExifVersion>  <exif:GPSLatitude>71.165209</exif:GPSLatitude>
+  <exif:GPSLongitude>25.790988</exif:GPSLongitude>
+  <exif:GPSAltitude>12.500000</exif:GPSAltitude>
+  <exif:GPSAltitudeRef>1</exif:GPSAltitudeRef>
+  <exif:GPSVersionID>2.3.0.0</exif:GPSVersionID>
+ </rdf:Description>
+</rdf:RDF>
+</x:xmpmeta>
 <?xpacket end='w'?>`,
 		},
 		{
@@ -111,6 +134,7 @@ func TestMetadata_String(t *testing.T) {
 				DateTaken:   tt.fields.DateTaken,
 				Latitude:    tt.fields.Latitude,
 				Longitude:   tt.fields.Longitude,
+				Altitude:    tt.fields.Altitude,
 			}
 			if got := m.String(); got != tt.want {
 				t.Errorf("Meta.String() = %v, want %v", got, tt.want)
@@ -2,6 +2,8 @@ package metadata
 
 import (
 	"encoding/binary"
+	"io"
+	"math"
 	"time"
 )
 
@@ -38,9 +40,9 @@ type MvhdAtom struct {
 	Flags            []byte // 3 bytes
 	CreationTime     time.Time
 	ModificationTime time.Time
+	Timescale        uint32 // time units per second
+	Duration         uint64 // in time scale units
 	// ignored fields:
-	// Timescale        uint32
-	// Duration         uint32
 	// Rate             float32
 	// Volume           float32
 	// Matrix           [9]int32
@@ -95,9 +97,97 @@ func decodeMvhdAtom(r *sliceReader) (*MvhdAtom, error) {
 		a.CreationTime = convertTime64(binary.BigEndian.Uint64(b))
 	}
 
+	b, err := readFull(r, 4)
+	if err != nil {
+		return nil, err
+	}
+	a.Timescale = binary.BigEndian.Uint32(b)
+	if a.Version == 0 {
+		b, err = readFull(r, 4)
+		if err != nil {
+			return nil, err
+		}
+		a.Duration = uint64(binary.BigEndian.Uint32(b))
+	} else {
+		b, err = readFull(r, 8)
+		if err != nil {
+			return nil, err
+		}
+		a.Duration = binary.BigEndian.Uint64(b)
+	}
 	return a, nil
 }
 
+// MovieDuration gives the duration of the movie
+func (a *MvhdAtom) MovieDuration() time.Duration {
+	if a.Timescale == 0 {
+		return 0
+	}
+	return time.Duration(float64(a.Duration) / float64(a.Timescale) * float64(time.Second))
+}
+
+/*
+The tkhd atom describes a track. Its matrix gives the transformation applied to the
+track when it is rendered, the video recorded by a phone held in portrait is rotated with it.
+The width and the height are fixed point numbers 16.16, they are 0 for an audio track.
+*/
+
+type TkhdAtom struct {
+	Version  uint8
+	Matrix   [9]int32
+	Width    float64
+	Height   float64
+	Rotation int // clockwise, in degrees: 0, 90, 180 or 270
+}
+
+func decodeTkhdAtom(r *sliceReader) (*TkhdAtom, error) {
+	a := &TkhdAtom{}
+
+	// marker, version and flags
+	b, err := readFull(r, 8)
+	if err != nil {
+		return nil, err
+	}
+	a.Version = b[4]
+
+	// creation time, modification time, track ID, reserved, duration
+	skip := 4 + 4 + 4 + 4 + 4
+	if a.Version == 1 {
+		skip = 8 + 8 + 4 + 4 + 8
+	}
+	// reserved, layer, alternate group, volume, reserved
+	skip += 8 + 2 + 2 + 2 + 2
+	_, err = readFull(r, skip)
+	if err != nil {
+		return nil, err
+	}
+
+	b, err = readFull(r, 9*4+4+4)
+	if err != nil {
+		return nil, err
+	}
+	for i := range a.Matrix {
+		a.Matrix[i] = int32(binary.BigEndian.Uint32(b[i*4:]))
+	}
+	a.Width = float64(binary.BigEndian.Uint32(b[36:])) / 65536
+	a.Height = float64(binary.BigEndian.Uint32(b[40:])) / 65536
+	a.Rotation = matrixRotation(a.Matrix)
+	return a, nil
+}
+
+// matrixRotation gives the rotation of the matrix {a, b, u, c, d, v, x, y, w}, rounded to a quarter turn
+func matrixRotation(m [9]int32) int {
+	deg := math.Atan2(float64(m[1]), float64(m[0])) * 180 / math.Pi
+	rot := int(math.Round(deg/90)) * 90
+	return (rot + 360) % 360
+}
+
+func readFull(r *sliceReader, l int) ([]byte, error) {
+	b := make([]byte, l)
+	_, err := io.ReadFull(r, b)
+	return b, err
+}
+
 func convertTime32(timestamp uint32) time.Time {
 	return time.Unix(int64(timestamp)-int64(2082844800), 0)
 }
@@ -0,0 +1,74 @@
+package metadata
+
+import (
+	"bytes"
+	"encoding/binary"
+	"testing"
+	"time"
+)
+
+// box makes an atom with its size and its type
+func box(typ string, content ...[]byte) []byte {
+	b := bytes.Join(content, nil)
+	h := binary.BigEndian.AppendUint32(nil, uint32(8+len(b)))
+	return append(append(h, typ...), b...)
+}
+
+func mvhd(timescale, duration uint32) []byte {
+	b := make([]byte, 4+4+4+4+4+80)
+	binary.BigEndian.PutUint32(b[12:], timescale)
+	binary.BigEndian.PutUint32(b[16:], duration)
+	return box("mvhd", b)
+}
+
+func tkhd(matrix [9]int32, width, height uint32) []byte {
+	b := make([]byte, 4+20+16+36+8)
+	for i, v := range matrix {
+		binary.BigEndian.PutUint32(b[40+i*4:], uint32(v))
+	}
+	binary.BigEndian.PutUint32(b[76:], width<<16)
+	binary.BigEndian.PutUint32(b[80:], height<<16)
+	return box("tkhd", b)
+}
+
+func TestReadMP4Metadata(t *testing.T) {
+	const one = 1 << 16
+	identity := [9]int32{one, 0, 0, 0, one, 0, 0, 0, 1 << 30}
+	tests := []struct {
+		name     string
+		matrix   [9]int32
+		rotation int
+	}{
+		{name: "landscape", matrix: identity, rotation: 0},
+		{name: "portrait", matrix: [9]int32{0, one, 0, -one, 0, 0, 0, 0, 1 << 30}, rotation: 90},
+		{name: "upside down", matrix: [9]int32{-one, 0, 0, 0, -one, 0, 0, 0, 1 << 30}, rotation: 180},
+		{name: "portrait reversed", matrix: [9]int32{0, -one, 0, one, 0, 0, 0, 0, 1 << 30}, rotation: 270},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			file := bytes.Join([][]byte{
+				box("ftyp", []byte("isom")),
+				box("moov",
+					mvhd(600, 9300),
+					box("trak", tkhd(identity, 0, 0)), // the audio track comes first
+					box("trak", tkhd(tt.matrix, 1920, 1080)),
+				),
+				box("mdat", make([]byte, 1000)),
+			}, nil)
+
+			m, err := GetFromReader(bytes.NewReader(file), ".MOV")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if m.Duration != 15500*time.Millisecond {
+				t.Errorf("expecting a duration of 15.5s, got %s", m.Duration)
+			}
+			if m.Rotation != tt.rotation {
+				t.Errorf("expecting a rotation of %d, got %d", tt.rotation, m.Rotation)
+			}
+			if m.Width != 1920 || m.Height != 1080 {
+				t.Errorf("expecting the dimensions of the video track, got %dx%d", m.Width, m.Height)
+			}
+		})
+	}
+}
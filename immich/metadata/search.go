@@ -38,7 +38,7 @@ func searchPattern(r io.Reader, pattern []byte, buffer []byte) (*sliceReader, er
 		// Search for the pattern within the buffer
 		index := bytes.Index(buffer[:ofs+bytesRead], pattern)
 		if index >= 0 {
-			return newSliceReader(io.MultiReader(bytes.NewReader(buffer[index:]), r)), nil
+			return newSliceReader(io.MultiReader(bytes.NewReader(buffer[index:ofs+bytesRead]), r)), nil
 		}
 
 		// Move the remaining bytes of the current buffer to the beginning
@@ -0,0 +1,277 @@
+package immich
+
+import (
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"time"
+
+	"github.com/simulot/immich-go/browser"
+)
+
+// snapshotVersion is the version of the snapshot file format
+const snapshotVersion = 1
+
+// Snapshot is the state of the server saved for an offline analysis
+type Snapshot struct {
+	Version          int                 `json:"version"`
+	Server           string              `json:"server"`
+	Date             time.Time           `json:"date"`
+	User             User                `json:"user"`
+	AssetStatistics  UserStatistics      `json:"assetStatistics"`
+	ServerStatistics *ServerStatistics   `json:"serverStatistics,omitempty"` // available to admins only
+	SupportedMedia   SupportedMedia      `json:"supportedMedia"`
+	Albums           []AlbumSimplified   `json:"albums"`
+	AlbumAssets      map[string][]string `json:"albumAssets"` // assets' IDs by album's ID
+	Assets           []*Asset            `json:"assets"`
+}
+
+// TakeSnapshot reads the state of the server
+func TakeSnapshot(ctx context.Context, ic ImmichInterface, server string) (*Snapshot, error) {
+	var err error
+	s := Snapshot{
+		Version:        snapshotVersion,
+		Server:         server,
+		Date:           time.Now(),
+		SupportedMedia: ic.SupportedMedia(),
+		AlbumAssets:    map[string][]string{},
+	}
+	s.User, err = ic.ValidateConnection(ctx)
+	if err != nil {
+		return nil, err
+	}
+	s.AssetStatistics, err = ic.GetAssetStatistics(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if stats, err := ic.GetServerStatistics(ctx); err == nil {
+		s.ServerStatistics = &stats
+	}
+	s.Assets, err = ic.GetAllAssets(ctx)
+	if err != nil {
+		return nil, err
+	}
+	s.Albums, err = ic.GetAllAlbums(ctx)
+	if err != nil {
+		return nil, err
+	}
+	for _, al := range s.Albums {
+		content, err := ic.GetAlbumInfo(ctx, al.ID, false)
+		if err != nil {
+			return nil, fmt.Errorf("can't get the album %s: %w", al.AlbumName, err)
+		}
+		ids := []string{}
+		for _, a := range content.Assets {
+			ids = append(ids, a.ID)
+		}
+		s.AlbumAssets[al.ID] = ids
+	}
+	return &s, nil
+}
+
+// Write the snapshot as gzipped JSON
+func (s *Snapshot) Write(w io.Writer) error {
+	gz := gzip.NewWriter(w)
+	err := json.NewEncoder(gz).Encode(s)
+	if err != nil {
+		return err
+	}
+	return gz.Close()
+}
+
+// Save writes the snapshot into the file
+func (s *Snapshot) Save(name string) error {
+	f, err := os.Create(name)
+	if err != nil {
+		return err
+	}
+	err = s.Write(f)
+	return errors.Join(err, f.Close())
+}
+
+// ReadSnapshot decodes a snapshot written by Write
+func ReadSnapshot(r io.Reader) (*Snapshot, error) {
+	gz, err := gzip.NewReader(r)
+	if err != nil {
+		return nil, err
+	}
+	defer gz.Close()
+	s := Snapshot{}
+	err = json.NewDecoder(gz).Decode(&s)
+	if err != nil {
+		return nil, err
+	}
+	if s.Version != snapshotVersion {
+		return nil, fmt.Errorf("unsupported snapshot version %d", s.Version)
+	}
+	return &s, nil
+}
+
+// LoadSnapshot reads the snapshot file
+func LoadSnapshot(name string) (*Snapshot, error) {
+	f, err := os.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	s, err := ReadSnapshot(f)
+	if err != nil {
+		return nil, fmt.Errorf("can't read the server snapshot %s: %w", name, err)
+	}
+	return s, nil
+}
+
+// ErrOffline is returned when a change is requested to the snapshot's client
+var ErrOffline = errors.New("the server snapshot can't be changed, use -dry-run")
+
+// SnapshotClient answers the reads with the snapshot of a server.
+// The changes are refused, wrap it with NewDryRunClient to simulate them.
+type SnapshotClient struct {
+	snap        *Snapshot
+	assetAlbums map[string][]AlbumSimplified // albums by asset's ID
+}
+
+var _ ImmichInterface = (*SnapshotClient)(nil)
+
+// NewSnapshotClient gives a client reading the snapshot
+func NewSnapshotClient(s *Snapshot) *SnapshotClient {
+	c := SnapshotClient{
+		snap:        s,
+		assetAlbums: map[string][]AlbumSimplified{},
+	}
+	for _, al := range s.Albums {
+		for _, id := range s.AlbumAssets[al.ID] {
+			c.assetAlbums[id] = append(c.assetAlbums[id], al)
+		}
+	}
+	return &c
+}
+
+func (c *SnapshotClient) SetEndPoint(string)         {}
+func (c *SnapshotClient) EnableAppTrace(w io.Writer) {}
+func (c *SnapshotClient) SetDeviceUUID(string)       {}
+
+func (c *SnapshotClient) PingServer(ctx context.Context) error {
+	return nil
+}
+
+func (c *SnapshotClient) ValidateConnection(ctx context.Context) (User, error) {
+	return c.snap.User, nil
+}
+
+func (c *SnapshotClient) GetServerStatistics(ctx context.Context) (ServerStatistics, error) {
+	if c.snap.ServerStatistics == nil {
+		return ServerStatistics{}, errors.New("the server statistics aren't in the snapshot")
+	}
+	return *c.snap.ServerStatistics, nil
+}
+
+func (c *SnapshotClient) GetAssetStatistics(ctx context.Context) (UserStatistics, error) {
+	return c.snap.AssetStatistics, nil
+}
+
+func (c *SnapshotClient) GetAllAssets(ctx context.Context) ([]*Asset, error) {
+	list := []*Asset{}
+	err := c.GetAllAssetsWithFilter(ctx, func(a *Asset) error {
+		list = append(list, a)
+		return nil
+	})
+	return list, err
+}
+
+func (c *SnapshotClient) GetAllAssetsWithFilter(ctx context.Context, filter func(*Asset) error) error {
+	for _, a := range c.snap.Assets {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		// give a copy, the snapshot remains untouched
+		b := *a
+		if err := filter(&b); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (c *SnapshotClient) GetAllAlbums(ctx context.Context) ([]AlbumSimplified, error) {
+	return append([]AlbumSimplified{}, c.snap.Albums...), nil
+}
+
+func (c *SnapshotClient) GetAlbumInfo(ctx context.Context, id string, withoutAssets bool) (AlbumContent, error) {
+	for _, al := range c.snap.Albums {
+		if al.ID != id {
+			continue
+		}
+		content := AlbumContent{ID: al.ID, AlbumName: al.AlbumName, Description: al.Description}
+		if !withoutAssets {
+			for _, a := range c.snap.AlbumAssets[id] {
+				content.Assets = append(content.Assets, AssetSimplified{ID: a})
+			}
+		}
+		return content, nil
+	}
+	return AlbumContent{}, fmt.Errorf("album %s not found in the snapshot", id)
+}
+
+func (c *SnapshotClient) GetAssetAlbums(ctx context.Context, id string) ([]AlbumSimplified, error) {
+	return append([]AlbumSimplified{}, c.assetAlbums[id]...), nil
+}
+
+func (c *SnapshotClient) SupportedMedia() SupportedMedia {
+	if c.snap.SupportedMedia == nil {
+		return DefaultSupportedMedia
+	}
+	return c.snap.SupportedMedia
+}
+
+func (c *SnapshotClient) GetJobs(ctx context.Context) (map[string]Job, error) {
+	return nil, ErrOffline
+}
+
+func (c *SnapshotClient) UpdateAsset(ctx context.Context, id string, a *browser.LocalAssetFile) (*Asset, error) {
+	return nil, ErrOffline
+}
+
+func (c *SnapshotClient) AddAssetToAlbum(ctx context.Context, albumID string, ids []string) ([]UpdateAlbumResult, error) {
+	return nil, ErrOffline
+}
+
+func (c *SnapshotClient) UpdateAssets(ctx context.Context, ids []string, isArchived bool, isFavorite bool, latitude float64, longitude float64, removeParent bool, stackParentID string) error {
+	return ErrOffline
+}
+
+func (c *SnapshotClient) AssetUpload(ctx context.Context, a *browser.LocalAssetFile) (AssetResponse, error) {
+	return AssetResponse{}, ErrOffline
+}
+
+func (c *SnapshotClient) DeleteAssets(ctx context.Context, ids []string, force bool) error {
+	return ErrOffline
+}
+
+func (c *SnapshotClient) CreateAlbum(ctx context.Context, title string, description string, ids []string) (AlbumSimplified, error) {
+	return AlbumSimplified{}, ErrOffline
+}
+
+func (c *SnapshotClient) DeleteAlbum(ctx context.Context, id string) error {
+	return ErrOffline
+}
+
+func (c *SnapshotClient) UpdateAlbumInfo(ctx context.Context, id string, update AlbumInfoUpdate) error {
+	return ErrOffline
+}
+
+func (c *SnapshotClient) StackAssets(ctx context.Context, cover string, ids []string) error {
+	return ErrOffline
+}
+
+func (c *SnapshotClient) UpsertTags(ctx context.Context, tags []string) ([]TagSimplified, error) {
+	return nil, ErrOffline
+}
+
+func (c *SnapshotClient) TagAssets(ctx context.Context, tagIDs []string, assetIDs []string) error {
+	return ErrOffline
+}
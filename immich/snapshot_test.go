@@ -0,0 +1,60 @@
+package immich_test
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/simulot/immich-go/browser"
+	"github.com/simulot/immich-go/immich"
+	fakeimmich "github.com/simulot/immich-go/internal/fakeImmich"
+)
+
+func TestSnapshot(t *testing.T) {
+	ctx := context.Background()
+
+	// a server having an asset in an album
+	server := immich.NewDryRunClient(&fakeimmich.MockedCLient{})
+	resp, _ := server.AssetUpload(ctx, &browser.LocalAssetFile{FileName: "photo.jpg", Title: "photo.jpg", FileSize: 100})
+	al, _ := server.CreateAlbum(ctx, "Holidays", "", []string{resp.ID})
+
+	snap, err := immich.TakeSnapshot(ctx, server, "http://immich:2283")
+	if err != nil {
+		t.Fatal(err)
+	}
+	b := bytes.Buffer{}
+	err = snap.Write(&b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	snap, err = immich.ReadSnapshot(&b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if snap.Server != "http://immich:2283" {
+		t.Errorf("unexpected server %q", snap.Server)
+	}
+
+	ic := immich.NewSnapshotClient(snap)
+	assets, err := ic.GetAllAssets(ctx)
+	if err != nil || len(assets) != 1 || assets[0].ID != resp.ID || assets[0].ExifInfo.FileSizeInByte != 100 {
+		t.Errorf("the snapshot should give the asset, got %v, %v", assets, err)
+	}
+	albums, err := ic.GetAssetAlbums(ctx, resp.ID)
+	if err != nil || len(albums) != 1 || albums[0].ID != al.ID || albums[0].AlbumName != "Holidays" {
+		t.Errorf("the snapshot should give the asset's album, got %v, %v", albums, err)
+	}
+	if len(ic.SupportedMedia()) == 0 {
+		t.Error("the snapshot should give the supported media")
+	}
+
+	_, err = ic.AssetUpload(ctx, &browser.LocalAssetFile{FileName: "other.jpg"})
+	if !errors.Is(err, immich.ErrOffline) {
+		t.Errorf("the snapshot can't receive an upload, got %v", err)
+	}
+	_, err = immich.NewDryRunClient(ic).AssetUpload(ctx, &browser.LocalAssetFile{FileName: "other.jpg"})
+	if err != nil {
+		t.Errorf("the upload should be simulated, got %v", err)
+	}
+}
@@ -0,0 +1,35 @@
+package immich
+
+import "context"
+
+type TagSimplified struct {
+	ID    string `json:"id"`
+	Name  string `json:"name"`
+	Value string `json:"value"`
+}
+
+// UpsertTags creates the tags when they don't exist, and returns them all.
+// A tag's value can be hierarchical, like "Places/France/Paris".
+func (ic *ImmichClient) UpsertTags(ctx context.Context, tags []string) ([]TagSimplified, error) {
+	var r []TagSimplified
+	body := struct {
+		Tags []string `json:"tags"`
+	}{Tags: tags}
+	err := ic.newServerCall(ctx, EndPointUpsertTags).do(
+		putRequest("/tags", setAcceptJSON(), setJSONBody(body)),
+		responseJSON(&r))
+	if err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// TagAssets adds the tags to the assets
+func (ic *ImmichClient) TagAssets(ctx context.Context, tagIDs []string, assetIDs []string) error {
+	body := struct {
+		TagIDs   []string `json:"tagIds"`
+		AssetIDs []string `json:"assetIds"`
+	}{TagIDs: tagIDs, AssetIDs: assetIDs}
+	return ic.newServerCall(ctx, EndPointTagAssets).do(
+		putRequest("/tags/assets", setAcceptJSON(), setJSONBody(body)))
+}
@@ -42,6 +42,14 @@ func (c *MockedCLient) StackAssets(ctx context.Context, cover string, ids []stri
 	return nil
 }
 
+func (c *MockedCLient) UpsertTags(ctx context.Context, tags []string) ([]immich.TagSimplified, error) {
+	return nil, nil
+}
+
+func (c *MockedCLient) TagAssets(ctx context.Context, tagIDs []string, assetIDs []string) error {
+	return nil
+}
+
 func (c *MockedCLient) UpdateAsset(ctx context.Context, id string, a *browser.LocalAssetFile) (*immich.Asset, error) {
 	return nil, nil
 }
@@ -76,6 +84,10 @@ func (c *MockedCLient) DeleteAlbum(ctx context.Context, id string) error {
 	return nil
 }
 
+func (c *MockedCLient) UpdateAlbumInfo(ctx context.Context, id string, update immich.AlbumInfoUpdate) error {
+	return nil
+}
+
 func (c *MockedCLient) SupportedMedia() immich.SupportedMedia {
 	return immich.DefaultSupportedMedia
 }
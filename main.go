@@ -9,10 +9,12 @@ import (
 	"os"
 	"os/signal"
 	"runtime/debug"
+	"time"
 
 	"github.com/simulot/immich-go/cmd"
 	"github.com/simulot/immich-go/cmd/duplicate"
 	"github.com/simulot/immich-go/cmd/metadata"
+	"github.com/simulot/immich-go/cmd/snapshot"
 	"github.com/simulot/immich-go/cmd/stack"
 	"github.com/simulot/immich-go/cmd/tool"
 	"github.com/simulot/immich-go/cmd/upload"
@@ -110,7 +112,7 @@ func Run(ctx context.Context) error {
 	fmt.Println(app.Banner.String())
 
 	if len(fs.Args()) == 0 {
-		err = errors.New("missing command upload|duplicate|stack|tool")
+		err = errors.New("missing command upload|duplicate|stack|tool|snapshot")
 	}
 
 	if err != nil {
@@ -118,6 +120,7 @@ func Run(ctx context.Context) error {
 		return err
 	}
 
+	started := time.Now()
 	cmd := fs.Args()[0]
 	switch cmd {
 	case "upload":
@@ -130,6 +133,8 @@ func Run(ctx context.Context) error {
 		err = stack.NewStackCommand(ctx, &app, fs.Args()[1:])
 	case "tool":
 		err = tool.CommandTool(ctx, &app, fs.Args()[1:])
+	case "snapshot":
+		err = snapshot.SnapshotCommand(ctx, &app, fs.Args()[1:])
 	default:
 		err = fmt.Errorf("unknown command: %q", cmd)
 	}
@@ -137,6 +142,7 @@ func Run(ctx context.Context) error {
 	if err != nil {
 		app.Log.Error(err.Error())
 	}
+	app.Notify(ctx, cmd, started, err)
 	fmt.Println("Check the log file: ", app.LogFile)
 	if app.APITraceWriter != nil {
 		fmt.Println("Check the trace file: ", app.APITraceWriterName)